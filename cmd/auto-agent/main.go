@@ -20,6 +20,9 @@ import (
     "github.com/yourorg/auto-agent/internal/slack"
     "github.com/yourorg/auto-agent/internal/llm"
     "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
 )
 
 func main() {
@@ -36,26 +39,60 @@ func main() {
     if err != nil { klog.Fatalf("dynamic client: %v", err) }
 
     pol := policy.LoadFromEnv()
+    // bot mode (per-policy channels, threaded incidents) when a bot token is set
     sl := slack.New(os.Getenv("SLACK_WEBHOOK_URL"))
+    if t := os.Getenv("SLACK_BOT_TOKEN"); t != "" { sl = slack.NewBot(t, os.Getenv("SLACK_CHANNEL")) }
+    snooze, err := time.ParseDuration(getenv("SLACK_SNOOZE", "1h"))
+    if err != nil || snooze <= 0 { klog.Fatalf("SLACK_SNOOZE: invalid %q", os.Getenv("SLACK_SNOOZE")) }
+    sl.Snooze = snooze
     ll := llm.New(os.Getenv("LLM_API_URL"), os.Getenv("LLM_API_KEY"), os.Getenv("LLM_MODEL"), pol.LLMEnabled)
 
-    mp, err := metrics.NewProviderFromEnv(ctx)
+    mp, err := metrics.NewProviderFromEnv(ctx, dyn)
     if err != nil { klog.Fatalf("metrics provider: %v", err) }
 
-    // health + metrics endpoint
-    go httpapi.Serve(":8080")
-
     // CRD controller
     store := crd.NewStore()
     crd.StartController(ctx, dyn, store)
 
+    // action budgets + cooldowns shared by every mutating path
+    cd := guard.NewCooldowns(ctx, kc, getenv("POD_NAMESPACE", "kube-system"), "auto-agent-cooldowns", store, pol.PodCooldown)
+    g := guard.New(pol, store, cd, guard.NewBudgets(kc, getenv("POD_NAMESPACE", "kube-system"), "auto-agent-budgets"))
+    go g.Run(ctx, 30*time.Second)
+
+    // values-file PRs (gitops.mode pr) or recorded live patches (live); nil when
+    // pr mode has no GITOPS_REPO/GIT_TOKEN
+    retention, err := time.ParseDuration(getenv("CHANGES_RETENTION", "72h"))
+    if err != nil { klog.Fatalf("CHANGES_RETENTION: %v", err) }
+    ledger := changes.NewLedger(kc, getenv("POD_NAMESPACE", "kube-system"), retention)
+    gops, err := kube.NewGitOpsFromEnv(dyn, ledger)
+    if err != nil { klog.Fatalf("gitops: %v", err) }
+
+    // PagerDuty escalation; nil unless PAGERDUTY_ENABLED
+    pg := kube.NewPagerFromEnv()
+
+    // pending actions for suggest mode / requireApproval; any replica may execute them
+    q := approval.NewQueue(kc, getenv("POD_NAMESPACE", "kube-system"), pol.ApprovalTTL)
+    go q.Run(ctx, 15*time.Second, kube.ExecuteApproved(kc, dyn, g, gops), kube.NotifyDecision(sl, pg))
+
+    // health + metrics + approvals endpoint
+    hc := httpapi.Config{
+        Approvals: q, ApprovalToken: os.Getenv("APPROVALS_TOKEN"), OnDecision: kube.NotifyDecision(sl, pg),
+        Slack: sl, SlackSigningSecret: os.Getenv("SLACK_SIGNING_SECRET"), SnoozeFor: snooze,
+    }
+    if gops != nil && gops.Mode == "live" { hc.Changes, hc.Revert = ledger, kube.RevertChange(gops, sl) }
+    go httpapi.Serve(":8080", hc)
+
     // leader election (for cluster-wide scaling)
     le := leader.Start(ctx, kc, "auto-agent-leader")
 
-    // start pod watcher: node-local remediation
-    go kube.WatchPods(ctx, kc, mp, pol, sl, ll)
+    // start pod watcher: node-local remediation, tickets, recovery follow-ups
+    tix := kube.NewTicketsFromEnv(ctx, kc)
+    rc, err := kube.NewRecoveryFromEnv(kc, tix, pg, sl)
+    if err != nil { klog.Fatalf("recovery: %v", err) }
+    go rc.Run(ctx)
+    go kube.WatchPods(ctx, kc, mp, pol, sl, ll, g, q, store, gops, tix, pg, rc)
 
-    // scaling + anomalies (leader-only)
+    // scaling (leader-only)
     go func() {
         t := time.NewTicker(30 * time.Second)
         defer t.Stop()
@@ -65,11 +102,30 @@ func main() {
                 return
             case <-t.C:
                 if !le.IsLeader() { continue }
-                kube.EvaluateAndScale(ctx, kc, mp, pol, sl, ll) // global policy + values
-                kube.CheckAnomalies(ctx, kc, mp, pol, sl, ll, store) // CRD-driven anomalies
+                kube.EvaluateAndScale(ctx, kc, dyn, mp, pol, sl, ll, g, q, store, gops) // global policy + values
+            }
+        }
+    }()
+
+    // CRD-driven anomalies (leader-only); the interval is also the step of the
+    // history seeded from Prometheus
+    every, err := time.ParseDuration(getenv("ANOMALIES_POLL_INTERVAL", "30s"))
+    if err != nil || every <= 0 { klog.Fatalf("ANOMALIES_POLL_INTERVAL: invalid %q", os.Getenv("ANOMALIES_POLL_INTERVAL")) }
+    go func() {
+        t := time.NewTicker(every)
+        defer t.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-t.C:
+                if !le.IsLeader() { continue }
+                kube.CheckAnomalies(ctx, kc, mp, pol, sl, ll, store, pg)
             }
         }
     }()
 
     <-ctx.Done()
 }
+
+func getenv(k, d string) string { if v := os.Getenv(k); v != "" { return v }; return d }
@@ -0,0 +1,310 @@
+package approval
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+    "k8s.io/klog/v2"
+)
+
+type Kind string
+
+const (
+    DeletePod  Kind = "delete_pod"
+    EvictPod   Kind = "evict_pod"
+    Scale      Kind = "scale"
+    MemoryBump Kind = "memory_bump"
+    ImageMirror Kind = "image_mirror"
+)
+
+type State string
+
+const (
+    Pending   State = "pending"
+    Approved  State = "approved"
+    Rejected  State = "rejected"
+    Expired   State = "expired"
+    Executing State = "executing"
+    Done      State = "done"
+    Failed    State = "failed"
+)
+
+const (
+    labelManaged = "auto-agent.io/pending-action"
+    labelKey     = "auto-agent.io/action-key"
+    labelState   = "auto-agent.io/action-state"
+    dataKey      = "action.json"
+    namePrefix   = "auto-agent-action-"
+    // finished actions are kept this long for audit before being deleted
+    retention = 24 * time.Hour
+)
+
+// ClaimTimeout is how long an executing action may hold its claim. A claim
+// older than that belongs to a replica that died or could not record the
+// result; the action is then marked failed rather than run again, since it
+// may have been partly applied.
+const ClaimTimeout = 10 * time.Minute
+
+// Meta keys: the response_url of the Slack message that carried the approval
+// buttons, and the channel of the incident (from the matching policy).
+const (
+    MetaSlackResponseURL = "slack_response_url"
+    MetaSlackChannel     = "slack_channel"
+)
+
+var (
+    ErrNotFound   = errors.New("pending action not found")
+    ErrNotPending = errors.New("action is not pending")
+    ErrClaimLost  = errors.New("execution claim was taken over")
+)
+
+// Action is a proposed remediation waiting for a human decision. Target is
+// the object acted on (pod name, or kind/name of a workload); Params carries
+// kind-specific arguments such as the desired replica count.
+type Action struct {
+    ID        string            `json:"id"`
+    Kind      Kind              `json:"kind"`
+    Namespace string            `json:"namespace"`
+    Target    string            `json:"target"`
+    Workload  string            `json:"workload,omitempty"`
+    Reason    string            `json:"reason,omitempty"`
+    Summary   string            `json:"summary"`
+    Params    map[string]string `json:"params,omitempty"`
+    Labels    map[string]string `json:"labels,omitempty"`
+    State     State             `json:"state"`
+    CreatedAt time.Time         `json:"createdAt"`
+    ExpiresAt time.Time         `json:"expiresAt"`
+    DecidedBy string            `json:"decidedBy,omitempty"`
+    DecidedAt time.Time         `json:"decidedAt,omitempty"`
+    SnoozedUntil time.Time      `json:"snoozedUntil,omitempty"`
+    ClaimedAt time.Time         `json:"claimedAt,omitempty"` // start of the execution
+    Result    string            `json:"result,omitempty"`
+    // Meta holds notifier state, e.g. the Slack response_url of the message
+    // carrying the approval buttons.
+    Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// Key identifies the change independently of its ID, so repeated detections
+// of the same problem map to one pending action.
+func (a *Action) Key() string {
+    h := sha1.Sum([]byte(fmt.Sprintf("%s/%s/%s", a.Kind, a.Namespace, a.Target)))
+    return hex.EncodeToString(h[:])[:16]
+}
+
+// Executor performs an approved action and returns a human-readable result.
+type Executor func(ctx context.Context, a *Action) (string, error)
+
+// Queue stores pending actions as ConfigMaps in the agent namespace, one per
+// action, so any replica can decide on or execute them. State changes rely on
+// resourceVersion conflicts: an approved action is executed by exactly one
+// replica.
+type Queue struct {
+    kc  kubernetes.Interface
+    ns  string
+    ttl time.Duration
+    now func() time.Time
+}
+
+func NewQueue(kc kubernetes.Interface, ns string, ttl time.Duration) *Queue {
+    return &Queue{kc: kc, ns: ns, ttl: ttl, now: time.Now}
+}
+
+// Propose enqueues a. If an action with the same key is still pending, that
+// one is returned instead and created is false.
+func (q *Queue) Propose(ctx context.Context, a Action) (out *Action, created bool, err error) {
+    key := a.Key()
+    cms, err := q.kc.CoreV1().ConfigMaps(q.ns).List(ctx, metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s,%s=%s", labelKey, key, labelState, Pending)})
+    if err != nil { return nil, false, err }
+    now := q.now()
+    for i := range cms.Items {
+        if ex, err := decode(&cms.Items[i]); err == nil && now.Before(ex.ExpiresAt) { return ex, false, nil }
+    }
+    id, err := newID()
+    if err != nil { return nil, false, err }
+    a.ID, a.State, a.CreatedAt, a.ExpiresAt = id, Pending, now.UTC(), now.Add(q.ttl).UTC()
+    cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+        Namespace: q.ns, Name: namePrefix + id,
+        Labels: map[string]string{labelManaged: "true", labelKey: key},
+    }}
+    if err := encode(cm, &a); err != nil { return nil, false, err }
+    if _, err := q.kc.CoreV1().ConfigMaps(q.ns).Create(ctx, cm, metav1.CreateOptions{}); err != nil { return nil, false, err }
+    return &a, true, nil
+}
+
+func (q *Queue) Get(ctx context.Context, id string) (*Action, error) {
+    cm, err := q.kc.CoreV1().ConfigMaps(q.ns).Get(ctx, namePrefix+id, metav1.GetOptions{})
+    if apierrors.IsNotFound(err) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return decode(cm)
+}
+
+// List returns all actions, newest first.
+func (q *Queue) List(ctx context.Context) ([]*Action, error) {
+    cms, err := q.kc.CoreV1().ConfigMaps(q.ns).List(ctx, metav1.ListOptions{LabelSelector: labelManaged + "=true"})
+    if err != nil { return nil, err }
+    out := make([]*Action, 0, len(cms.Items))
+    for i := range cms.Items {
+        if a, err := decode(&cms.Items[i]); err == nil { out = append(out, a) }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    return out, nil
+}
+
+// Decide approves or rejects a pending action on behalf of by.
+func (q *Queue) Decide(ctx context.Context, id string, approve bool, by string) (*Action, error) {
+    return q.transition(ctx, id, func(a *Action) error {
+        if a.State != Pending { return ErrNotPending }
+        if !q.now().Before(a.ExpiresAt) { return fmt.Errorf("%w: expired at %s", ErrNotPending, a.ExpiresAt.Format(time.RFC3339)) }
+        a.State = Rejected
+        if approve { a.State = Approved }
+        a.DecidedBy, a.DecidedAt = by, q.now().UTC()
+        return nil
+    })
+}
+
+// Snooze defers a pending action by d: its expiry moves out by d and it is
+// announced again once the snooze ends.
+func (q *Queue) Snooze(ctx context.Context, id string, d time.Duration, by string) (*Action, error) {
+    return q.transition(ctx, id, func(a *Action) error {
+        if a.State != Pending { return ErrNotPending }
+        now := q.now()
+        if !now.Before(a.ExpiresAt) { return fmt.Errorf("%w: expired at %s", ErrNotPending, a.ExpiresAt.Format(time.RFC3339)) }
+        a.SnoozedUntil = now.Add(d).UTC()
+        a.ExpiresAt = a.ExpiresAt.Add(d)
+        a.DecidedBy = by
+        return nil
+    })
+}
+
+// SetMeta records notifier state on an action.
+func (q *Queue) SetMeta(ctx context.Context, id, key, value string) (*Action, error) {
+    return q.transition(ctx, id, func(a *Action) error {
+        if a.Meta == nil { a.Meta = map[string]string{} }
+        a.Meta[key] = value
+        return nil
+    })
+}
+
+// Run polls the queue until ctx is done: it expires stale pending actions,
+// executes approved ones and garbage-collects finished ones. notify is called
+// after every terminal state change and when a snoozed action is due again.
+func (q *Queue) Run(ctx context.Context, interval time.Duration, exec Executor, notify func(*Action)) {
+    t := time.NewTicker(interval)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+            q.process(ctx, exec, notify)
+        }
+    }
+}
+
+func (q *Queue) process(ctx context.Context, exec Executor, notify func(*Action)) {
+    all, err := q.List(ctx)
+    if err != nil { klog.Warningf("approval: list: %v", err); return }
+    now := q.now()
+    for _, a := range all {
+        switch {
+        case a.State == Pending && !now.Before(a.ExpiresAt):
+            if x, err := q.transition(ctx, a.ID, func(x *Action) error {
+                if x.State != Pending { return ErrNotPending }
+                x.State = Expired
+                return nil
+            }); err == nil { notify(x) }
+        case a.State == Pending && !a.SnoozedUntil.IsZero() && !now.Before(a.SnoozedUntil):
+            if x, err := q.transition(ctx, a.ID, func(x *Action) error {
+                if x.State != Pending || x.SnoozedUntil.IsZero() { return ErrNotPending }
+                x.SnoozedUntil, x.DecidedBy = time.Time{}, ""
+                return nil
+            }); err == nil { notify(x) }
+        case a.State == Approved:
+            // Claim it; losing the race to another replica yields ErrNotPending.
+            claim := now.UTC()
+            x, err := q.transition(ctx, a.ID, func(x *Action) error {
+                if x.State != Approved { return ErrNotPending }
+                x.State, x.ClaimedAt = Executing, claim
+                return nil
+            })
+            if err != nil { continue }
+            res, err := exec(ctx, x)
+            done, terr := q.transition(ctx, a.ID, func(x *Action) error {
+                if x.State != Executing || !x.ClaimedAt.Equal(claim) { return ErrClaimLost }
+                x.State, x.Result = Done, res
+                if err != nil { x.State, x.Result = Failed, err.Error() }
+                return nil
+            })
+            if terr != nil {
+                // The stale-claim sweep fails the action once ClaimTimeout passes.
+                klog.Warningf("approval: record result of %s (%v, %q): %v", a.ID, err, res, terr)
+                continue
+            }
+            notify(done)
+        case q.stale(a):
+            if x, err := q.transition(ctx, a.ID, func(x *Action) error {
+                if !q.stale(x) { return ErrClaimLost }
+                x.State = Failed
+                x.Result = fmt.Sprintf("no result recorded within %s of the claim at %s; check %s/%s before proposing it again", ClaimTimeout, x.ClaimedAt.Format(time.RFC3339), x.Namespace, x.Target)
+                return nil
+            }); err == nil { notify(x) }
+        case a.State != Pending && a.State != Executing && now.Sub(a.CreatedAt) > retention:
+            _ = q.kc.CoreV1().ConfigMaps(q.ns).Delete(ctx, namePrefix+a.ID, metav1.DeleteOptions{})
+        }
+    }
+}
+
+// stale reports whether a is held in Executing by a claim past ClaimTimeout.
+func (q *Queue) stale(a *Action) bool {
+    return a.State == Executing && q.now().Sub(a.ClaimedAt) > ClaimTimeout
+}
+
+func (q *Queue) transition(ctx context.Context, id string, fn func(*Action) error) (*Action, error) {
+    var out *Action
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cm, err := q.kc.CoreV1().ConfigMaps(q.ns).Get(ctx, namePrefix+id, metav1.GetOptions{})
+        if apierrors.IsNotFound(err) { return ErrNotFound }
+        if err != nil { return err }
+        a, err := decode(cm)
+        if err != nil { return err }
+        if err := fn(a); err != nil { return err }
+        if err := encode(cm, a); err != nil { return err }
+        if _, err := q.kc.CoreV1().ConfigMaps(q.ns).Update(ctx, cm, metav1.UpdateOptions{}); err != nil { return err }
+        out = a
+        return nil
+    })
+    return out, err
+}
+
+func encode(cm *corev1.ConfigMap, a *Action) error {
+    b, err := json.Marshal(a)
+    if err != nil { return err }
+    if cm.Data == nil { cm.Data = map[string]string{} }
+    cm.Data[dataKey] = string(b)
+    cm.Labels[labelState] = string(a.State)
+    return nil
+}
+
+func decode(cm *corev1.ConfigMap) (*Action, error) {
+    a := &Action{}
+    if err := json.Unmarshal([]byte(cm.Data[dataKey]), a); err != nil { return nil, fmt.Errorf("decode %s: %w", cm.Name, err) }
+    return a, nil
+}
+
+func newID() (string, error) {
+    b := make([]byte, 6)
+    if _, err := rand.Read(b); err != nil { return "", err }
+    return hex.EncodeToString(b), nil
+}
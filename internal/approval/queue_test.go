@@ -0,0 +1,247 @@
+package approval
+
+import (
+    "context"
+    "errors"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+type clock struct {
+    mu sync.Mutex
+    t  time.Time
+}
+
+func (c *clock) now() time.Time { c.mu.Lock(); defer c.mu.Unlock(); return c.t }
+func (c *clock) add(d time.Duration) { c.mu.Lock(); c.t = c.t.Add(d); c.mu.Unlock() }
+
+// newClientset returns a fake clientset whose ConfigMap updates fail with a
+// conflict on a stale resourceVersion, as the API server's do; the plain
+// fake accepts every update, which would let two replicas claim one action.
+func newClientset() *fake.Clientset {
+    kc := fake.NewSimpleClientset()
+    gvr := corev1.SchemeGroupVersion.WithResource("configmaps")
+    var mu sync.Mutex
+    rv := 0
+    kc.PrependReactor("create", "configmaps", func(a k8stesting.Action) (bool, runtime.Object, error) {
+        mu.Lock(); defer mu.Unlock()
+        cm := a.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+        rv++
+        cm.ResourceVersion = strconv.Itoa(rv)
+        return true, cm, kc.Tracker().Create(gvr, cm, cm.Namespace)
+    })
+    kc.PrependReactor("update", "configmaps", func(a k8stesting.Action) (bool, runtime.Object, error) {
+        mu.Lock(); defer mu.Unlock()
+        cm := a.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+        cur, err := kc.Tracker().Get(gvr, cm.Namespace, cm.Name)
+        if err != nil { return true, nil, err }
+        if cur.(*corev1.ConfigMap).ResourceVersion != cm.ResourceVersion {
+            return true, nil, apierrors.NewConflict(gvr.GroupResource(), cm.Name, errors.New("stale resourceVersion"))
+        }
+        rv++
+        cm.ResourceVersion = strconv.Itoa(rv)
+        return true, cm, kc.Tracker().Update(gvr, cm, cm.Namespace)
+    })
+    return kc
+}
+
+func newTestQueue(kc *fake.Clientset, c *clock) *Queue {
+    q := NewQueue(kc, "ops", time.Hour)
+    q.now = c.now
+    return q
+}
+
+// notes records notified actions.
+type notes struct {
+    mu  sync.Mutex
+    got []Action
+}
+
+func (n *notes) notify(a *Action) { n.mu.Lock(); n.got = append(n.got, *a); n.mu.Unlock() }
+
+func (n *notes) take() []Action {
+    n.mu.Lock(); defer n.mu.Unlock()
+    got := n.got
+    n.got = nil
+    return got
+}
+
+func noExec(t *testing.T) Executor {
+    return func(ctx context.Context, a *Action) (string, error) {
+        t.Errorf("executed %s (%s)", a.ID, a.State)
+        return "", nil
+    }
+}
+
+func TestProposeDedup(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    q := newTestQueue(newClientset(), c)
+    a := Action{Kind: DeletePod, Namespace: "a", Target: "api-1", Summary: "delete api-1"}
+
+    first, created, err := q.Propose(ctx, a)
+    if err != nil || !created { t.Fatalf("first proposal: created=%v err=%v", created, err) }
+    again, created, err := q.Propose(ctx, a)
+    if err != nil || created || again.ID != first.ID { t.Fatalf("same change: id=%s created=%v err=%v, want %s", again.ID, created, err, first.ID) }
+    other, created, err := q.Propose(ctx, Action{Kind: DeletePod, Namespace: "a", Target: "api-2"})
+    if err != nil || !created || other.ID == first.ID { t.Fatalf("other target: id=%s created=%v err=%v", other.ID, created, err) }
+
+    c.add(time.Hour)
+    renewed, created, err := q.Propose(ctx, a)
+    if err != nil || !created || renewed.ID == first.ID { t.Fatalf("after expiry: id=%s created=%v err=%v, want a new action", renewed.ID, created, err) }
+}
+
+func TestDecide(t *testing.T) {
+    ctx := context.Background()
+    for _, tc := range []struct {
+        name    string
+        approve bool
+        before  func(q *Queue, c *clock, id string)
+        want    State
+        err     error
+    }{
+        {name: "approve", approve: true, want: Approved},
+        {name: "reject", want: Rejected},
+        {name: "decided twice", approve: true, before: func(q *Queue, c *clock, id string) { q.Decide(ctx, id, false, "bob") }, err: ErrNotPending},
+        {name: "expired", approve: true, before: func(q *Queue, c *clock, id string) { c.add(time.Hour) }, err: ErrNotPending},
+        {name: "unknown", approve: true, before: func(q *Queue, c *clock, id string) { q.kc.CoreV1().ConfigMaps("ops").Delete(ctx, namePrefix+id, metav1.DeleteOptions{}) }, err: ErrNotFound},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            c := &clock{t: time.Unix(1700000000, 0)}
+            q := newTestQueue(newClientset(), c)
+            a, _, err := q.Propose(ctx, Action{Kind: Scale, Namespace: "a", Target: "deployment/api"})
+            if err != nil { t.Fatal(err) }
+            if tc.before != nil { tc.before(q, c, a.ID) }
+            x, err := q.Decide(ctx, a.ID, tc.approve, "alice")
+            if tc.err != nil {
+                if !errors.Is(err, tc.err) { t.Fatalf("err = %v, want %v", err, tc.err) }
+                return
+            }
+            if err != nil { t.Fatal(err) }
+            if x.State != tc.want || x.DecidedBy != "alice" { t.Fatalf("state = %s by %q, want %s by alice", x.State, x.DecidedBy, tc.want) }
+            if got, _ := q.Get(ctx, a.ID); got.State != tc.want { t.Fatalf("stored state = %s, want %s", got.State, tc.want) }
+        })
+    }
+}
+
+func TestSnoozeAndExpiry(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    q := newTestQueue(newClientset(), c)
+    n := &notes{}
+    a, _, err := q.Propose(ctx, Action{Kind: EvictPod, Namespace: "a", Target: "api-1"})
+    if err != nil { t.Fatal(err) }
+
+    x, err := q.Snooze(ctx, a.ID, 30*time.Minute, "alice")
+    if err != nil { t.Fatal(err) }
+    if want := a.ExpiresAt.Add(30 * time.Minute); !x.ExpiresAt.Equal(want) { t.Fatalf("expires %s, want %s", x.ExpiresAt, want) }
+
+    c.add(10 * time.Minute)
+    q.process(ctx, noExec(t), n.notify)
+    if got := n.take(); len(got) != 0 { t.Fatalf("notified during the snooze: %+v", got) }
+
+    c.add(21 * time.Minute)
+    q.process(ctx, noExec(t), n.notify)
+    got := n.take()
+    if len(got) != 1 || got[0].State != Pending || !got[0].SnoozedUntil.IsZero() || got[0].DecidedBy != "" {
+        t.Fatalf("after the snooze: %+v, want one reminder of the pending action", got)
+    }
+
+    c.add(30 * time.Minute)
+    q.process(ctx, noExec(t), n.notify)
+    if got := n.take(); len(got) != 0 { t.Fatalf("notified before the extended expiry: %+v", got) }
+
+    c.add(30 * time.Minute)
+    q.process(ctx, noExec(t), n.notify)
+    if got := n.take(); len(got) != 1 || got[0].State != Expired { t.Fatalf("after expiry: %+v, want one expired action", got) }
+    if _, err := q.Snooze(ctx, a.ID, time.Minute, "alice"); !errors.Is(err, ErrNotPending) { t.Fatalf("snooze after expiry: err = %v, want ErrNotPending", err) }
+}
+
+// Two replicas polling the same approved action execute it once.
+func TestSingleExecutor(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    kc := newClientset()
+    q1, q2 := newTestQueue(kc, c), newTestQueue(kc, c)
+    n := &notes{}
+    a, _, err := q1.Propose(ctx, Action{Kind: Scale, Namespace: "a", Target: "deployment/api"})
+    if err != nil { t.Fatal(err) }
+    if _, err := q2.Decide(ctx, a.ID, true, "alice"); err != nil { t.Fatal(err) }
+
+    var runs int32
+    exec := func(ctx context.Context, a *Action) (string, error) {
+        atomic.AddInt32(&runs, 1)
+        return "scaled", nil
+    }
+    var wg sync.WaitGroup
+    for _, q := range []*Queue{q1, q2, q1, q2} {
+        wg.Add(1)
+        go func(q *Queue) { defer wg.Done(); q.process(ctx, exec, n.notify) }(q)
+    }
+    wg.Wait()
+
+    if runs != 1 { t.Fatalf("executed %d times, want once", runs) }
+    got := n.take()
+    if len(got) != 1 || got[0].State != Done || got[0].Result != "scaled" { t.Fatalf("notified %+v, want one done action", got) }
+}
+
+// An action whose executor never records a result is failed, not run again,
+// once its claim is stale; a result arriving after that is dropped.
+func TestStaleClaim(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    kc := newClientset()
+    q1, q2 := newTestQueue(kc, c), newTestQueue(kc, c)
+    n := &notes{}
+    a, _, err := q1.Propose(ctx, Action{Kind: MemoryBump, Namespace: "a", Target: "deployment/api"})
+    if err != nil { t.Fatal(err) }
+    if _, err := q1.Decide(ctx, a.ID, true, "alice"); err != nil { t.Fatal(err) }
+
+    // q1 hangs in the executor; meanwhile q2 sees a live, then a stale claim.
+    q1.process(ctx, func(ctx context.Context, x *Action) (string, error) {
+        c.add(ClaimTimeout / 2)
+        q2.process(ctx, noExec(t), n.notify)
+        if got := n.take(); len(got) != 0 { t.Errorf("live claim: notified %+v", got) }
+
+        c.add(ClaimTimeout)
+        q2.process(ctx, noExec(t), n.notify)
+        got := n.take()
+        if len(got) != 1 || got[0].State != Failed || !strings.Contains(got[0].Result, "no result recorded") {
+            t.Errorf("stale claim: notified %+v, want one failed action", got)
+        }
+        return "bumped", nil
+    }, n.notify)
+
+    if got := n.take(); len(got) != 0 { t.Fatalf("late result notified: %+v", got) }
+    x, err := q1.Get(ctx, a.ID)
+    if err != nil { t.Fatal(err) }
+    if x.State != Failed || x.Result == "bumped" { t.Fatalf("state %s (%q), want the stale claim's failure kept", x.State, x.Result) }
+}
+
+// A live claim survives the retention sweep; a finished action does not.
+func TestRetentionKeepsLiveClaims(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    q := newTestQueue(newClientset(), c)
+    live, _, _ := q.Propose(ctx, Action{Kind: Scale, Namespace: "a", Target: "deployment/api"})
+    done, _, _ := q.Propose(ctx, Action{Kind: Scale, Namespace: "a", Target: "deployment/web"})
+    c.add(retention + time.Minute)
+    claim := c.now().UTC()
+    if _, err := q.transition(ctx, live.ID, func(x *Action) error { x.State, x.ClaimedAt = Executing, claim; return nil }); err != nil { t.Fatal(err) }
+    if _, err := q.transition(ctx, done.ID, func(x *Action) error { x.State = Done; return nil }); err != nil { t.Fatal(err) }
+
+    q.process(ctx, noExec(t), func(*Action) {})
+    if _, err := q.Get(ctx, live.ID); err != nil { t.Errorf("live claim: %v", err) }
+    if _, err := q.Get(ctx, done.ID); !errors.Is(err, ErrNotFound) { t.Errorf("finished action: err = %v, want ErrNotFound", err) }
+}
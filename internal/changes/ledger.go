@@ -0,0 +1,198 @@
+// Package changes records live patches made to workloads (gitops.mode: live)
+// together with the patch that restores the previous values, so any change
+// can be reverted with a single call.
+package changes
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+)
+
+type State string
+
+const (
+    Applied   State = "applied"
+    Reverting State = "reverting"
+    Reverted  State = "reverted"
+)
+
+var (
+    ErrNotFound   = errors.New("change not found")
+    ErrNotApplied = errors.New("change is not applied")
+    ErrClaimLost  = errors.New("revert claim was taken over")
+)
+
+// ClaimTimeout is how long a revert may hold a change in Reverting. A claim
+// older than that belongs to a replica that died mid-revert; it can be taken
+// over, and prune no longer keeps the change for it.
+const ClaimTimeout = 10 * time.Minute
+
+const (
+    labelManaged = "auto-agent.io/change"
+    labelState   = "auto-agent.io/change-state"
+    dataKey      = "change.json"
+    namePrefix   = "auto-agent-change-"
+)
+
+// Change is one live patch. Patch was applied to the object (or its
+// Subresource) with PatchType; Revert is the patch of the same type that
+// puts back Previous.
+type Change struct {
+    ID          string            `json:"id"`
+    Namespace   string            `json:"namespace"`
+    Kind        string            `json:"kind"`
+    Name        string            `json:"name"`
+    Resource    string            `json:"resource"` // group/version/resource
+    Subresource string            `json:"subresource,omitempty"`
+    PatchType   string            `json:"patchType"`
+    Patch       json.RawMessage   `json:"patch"`
+    Revert      json.RawMessage   `json:"revert"`
+    Previous    map[string]string `json:"previous,omitempty"`
+    Summary     string            `json:"summary"`
+    Reason      string            `json:"reason,omitempty"`
+    State       State             `json:"state"`
+    CreatedAt   time.Time         `json:"createdAt"`
+    RevertedBy  string            `json:"revertedBy,omitempty"`
+    RevertedAt  time.Time         `json:"revertedAt,omitempty"`
+    ClaimedAt   time.Time         `json:"claimedAt,omitempty"` // start of the current revert
+    Error       string            `json:"error,omitempty"` // last failed revert
+}
+
+// Ledger stores changes as ConfigMaps in the agent namespace, one per change,
+// so any replica can list and revert them. Changes older than retention are
+// deleted when a new one is recorded.
+type Ledger struct {
+    kc        kubernetes.Interface
+    ns        string
+    retention time.Duration
+    now       func() time.Time
+}
+
+func NewLedger(kc kubernetes.Interface, ns string, retention time.Duration) *Ledger {
+    return &Ledger{kc: kc, ns: ns, retention: retention, now: time.Now}
+}
+
+// Record stores c as applied and returns it with its ID set.
+func (l *Ledger) Record(ctx context.Context, c Change) (*Change, error) {
+    id, err := newID()
+    if err != nil { return nil, err }
+    c.ID, c.State, c.CreatedAt = id, Applied, l.now().UTC()
+    cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+        Namespace: l.ns, Name: namePrefix + id,
+        Labels: map[string]string{labelManaged: "true"},
+    }}
+    if err := encode(cm, &c); err != nil { return nil, err }
+    if _, err := l.kc.CoreV1().ConfigMaps(l.ns).Create(ctx, cm, metav1.CreateOptions{}); err != nil { return nil, err }
+    l.prune(ctx)
+    return &c, nil
+}
+
+func (l *Ledger) Get(ctx context.Context, id string) (*Change, error) {
+    cm, err := l.kc.CoreV1().ConfigMaps(l.ns).Get(ctx, namePrefix+id, metav1.GetOptions{})
+    if apierrors.IsNotFound(err) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return decode(cm)
+}
+
+// List returns all recorded changes, newest first.
+func (l *Ledger) List(ctx context.Context) ([]*Change, error) {
+    cms, err := l.kc.CoreV1().ConfigMaps(l.ns).List(ctx, metav1.ListOptions{LabelSelector: labelManaged + "=true"})
+    if err != nil { return nil, err }
+    out := make([]*Change, 0, len(cms.Items))
+    for i := range cms.Items {
+        if c, err := decode(&cms.Items[i]); err == nil { out = append(out, c) }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    return out, nil
+}
+
+// Revert claims an applied change, or one whose revert claim is stale, and
+// runs apply with it. Revert patches set absolute values, so applying one
+// again after a crashed attempt is safe. On success the change is marked
+// reverted by by; on failure it stays applied with the error recorded, so the
+// revert can be retried.
+func (l *Ledger) Revert(ctx context.Context, id, by string, apply func(context.Context, *Change) error) (*Change, error) {
+    var claim time.Time
+    c, err := l.transition(ctx, id, func(c *Change) error {
+        if c.State != Applied && !l.stale(c) { return fmt.Errorf("%w (%s)", ErrNotApplied, c.State) }
+        claim = l.now().UTC()
+        c.State, c.ClaimedAt = Reverting, claim
+        return nil
+    })
+    if err != nil { return nil, err }
+    aerr := apply(ctx, c)
+    c, err = l.transition(ctx, id, func(c *Change) error {
+        if c.State != Reverting || !c.ClaimedAt.Equal(claim) { return ErrClaimLost }
+        if aerr != nil { c.State, c.Error = Applied, aerr.Error(); return nil }
+        c.State, c.RevertedBy, c.RevertedAt, c.Error = Reverted, by, l.now().UTC(), ""
+        return nil
+    })
+    if aerr != nil { return c, aerr }
+    return c, err
+}
+
+func (l *Ledger) prune(ctx context.Context) {
+    if l.retention <= 0 { return }
+    all, err := l.List(ctx)
+    if err != nil { return }
+    for _, c := range all {
+        if (c.State != Reverting || l.stale(c)) && l.now().Sub(c.CreatedAt) > l.retention {
+            _ = l.kc.CoreV1().ConfigMaps(l.ns).Delete(ctx, namePrefix+c.ID, metav1.DeleteOptions{})
+        }
+    }
+}
+
+// stale reports whether c is held in Reverting by a claim past ClaimTimeout.
+func (l *Ledger) stale(c *Change) bool {
+    return c.State == Reverting && l.now().Sub(c.ClaimedAt) > ClaimTimeout
+}
+
+func (l *Ledger) transition(ctx context.Context, id string, fn func(*Change) error) (*Change, error) {
+    var out *Change
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cm, err := l.kc.CoreV1().ConfigMaps(l.ns).Get(ctx, namePrefix+id, metav1.GetOptions{})
+        if apierrors.IsNotFound(err) { return ErrNotFound }
+        if err != nil { return err }
+        c, err := decode(cm)
+        if err != nil { return err }
+        if err := fn(c); err != nil { return err }
+        if err := encode(cm, c); err != nil { return err }
+        if _, err := l.kc.CoreV1().ConfigMaps(l.ns).Update(ctx, cm, metav1.UpdateOptions{}); err != nil { return err }
+        out = c
+        return nil
+    })
+    return out, err
+}
+
+func encode(cm *corev1.ConfigMap, c *Change) error {
+    b, err := json.Marshal(c)
+    if err != nil { return err }
+    if cm.Data == nil { cm.Data = map[string]string{} }
+    cm.Data[dataKey] = string(b)
+    cm.Labels[labelState] = string(c.State)
+    return nil
+}
+
+func decode(cm *corev1.ConfigMap) (*Change, error) {
+    c := &Change{}
+    if err := json.Unmarshal([]byte(cm.Data[dataKey]), c); err != nil { return nil, fmt.Errorf("decode %s: %w", cm.Name, err) }
+    return c, nil
+}
+
+func newID() (string, error) {
+    b := make([]byte, 6)
+    if _, err := rand.Read(b); err != nil { return "", err }
+    return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,69 @@
+package changes
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLedger(now *time.Time) *Ledger {
+    l := NewLedger(fake.NewSimpleClientset(), "ops", time.Hour)
+    l.now = func() time.Time { return *now }
+    return l
+}
+
+func TestRevertTakesOverStaleClaim(t *testing.T) {
+    ctx := context.Background()
+    now := time.Unix(1700000000, 0)
+    l := newTestLedger(&now)
+    c, err := l.Record(ctx, Change{Name: "api", Summary: "scale"})
+    if err != nil { t.Fatal(err) }
+
+    // A replica claims the change and dies before finishing.
+    crashed := func(context.Context, *Change) error { return nil }
+    if _, err := l.transition(ctx, c.ID, func(c *Change) error { c.State, c.ClaimedAt = Reverting, now; return nil }); err != nil { t.Fatal(err) }
+    if _, err := l.Revert(ctx, c.ID, "alice", crashed); !errors.Is(err, ErrNotApplied) { t.Fatalf("fresh claim: err = %v, want ErrNotApplied", err) }
+
+    now = now.Add(ClaimTimeout + time.Second)
+    got, err := l.Revert(ctx, c.ID, "alice", crashed)
+    if err != nil { t.Fatalf("stale claim: %v", err) }
+    if got.State != Reverted || got.RevertedBy != "alice" { t.Fatalf("got %+v", got) }
+}
+
+func TestRevertClaimLost(t *testing.T) {
+    ctx := context.Background()
+    now := time.Unix(1700000000, 0)
+    l := newTestLedger(&now)
+    c, err := l.Record(ctx, Change{Name: "api"})
+    if err != nil { t.Fatal(err) }
+
+    // The revert stalls past the timeout and another replica takes it over.
+    slow := func(ctx context.Context, _ *Change) error {
+        now = now.Add(ClaimTimeout + time.Second)
+        _, err := l.Revert(ctx, c.ID, "bob", func(context.Context, *Change) error { return nil })
+        return err
+    }
+    if _, err := l.Revert(ctx, c.ID, "alice", slow); !errors.Is(err, ErrClaimLost) { t.Fatalf("err = %v, want ErrClaimLost", err) }
+    got, err := l.Get(ctx, c.ID)
+    if err != nil { t.Fatal(err) }
+    if got.State != Reverted || got.RevertedBy != "bob" { t.Fatalf("got %+v", got) }
+}
+
+func TestPruneDropsStaleClaims(t *testing.T) {
+    ctx := context.Background()
+    now := time.Unix(1700000000, 0)
+    l := newTestLedger(&now)
+    fresh, _ := l.Record(ctx, Change{Name: "fresh"})
+    stale, _ := l.Record(ctx, Change{Name: "stale"})
+    for _, c := range []*Change{fresh, stale} {
+        if _, err := l.transition(ctx, c.ID, func(c *Change) error { c.State, c.ClaimedAt = Reverting, now; return nil }); err != nil { t.Fatal(err) }
+    }
+    now = now.Add(2 * time.Hour)
+    if _, err := l.transition(ctx, fresh.ID, func(c *Change) error { c.ClaimedAt = now; return nil }); err != nil { t.Fatal(err) }
+    l.prune(ctx)
+    if _, err := l.Get(ctx, fresh.ID); err != nil { t.Errorf("in-flight revert pruned: %v", err) }
+    if _, err := l.Get(ctx, stale.ID); !errors.Is(err, ErrNotFound) { t.Errorf("stale claim kept: err = %v", err) }
+}
@@ -3,6 +3,7 @@ package crd
 import (
     "context"
     "fmt"
+    "strings"
 
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     "k8s.io/apimachinery/pkg/labels"
@@ -11,6 +12,8 @@ import (
     "k8s.io/client-go/tools/cache"
     "k8s.io/client-go/dynamic/dynamicinformer"
     "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+    "github.com/yourorg/auto-agent/internal/policy"
 )
 
 var gvr = schema.GroupVersionResource{
@@ -40,9 +43,7 @@ func syncAll(store *Store, s cache.Store) {
         if err != nil { continue }
         nsMap[ns] = append(nsMap[ns], sp)
     }
-    for ns, ps := range nsMap {
-        store.Update(ns, ps)
-    }
+    store.Replace(nsMap)
 }
 
 func parse(u *unstructured.Unstructured) (Policy, error) {
@@ -60,6 +61,9 @@ func parse(u *unstructured.Unstructured) (Policy, error) {
         p.Selector = labels.Everything()
     }
 
+    if v, ok := spec["mode"].(string); ok { p.Mode = policy.Mode(v) }
+    p.RestartStuckPods = true
+    p.Scale.Enabled = true // a CR without actions.scale does not opt out of scaling
     if act, ok := spec["actions"].(map[string]interface{}); ok {
         if v, ok := act["restartStuckPods"].(bool); ok { p.RestartStuckPods = v }
         if v, ok := act["bumpMemoryPercent"].(int64); ok { p.BumpMemoryPercent = int(v) }
@@ -69,13 +73,63 @@ func parse(u *unstructured.Unstructured) (Policy, error) {
             if v, ok := sc["maxReplicas"].(int64); ok { p.Scale.MaxReplicas = int32(v) }
             if v, ok := sc["step"].(int64); ok { p.Scale.Step = int32(v) }
             if v, ok := sc["allowHPAOverride"].(bool); ok { p.Scale.AllowHPAOverride = v }
+            if v, ok := sc["combine"].(string); ok { p.Scale.Combine = strings.ToUpper(v) }
+            if pr, ok := sc["predictive"].(map[string]interface{}); ok {
+                p.Scale.Predictive.Mode = "shadow"
+                if v, ok := pr["mode"].(string); ok { p.Scale.Predictive.Mode = v }
+                if v, ok := pr["query"].(string); ok { p.Scale.Predictive.Query = v }
+                switch v := pr["threshold"].(type) {
+                case int64: p.Scale.Predictive.Threshold = float64(v)
+                case float64: p.Scale.Predictive.Threshold = v
+                }
+                if v, ok := pr["history"].(string); ok { p.Scale.Predictive.History = v }
+                if v, ok := pr["season"].(string); ok { p.Scale.Predictive.Season = v }
+                if v, ok := pr["horizon"].(string); ok { p.Scale.Predictive.Horizon = v }
+                if v, ok := pr["step"].(string); ok { p.Scale.Predictive.Step = v }
+            }
+            if sigs, ok := sc["signals"].([]interface{}); ok {
+                for _, x := range sigs {
+                    m, ok := x.(map[string]interface{})
+                    if !ok { continue }
+                    s := ScaleSignal{Operator: ">"}
+                    if v, ok := m["name"].(string); ok { s.Name = v }
+                    if v, ok := m["query"].(string); ok { s.Query = v }
+                    if v, ok := m["operator"].(string); ok { s.Operator = v }
+                    switch v := m["threshold"].(type) {
+                    case int64: s.Threshold = float64(v)
+                    case float64: s.Threshold = v
+                    }
+                    if s.Query != "" { p.Scale.Signals = append(p.Scale.Signals, s) }
+                }
+            }
+        }
+    }
+    if sc, ok := spec["schedule"].(map[string]interface{}); ok {
+        if v, ok := sc["timezone"].(string); ok { p.Schedule.Timezone = v }
+        ws, _ := sc["windows"].([]interface{})
+        for _, x := range ws {
+            m, ok := x.(map[string]interface{})
+            if !ok { continue }
+            w := ScheduleWindow{}
+            if v, ok := m["name"].(string); ok { w.Name = v }
+            if v, ok := m["start"].(string); ok { w.Start = v }
+            if v, ok := m["end"].(string); ok { w.End = v }
+            if v, ok := m["minReplicas"].(int64); ok { w.MinReplicas = int32(v) }
+            if v, ok := m["maxReplicas"].(int64); ok { w.MaxReplicas = int32(v) }
+            if w.Start != "" && w.End != "" { p.Schedule.Windows = append(p.Schedule.Windows, w) }
         }
     }
     if esc, ok := spec["escalation"].(map[string]interface{}); ok {
         if v, ok := esc["slackChannel"].(string); ok { p.SlackChannel = v }
+        if v, ok := esc["runbookURL"].(string); ok { p.RunbookURL = v }
+        if v, ok := esc["pagerDutyRoutingKey"].(string); ok { p.PagerDutyRoutingKey = v }
         if t, ok := esc["ticketing"].(map[string]interface{}); ok {
             if v, ok := t["provider"].(string); ok { p.Ticketing.Provider = v }
             if v, ok := t["projectOrRepo"].(string); ok { p.Ticketing.ProjectOrRepo = v }
+            p.Ticketing.Assignees = stringSlice(t["assignees"])
+            p.Ticketing.Labels = stringSlice(t["labels"])
+            if v, ok := t["issueType"].(string); ok { p.Ticketing.IssueType = v }
+            if v, ok := t["priority"].(string); ok { p.Ticketing.Priority = v }
         }
     }
     if sa, ok := spec["safety"].(map[string]interface{}); ok {
@@ -89,11 +143,25 @@ func parse(u *unstructured.Unstructured) (Policy, error) {
                 r := AnomalyRule{}
                 if v, ok := m["name"].(string); ok { r.Name = v }
                 if v, ok := m["promql"].(string); ok { r.PromQL = v }
-                if v, ok := m["zscoreThreshold"].(float64); ok { r.ZScoreThreshold = v }
+                switch v := m["zscoreThreshold"].(type) {
+                case float64: r.ZScoreThreshold = v
+                case int64: r.ZScoreThreshold = float64(v)
+                }
                 if v, ok := m["minSamples"].(int64); ok { r.MinSamples = int(v) }
+                if v, ok := m["lookback"].(string); ok { r.Lookback = v }
+                if v, ok := m["for"].(string); ok { r.For = v }
                 p.Anomalies = append(p.Anomalies, r)
             }
         }
     }
     return p, nil
 }
+
+func stringSlice(v interface{}) []string {
+    xs, _ := v.([]interface{})
+    out := make([]string, 0, len(xs))
+    for _, x := range xs {
+        if s, ok := x.(string); ok { out = append(out, s) }
+    }
+    return out
+}
@@ -1,8 +1,11 @@
 package crd
 
 import (
+    "sort"
     "sync"
     "k8s.io/apimachinery/pkg/labels"
+
+    "github.com/yourorg/auto-agent/internal/policy"
 )
 
 type ScaleConfig struct {
@@ -11,6 +14,33 @@ type ScaleConfig struct {
     MaxReplicas    int32
     Step           int32
     AllowHPAOverride bool
+    Signals        []ScaleSignal
+    Combine        string // "OR" (default): any signal gates; "AND": all must
+    Predictive     Predictive
+}
+
+// Predictive configures forecast-driven scale-up. Mode is "off" (default
+// without the block), "shadow" (forecast and export metrics only) or "on".
+// Query is a signal template like ScaleSignal.Query; empty means pod CPU.
+// Durations accept a "d" suffix (e.g. "7d").
+type Predictive struct {
+    Mode      string
+    Query     string
+    Threshold float64 // 0: SCALE_CPU_THRESHOLD
+    History   string  // training window, default 7d
+    Season    string  // default 24h
+    Horizon   string  // how far ahead to scale, default 15m
+    Step      string  // sample resolution, default 5m
+}
+
+// ScaleSignal is a PromQL template rendered per workload with .Namespace,
+// .Name and .Selector (the workload's selector as PromQL label matchers),
+// compared against Threshold with Operator (>, >=, <, <=, ==, !=).
+type ScaleSignal struct {
+    Name      string
+    Query     string
+    Operator  string
+    Threshold float64
 }
 
 type Ticketing struct {
@@ -18,6 +48,8 @@ type Ticketing struct {
     ProjectOrRepo string
     Assignees     []string
     Labels        []string
+    IssueType     string // Jira issue type name, e.g. Bug
+    Priority      string // Jira priority name, e.g. High
 }
 
 type AnomalyRule struct {
@@ -25,16 +57,37 @@ type AnomalyRule struct {
     PromQL         string
     ZScoreThreshold float64
     MinSamples     int
+    Lookback       string // history window for the baseline, e.g. "1h"
+    For            string // how long the breach must last before alerting
+}
+
+// Schedule overrides scaling bounds during recurring windows. Each window
+// opens when Start (a cron expression, evaluated in Timezone) fires and closes
+// when End fires.
+type Schedule struct {
+    Timezone string // IANA name, default UTC
+    Windows  []ScheduleWindow
+}
+
+type ScheduleWindow struct {
+    Name        string
+    Start       string
+    End         string
+    MinReplicas int32
+    MaxReplicas int32
 }
 
 type Policy struct {
     Namespace      string
     Name           string
     Selector       labels.Selector
+    Mode           policy.Mode // empty: use the global AUTO_MODE
     RestartStuckPods bool
     BumpMemoryPercent int
     Scale          ScaleConfig
+    Schedule       Schedule
     SlackChannel   string
+    PagerDutyRoutingKey string
     Ticketing      Ticketing
     RunbookURL     string
     Cooldown       string
@@ -54,6 +107,32 @@ func (s *Store) Update(ns string, ps []Policy) {
     s.mu.Lock(); defer s.mu.Unlock()
     s.byNS[ns] = ps
 }
+// Replace swaps the whole index, dropping namespaces that no longer have policies.
+func (s *Store) Replace(byNS map[string][]Policy) {
+    s.mu.Lock(); defer s.mu.Unlock()
+    s.byNS = byNS
+}
+
+// Namespaces returns the namespaces that have at least one policy, sorted.
+func (s *Store) Namespaces() []string {
+    s.mu.RLock(); defer s.mu.RUnlock()
+    out := make([]string, 0, len(s.byNS))
+    for ns, ps := range s.byNS {
+        if len(ps) > 0 { out = append(out, ns) }
+    }
+    sort.Strings(out)
+    return out
+}
+
+// All returns every policy across namespaces, ordered by namespace.
+func (s *Store) All() []Policy {
+    out := []Policy{}
+    for _, ns := range s.Namespaces() {
+        out = append(out, s.List(ns)...)
+    }
+    return out
+}
+
 func (s *Store) List(ns string) []Policy {
     s.mu.RLock(); defer s.mu.RUnlock()
     return append([]Policy(nil), s.byNS[ns]...)
@@ -0,0 +1,92 @@
+package forecast
+
+import (
+    "errors"
+    "math"
+)
+
+// ErrTooShort is returned when there is not enough history to fit a model.
+var ErrTooShort = errors.New("forecast: not enough history")
+
+// Model is a fitted additive Holt-Winters model (level + trend + season). With
+// less than two seasons of history it degrades to Holt's linear trend.
+type Model struct {
+    Alpha, Beta, Gamma float64
+    Level, Trend       float64
+    // Season holds the seasonal offsets of the next len(Season) steps after
+    // the last observation; nil for the trend-only model.
+    Season []float64
+    // RMSE of the one-step-ahead predictions over the fitted history.
+    RMSE float64
+}
+
+// grid of smoothing parameters tried by Fit.
+var grid = []float64{0.05, 0.1, 0.2, 0.4, 0.6, 0.8}
+
+// Fit picks the smoothing parameters that minimise the one-step-ahead error
+// over xs. season is the period in steps (e.g. 288 for a day of 5m steps);
+// values < 2 fit a trend-only model.
+func Fit(xs []float64, season int) (*Model, error) {
+    if len(xs) < 3 { return nil, ErrTooShort }
+    if season < 2 || len(xs) < 2*season { season = 0 }
+    var best *Model
+    gammas := grid
+    if season == 0 { gammas = []float64{0} }
+    for _, a := range grid {
+        for _, b := range grid {
+            for _, g := range gammas {
+                m := run(xs, season, a, b, g)
+                if best == nil || m.RMSE < best.RMSE { best = m }
+            }
+        }
+    }
+    return best, nil
+}
+
+// Forecast returns the predicted value h steps (h >= 1) after the last observation.
+func (m *Model) Forecast(h int) float64 {
+    if h < 1 { h = 1 }
+    v := m.Level + float64(h)*m.Trend
+    if n := len(m.Season); n > 0 { v += m.Season[(h-1)%n] }
+    return v
+}
+
+func run(xs []float64, season int, a, b, g float64) *Model {
+    var level, trend, sse float64
+    var seas []float64
+    start := 1
+    if season > 0 {
+        // Initial trend from the first two seasons; the first season is
+        // detrended into seasonal offsets and the level placed at its end.
+        m1, m2 := mean(xs[:season]), mean(xs[season:2*season])
+        trend = (m2 - m1) / float64(season)
+        mid := float64(season-1) / 2
+        level = m1 + mid*trend
+        seas = make([]float64, len(xs))
+        for i := 0; i < season; i++ { seas[i] = xs[i] - (m1 + (float64(i)-mid)*trend) }
+        start = season
+    } else {
+        level, trend = xs[0], xs[1]-xs[0]
+    }
+    n := 0
+    for t := start; t < len(xs); t++ {
+        s := 0.0
+        if season > 0 { s = seas[t-season] }
+        pred := level + trend + s
+        sse += (xs[t] - pred) * (xs[t] - pred)
+        n++
+        last := level
+        level = a*(xs[t]-s) + (1-a)*(level+trend)
+        trend = b*(level-last) + (1-b)*trend
+        if season > 0 { seas[t] = g*(xs[t]-level) + (1-g)*s }
+    }
+    m := &Model{Alpha: a, Beta: b, Gamma: g, Level: level, Trend: trend, RMSE: math.Sqrt(sse / float64(n))}
+    if season > 0 { m.Season = append([]float64(nil), seas[len(xs)-season:]...) }
+    return m
+}
+
+func mean(xs []float64) float64 {
+    s := 0.0
+    for _, x := range xs { s += x }
+    return s / float64(len(xs))
+}
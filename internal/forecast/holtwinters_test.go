@@ -0,0 +1,50 @@
+package forecast
+
+import (
+    "errors"
+    "math"
+    "testing"
+)
+
+func TestFitTooShort(t *testing.T) {
+    if _, err := Fit([]float64{1, 2}, 0); !errors.Is(err, ErrTooShort) { t.Fatalf("err = %v, want ErrTooShort", err) }
+}
+
+func TestFitLinear(t *testing.T) {
+    var xs []float64
+    for i := 0; i < 20; i++ { xs = append(xs, 10+2*float64(i)) }
+    m, err := Fit(xs, 0)
+    if err != nil { t.Fatal(err) }
+    if m.Season != nil { t.Errorf("trend-only model has a season") }
+    if m.RMSE > 1e-9 { t.Errorf("RMSE = %v, want 0", m.RMSE) }
+    for h, want := range map[int]float64{1: 50, 5: 58, 0: 50} {
+        if got := m.Forecast(h); math.Abs(got-want) > 1e-9 { t.Errorf("Forecast(%d) = %v, want %v", h, got, want) }
+    }
+}
+
+func TestFitSeasonNeedsTwoPeriods(t *testing.T) {
+    xs := []float64{1, 5, 1, 5, 1, 5, 1}
+    for _, season := range []int{1, 4} {
+        m, err := Fit(xs, season)
+        if err != nil { t.Fatal(err) }
+        if m.Season != nil || m.Gamma != 0 { t.Errorf("season %d: got a seasonal model from %d points", season, len(xs)) }
+    }
+}
+
+func TestFitSeasonal(t *testing.T) {
+    pattern := []float64{0, 4, 8, 4, 0, -4, -8, -4}
+    var xs []float64
+    for i := 0; i < 6*len(pattern); i++ { xs = append(xs, 100+0.5*float64(i)+pattern[i%len(pattern)]) }
+    m, err := Fit(xs, len(pattern))
+    if err != nil { t.Fatal(err) }
+    if len(m.Season) != len(pattern) { t.Fatalf("season has %d offsets, want %d", len(m.Season), len(pattern)) }
+    n := len(xs)
+    for h := 1; h <= 2*len(pattern); h++ {
+        want := 100 + 0.5*float64(n-1+h) + pattern[(n-1+h)%len(pattern)]
+        if got := m.Forecast(h); math.Abs(got-want) > 0.5 { t.Errorf("Forecast(%d) = %.3f, want %.3f", h, got, want) }
+    }
+
+    trend, err := Fit(xs, 0)
+    if err != nil { t.Fatal(err) }
+    if m.RMSE >= trend.RMSE { t.Errorf("seasonal RMSE %.3f not below trend-only %.3f", m.RMSE, trend.RMSE) }
+}
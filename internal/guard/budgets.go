@@ -0,0 +1,118 @@
+package guard
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+)
+
+// Budgets keeps the action windows in a ConfigMap so every agent replica
+// draws from the same cluster, namespace and workload budgets. Each key holds
+// the comma-separated Unix milliseconds of the actions in its window; updates
+// use optimistic concurrency, like Cooldowns.
+type Budgets struct {
+    kc   kubernetes.Interface
+    ns   string
+    name string
+}
+
+func NewBudgets(kc kubernetes.Interface, ns, name string) *Budgets {
+    return &Budgets{kc: kc, ns: ns, name: name}
+}
+
+// take consumes one unit of each of ws at now and returns their logs, or the
+// *BudgetError of the first without room. Only the timestamps stored in the
+// ConfigMap count; the windows' own ts are not read.
+func (b *Budgets) take(ctx context.Context, ws []*window, now time.Time) ([][]time.Time, error) {
+    var logs [][]time.Time
+    var full *BudgetError
+    err := b.update(ctx, func(data map[string]string) bool {
+        logs, full = make([][]time.Time, len(ws)), nil
+        for i, w := range ws {
+            c := &window{ts: parseLog(data[w.key()]), scope: w.scope, ns: w.ns, wl: w.wl, limit: w.limit, d: w.d}
+            c.prune(now)
+            if full = c.full(now); full != nil { return false }
+            logs[i] = append(c.ts, now)
+        }
+        for i, w := range ws { data[w.key()] = formatLog(logs[i]) }
+        gcLogs(data, now)
+        return true
+    })
+    if err != nil { return nil, err }
+    if full != nil { return nil, full }
+    return logs, nil
+}
+
+// refund drops the newest entry of each of ws.
+func (b *Budgets) refund(ctx context.Context, ws []*window) error {
+    return b.update(ctx, func(data map[string]string) bool {
+        for _, w := range ws {
+            ts := parseLog(data[w.key()])
+            if len(ts) == 0 { continue }
+            data[w.key()] = formatLog(ts[:len(ts)-1])
+        }
+        return true
+    })
+}
+
+// load returns every stored window log by key.
+func (b *Budgets) load(ctx context.Context) (map[string][]time.Time, error) {
+    cm, err := b.kc.CoreV1().ConfigMaps(b.ns).Get(ctx, b.name, metav1.GetOptions{})
+    if apierrors.IsNotFound(err) { return map[string][]time.Time{}, nil }
+    if err != nil { return nil, err }
+    out := make(map[string][]time.Time, len(cm.Data))
+    for k, v := range cm.Data { out[k] = parseLog(v) }
+    return out, nil
+}
+
+// update applies fn to the ConfigMap's data and writes it back if fn returns
+// true, creating the ConfigMap on first use.
+func (b *Budgets) update(ctx context.Context, fn func(map[string]string) bool) error {
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cm, err := b.kc.CoreV1().ConfigMaps(b.ns).Get(ctx, b.name, metav1.GetOptions{})
+        create := apierrors.IsNotFound(err)
+        if err != nil && !create { return err }
+        if create {
+            cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: b.ns, Name: b.name}}
+        }
+        if cm.Data == nil { cm.Data = map[string]string{} }
+        if !fn(cm.Data) { return nil }
+        if create {
+            _, err = b.kc.CoreV1().ConfigMaps(b.ns).Create(ctx, cm, metav1.CreateOptions{})
+            if apierrors.IsAlreadyExists(err) { return apierrors.NewConflict(corev1.Resource("configmaps"), b.name, err) }
+            return err
+        }
+        _, err = b.kc.CoreV1().ConfigMaps(b.ns).Update(ctx, cm, metav1.UpdateOptions{})
+        return err
+    })
+}
+
+// gcLogs drops keys with no action inside the longest window.
+func gcLogs(data map[string]string, now time.Time) {
+    for k, v := range data {
+        ts := parseLog(v)
+        if len(ts) == 0 || now.Sub(ts[len(ts)-1]) >= WorkloadWindow { delete(data, k) }
+    }
+}
+
+func parseLog(s string) []time.Time {
+    var out []time.Time
+    for _, f := range strings.Split(s, ",") {
+        ms, err := strconv.ParseInt(f, 10, 64)
+        if err == nil { out = append(out, time.UnixMilli(ms)) }
+    }
+    return out
+}
+
+func formatLog(ts []time.Time) string {
+    fs := make([]string, len(ts))
+    for i, t := range ts { fs[i] = strconv.FormatInt(t.UnixMilli(), 10) }
+    return strings.Join(fs, ",")
+}
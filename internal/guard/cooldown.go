@@ -0,0 +1,173 @@
+package guard
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+)
+
+// Entries older than this are dropped from the ConfigMap on the next write.
+const cooldownRetention = 24 * time.Hour
+
+// CooldownError is returned while a workload/reason pair is cooling down.
+type CooldownError struct {
+    Key       string
+    Cooldown  time.Duration
+    Remaining time.Duration
+}
+
+func (e *CooldownError) Error() string {
+    return fmt.Sprintf("cooldown active for %s (%s, %s left)", e.Key, e.Cooldown, e.Remaining.Round(time.Second))
+}
+
+// Cooldowns tracks the last remediation per workload and reason. State is
+// persisted in a ConfigMap so it survives restarts and is shared by every
+// agent replica; updates use optimistic concurrency, so only one replica can
+// claim a given cooldown slot.
+type Cooldowns struct {
+    mu    sync.Mutex             // guards last and locks
+    locks map[string]*sync.Mutex // key → held across the ConfigMap round trip
+    kc    kubernetes.Interface
+    ns    string
+    name  string
+    store *crd.Store
+    def   time.Duration
+    last  map[string]time.Time
+    now   func() time.Time
+}
+
+func NewCooldowns(ctx context.Context, kc kubernetes.Interface, ns, name string, store *crd.Store, def time.Duration) *Cooldowns {
+    c := &Cooldowns{kc: kc, ns: ns, name: name, store: store, def: def, last: map[string]time.Time{}, locks: map[string]*sync.Mutex{}, now: time.Now}
+    cm, err := kc.CoreV1().ConfigMaps(ns).Get(ctx, name, metav1.GetOptions{})
+    if err != nil {
+        if !apierrors.IsNotFound(err) { klog.Warningf("cooldowns: load %s/%s: %v", ns, name, err) }
+        return c
+    }
+    for k, v := range cm.Data {
+        if t, err := time.Parse(time.RFC3339, v); err == nil { c.last[k] = t }
+    }
+    return c
+}
+
+// For returns the cooldown for a: the longest safety.cooldown among the
+// matching AutoRemediationPolicies, or the global default.
+func (c *Cooldowns) For(a Action) time.Duration {
+    d := c.def
+    if c.store == nil { return d }
+    for _, p := range c.store.Match(a.Namespace, a.Labels) {
+        if p.Cooldown == "" { continue }
+        pd, err := time.ParseDuration(p.Cooldown)
+        if err != nil { klog.Warningf("cooldowns: %s/%s: bad safety.cooldown %q", p.Namespace, p.Name, p.Cooldown); continue }
+        if pd > d { d = pd }
+    }
+    return d
+}
+
+// Acquire starts the cooldown for a if none is active, otherwise it returns a
+// *CooldownError. If the API server is unreachable the in-memory state is used.
+// Only acquisitions of the same key wait for each other.
+func (c *Cooldowns) Acquire(ctx context.Context, a Action) error {
+    key := cooldownKey(a)
+    defer c.lock(key)()
+    d := c.For(a)
+    now := c.now()
+    if err := c.active(key, d, now, c.seen(key)); err != nil { return err }
+
+    var claimErr error
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        claimErr = nil
+        cm, err := c.kc.CoreV1().ConfigMaps(c.ns).Get(ctx, c.name, metav1.GetOptions{})
+        create := apierrors.IsNotFound(err)
+        if err != nil && !create { return err }
+        if create {
+            cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: c.ns, Name: c.name}}
+        }
+        if cm.Data == nil { cm.Data = map[string]string{} }
+        if t, err := time.Parse(time.RFC3339, cm.Data[key]); err == nil {
+            c.setSeen(key, t)
+            if claimErr = c.active(key, d, now, t); claimErr != nil { return nil }
+        }
+        for k, v := range cm.Data {
+            if t, err := time.Parse(time.RFC3339, v); err != nil || now.Sub(t) > cooldownRetention { delete(cm.Data, k) }
+        }
+        cm.Data[key] = now.UTC().Format(time.RFC3339)
+        if create {
+            _, err = c.kc.CoreV1().ConfigMaps(c.ns).Create(ctx, cm, metav1.CreateOptions{})
+            if apierrors.IsAlreadyExists(err) { return apierrors.NewConflict(corev1.Resource("configmaps"), c.name, err) }
+            return err
+        }
+        _, err = c.kc.CoreV1().ConfigMaps(c.ns).Update(ctx, cm, metav1.UpdateOptions{})
+        return err
+    })
+    if claimErr != nil { return claimErr }
+    if err != nil { klog.Warningf("cooldowns: persist %s: %v (keeping in-memory state)", key, err) }
+    c.setSeen(key, now)
+    return nil
+}
+
+// Release ends the cooldown that Acquire started for a, for an action that
+// was then refused. A cooldown claimed since by another replica is kept.
+func (c *Cooldowns) Release(ctx context.Context, a Action) {
+    key := cooldownKey(a)
+    defer c.lock(key)()
+    ours := c.seen(key)
+    if ours.IsZero() { return }
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cm, err := c.kc.CoreV1().ConfigMaps(c.ns).Get(ctx, c.name, metav1.GetOptions{})
+        if apierrors.IsNotFound(err) { return nil }
+        if err != nil { return err }
+        if cm.Data[key] != ours.UTC().Format(time.RFC3339) { return nil }
+        delete(cm.Data, key)
+        _, err = c.kc.CoreV1().ConfigMaps(c.ns).Update(ctx, cm, metav1.UpdateOptions{})
+        return err
+    })
+    if err != nil { klog.Warningf("cooldowns: release %s: %v (keeping it in the ConfigMap)", key, err) }
+    c.mu.Lock()
+    if c.last[key].Equal(ours) { delete(c.last, key) }
+    c.mu.Unlock()
+}
+
+// lock serialises acquisitions of key and returns the unlock func.
+func (c *Cooldowns) lock(key string) func() {
+    c.mu.Lock()
+    l := c.locks[key]
+    if l == nil { l = &sync.Mutex{}; c.locks[key] = l }
+    c.mu.Unlock()
+    l.Lock()
+    return l.Unlock
+}
+
+func (c *Cooldowns) seen(key string) time.Time {
+    c.mu.Lock(); defer c.mu.Unlock()
+    return c.last[key]
+}
+
+func (c *Cooldowns) setSeen(key string, t time.Time) {
+    c.mu.Lock(); defer c.mu.Unlock()
+    c.last[key] = t
+}
+
+func (c *Cooldowns) active(key string, d time.Duration, now, last time.Time) error {
+    if last.IsZero() || d <= 0 { return nil }
+    if rem := d - now.Sub(last); rem > 0 {
+        return &CooldownError{Key: key, Cooldown: d, Remaining: rem}
+    }
+    return nil
+}
+
+// cooldownKey builds a valid ConfigMap key. Object names cannot contain '_',
+// so it is a safe separator.
+func cooldownKey(a Action) string {
+    return strings.Join([]string{a.Namespace, strings.ReplaceAll(a.Workload, "/", "."), a.Reason}, "_")
+}
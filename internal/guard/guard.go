@@ -0,0 +1,299 @@
+package guard
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+)
+
+// Budget windows. The cluster and namespace limits come from the global
+// policy (MAX_ACTIONS_PER_10M, MAX_ACTIONS_PER_NS_10M), the workload limit from
+// the CRD's safety.maxActionsPerHour with MAX_ACTIONS_PER_WORKLOAD_1H as default.
+const (
+    ClusterWindow   = 10 * time.Minute
+    NamespaceWindow = 10 * time.Minute
+    WorkloadWindow  = time.Hour
+)
+
+const (
+    ScopeCluster   = "cluster"
+    ScopeNamespace = "namespace"
+    ScopeWorkload  = "workload"
+)
+
+// Action describes a cluster mutation the agent is about to perform.
+// Namespace may be empty for cluster-scoped objects (e.g. cordoning a node).
+// Workload is "<kind>/<name>" of the top-level owner, so pod and scaling
+// actions on one Deployment share its budget. Reason (e.g.
+// "CrashLoopBackOff") enables the per-workload cooldown.
+type Action struct {
+    Type      string
+    Reason    string
+    Namespace string
+    Workload  string
+    Labels    map[string]string
+}
+
+// BudgetError is returned when an action would exceed one of the budgets.
+type BudgetError struct {
+    Scope      string
+    Key        string
+    Limit      int
+    Window     time.Duration
+    RetryAfter time.Duration
+}
+
+func (e *BudgetError) Error() string {
+    return fmt.Sprintf("%s budget exhausted for %q (%d per %s, retry in %s)", e.Scope, e.Key, e.Limit, e.Window, e.RetryAfter.Round(time.Second))
+}
+
+// window is a sliding log of action timestamps for one budget. The budget's
+// scope, labels and last known limit are kept so the remaining budget can be
+// re-exported as the window slides.
+type window struct {
+    ts             []time.Time
+    scope, ns, wl  string
+    limit          int
+    d              time.Duration
+}
+
+func (w *window) prune(now time.Time) {
+    i := 0
+    for i < len(w.ts) && now.Sub(w.ts[i]) >= w.d { i++ }
+    w.ts = w.ts[i:]
+}
+
+func (w *window) retryAfter(now time.Time) time.Duration {
+    if len(w.ts) == 0 { return 0 }
+    return w.d - now.Sub(w.ts[0])
+}
+
+// key names the budget in the shared ConfigMap. Object names cannot contain
+// '_', so it is a safe separator.
+func (w *window) key() string {
+    switch w.scope {
+    case ScopeNamespace:
+        return "namespace_" + w.ns
+    case ScopeWorkload:
+        return "workload_" + w.ns + "_" + strings.ReplaceAll(w.wl, "/", ".")
+    }
+    return "cluster"
+}
+
+// Guard tracks sliding-window action budgets per workload, per namespace and
+// cluster-wide, plus per-reason cooldowns. Every mutating code path must call
+// Allow before acting, and Refund if the action then fails. With shared
+// Budgets every agent replica draws from the same budgets; otherwise they are
+// per replica. Cooldowns are always persisted (see Cooldowns).
+type Guard struct {
+    mu         sync.Mutex
+    pol        *policy.Policy
+    store      *crd.Store
+    cd         *Cooldowns
+    shared     *Budgets
+    cluster    *window
+    byNS       map[string]*window
+    byWorkload map[string]*window
+    now        func() time.Time
+}
+
+// New returns a Guard; cd may be nil to disable cooldowns and shared may be
+// nil to keep budgets per replica.
+func New(pol *policy.Policy, store *crd.Store, cd *Cooldowns, shared *Budgets) *Guard {
+    return &Guard{
+        pol: pol, store: store, cd: cd, shared: shared,
+        cluster: &window{scope: ScopeCluster, d: ClusterWindow},
+        byNS: map[string]*window{}, byWorkload: map[string]*window{},
+        now: time.Now,
+    }
+}
+
+// Allow checks every budget that applies to a and, if all have room and no
+// cooldown is active for a.Reason, consumes one unit from each and starts the
+// cooldown. Refused actions are logged and counted in
+// auto_agent_actions_suppressed_total; the error is a *BudgetError naming the
+// scope that ran out or a *CooldownError.
+//
+// g.mu is not held during API calls, so the budgets are checked again when
+// they are consumed: an action that lost its budget to a concurrent one in
+// the meantime is refused, and the cooldown it started is released.
+func (g *Guard) Allow(ctx context.Context, a Action) error {
+    g.mu.Lock()
+    ws := g.windows(a)
+    err := g.check(a, ws, g.now())
+    g.mu.Unlock()
+    if err != nil { return err }
+    if g.cd != nil && a.Reason != "" {
+        if err := g.cd.Acquire(ctx, a); err != nil {
+            klog.Infof("guard: suppressed %s on %s/%s: %v", a.Type, a.Namespace, a.Workload, err)
+            obs.ActionsSuppressedTotal.WithLabelValues(a.Type, a.Namespace, a.Workload, "cooldown").Inc()
+            return err
+        }
+    }
+    now := g.now()
+    if g.shared != nil {
+        logs, err := g.shared.take(ctx, ws, now)
+        if err == nil {
+            g.mu.Lock(); defer g.mu.Unlock()
+            for i, w := range ws { w.ts = logs[i]; g.report(w) }
+            return nil
+        }
+        if be, ok := err.(*BudgetError); ok {
+            g.refuse(a, be)
+            g.release(ctx, a)
+            return be
+        }
+        klog.Warningf("guard: shared budgets: %v (using this replica's budgets)", err)
+    }
+    g.mu.Lock()
+    err = g.check(a, ws, now)
+    if err == nil {
+        for _, w := range ws {
+            w.ts = append(w.ts, now)
+            g.report(w)
+        }
+    }
+    g.mu.Unlock()
+    if err != nil { g.release(ctx, a) }
+    return err
+}
+
+// release ends the cooldown Allow started for a refused action, so the
+// workload is not locked out once the budget recovers.
+func (g *Guard) release(ctx context.Context, a Action) {
+    if g.cd != nil && a.Reason != "" { g.cd.Release(ctx, a) }
+}
+
+// Refund returns the units a allowed action took from its budgets, for an
+// action that failed. Its cooldown stays.
+func (g *Guard) Refund(ctx context.Context, a Action) {
+    g.mu.Lock()
+    ws := g.windows(a)
+    for _, w := range ws {
+        if n := len(w.ts); n > 0 { w.ts = w.ts[:n-1] }
+        g.report(w)
+    }
+    g.mu.Unlock()
+    if g.shared == nil { return }
+    if err := g.shared.refund(ctx, ws); err != nil { klog.Warningf("guard: refund %s on %s/%s: %v", a.Type, a.Namespace, a.Workload, err) }
+}
+
+// Run re-exports the remaining budgets every interval until ctx is done, so
+// the gauge rises again as actions leave their windows. With shared budgets
+// the windows are reloaded first, picking up other replicas' actions.
+func (g *Guard) Run(ctx context.Context, every time.Duration) {
+    t := time.NewTicker(every)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+            g.refresh(ctx)
+        }
+    }
+}
+
+func (g *Guard) refresh(ctx context.Context) {
+    var logs map[string][]time.Time
+    if g.shared != nil {
+        var err error
+        if logs, err = g.shared.load(ctx); err != nil { klog.V(2).Infof("guard: reload shared budgets: %v", err) }
+    }
+    g.mu.Lock(); defer g.mu.Unlock()
+    now := g.now()
+    all := []*window{g.cluster}
+    for _, w := range g.byNS { all = append(all, w) }
+    for _, w := range g.byWorkload { all = append(all, w) }
+    for _, w := range all {
+        if logs != nil { w.ts = logs[w.key()] }
+        w.prune(now)
+        g.report(w)
+    }
+}
+
+// Cooldown returns the cooldown that applies to a, or 0 if cooldowns are off.
+func (g *Guard) Cooldown(a Action) time.Duration {
+    if g.cd == nil { return 0 }
+    return g.cd.For(a)
+}
+
+// windows returns the budgets that apply to a with their current limits. The
+// caller holds g.mu.
+func (g *Guard) windows(a Action) []*window {
+    g.cluster.limit = g.pol.MaxActionsPer10m
+    ws := []*window{g.cluster}
+    if a.Namespace != "" {
+        w := g.windowFor(g.byNS, a.Namespace, &window{scope: ScopeNamespace, ns: a.Namespace, d: NamespaceWindow})
+        w.limit = g.pol.MaxActionsPerNamespace10m
+        ws = append(ws, w)
+    }
+    w := g.windowFor(g.byWorkload, a.Namespace+"/"+a.Workload, &window{scope: ScopeWorkload, ns: a.Namespace, wl: a.Workload, d: WorkloadWindow})
+    w.limit = g.workloadLimit(a)
+    return append(ws, w)
+}
+
+// check returns the *BudgetError of the first of ws without room. The caller
+// holds g.mu.
+func (g *Guard) check(a Action, ws []*window, now time.Time) error {
+    for _, w := range ws {
+        w.prune(now)
+        if be := w.full(now); be != nil {
+            g.refuse(a, be)
+            g.report(w)
+            return be
+        }
+    }
+    return nil
+}
+
+// full returns a *BudgetError if the window has no room left.
+func (w *window) full(now time.Time) *BudgetError {
+    if w.limit <= 0 || len(w.ts) < w.limit { return nil }
+    be := &BudgetError{Scope: w.scope, Key: w.ns, Limit: w.limit, Window: w.d, RetryAfter: w.retryAfter(now)}
+    switch w.scope {
+    case ScopeCluster:
+        be.Key = "cluster"
+    case ScopeWorkload:
+        be.Key = w.ns + "/" + w.wl
+    }
+    return be
+}
+
+func (g *Guard) refuse(a Action, be *BudgetError) {
+    klog.Warningf("guard: refused %s on %s/%s: %v", a.Type, a.Namespace, a.Workload, be)
+    obs.ActionsSuppressedTotal.WithLabelValues(a.Type, a.Namespace, a.Workload, "budget_"+be.Scope).Inc()
+}
+
+func (g *Guard) windowFor(m map[string]*window, key string, init *window) *window {
+    w, ok := m[key]
+    if !ok { w = init; m[key] = w }
+    return w
+}
+
+// workloadLimit picks the strictest maxActionsPerHour of the matching
+// AutoRemediationPolicies, falling back to the global per-workload default.
+func (g *Guard) workloadLimit(a Action) int {
+    limit := g.pol.MaxActionsPerWorkloadHour
+    if g.store == nil || a.Namespace == "" { return limit }
+    found := false
+    for _, p := range g.store.Match(a.Namespace, a.Labels) {
+        if p.MaxActionsPerHour <= 0 { continue }
+        if !found || p.MaxActionsPerHour < limit { limit = p.MaxActionsPerHour; found = true }
+    }
+    return limit
+}
+
+// report exports the remaining budget; unlimited scopes are not exported.
+func (g *Guard) report(w *window) {
+    if w.limit <= 0 { return }
+    obs.BudgetRemaining.WithLabelValues(w.scope, w.ns, w.wl).Set(float64(w.limit - len(w.ts)))
+}
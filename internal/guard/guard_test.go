@@ -0,0 +1,133 @@
+package guard
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+)
+
+type clock struct {
+    mu sync.Mutex
+    t  time.Time
+}
+
+func (c *clock) now() time.Time { c.mu.Lock(); defer c.mu.Unlock(); return c.t }
+func (c *clock) add(d time.Duration) { c.mu.Lock(); c.t = c.t.Add(d); c.mu.Unlock() }
+
+func newGuard(pol *policy.Policy, b *Budgets, c *clock) *Guard {
+    g := New(pol, nil, nil, b)
+    g.now = c.now
+    return g
+}
+
+func TestAllowBudgets(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    g := newGuard(&policy.Policy{MaxActionsPer10m: 3, MaxActionsPerNamespace10m: 2, MaxActionsPerWorkloadHour: 1}, nil, c)
+
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "a", Workload: "deployment/api"}); err != nil { t.Fatal(err) }
+    var be *BudgetError
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "a", Workload: "deployment/api"}); !errors.As(err, &be) || be.Scope != ScopeWorkload {
+        t.Fatalf("second action on the workload: err = %v, want workload budget", err)
+    }
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "a", Workload: "deployment/web"}); err != nil { t.Fatal(err) }
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "a", Workload: "deployment/db"}); !errors.As(err, &be) || be.Scope != ScopeNamespace {
+        t.Fatalf("third action in the namespace: err = %v, want namespace budget", err)
+    }
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "b", Workload: "deployment/api"}); err != nil { t.Fatal(err) }
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "c", Workload: "deployment/api"}); !errors.As(err, &be) || be.Scope != ScopeCluster {
+        t.Fatalf("fourth action: err = %v, want cluster budget", err)
+    }
+
+    c.add(ClusterWindow)
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "c", Workload: "deployment/api"}); err != nil { t.Fatalf("after the window: %v", err) }
+}
+
+func TestRefund(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    b := NewBudgets(fake.NewSimpleClientset(), "ops", "budgets")
+    g := newGuard(&policy.Policy{MaxActionsPerWorkloadHour: 1}, b, c)
+    a := Action{Type: "scale_up", Namespace: "a", Workload: "deployment/api"}
+
+    if err := g.Allow(ctx, a); err != nil { t.Fatal(err) }
+    g.Refund(ctx, a)
+    if err := g.Allow(ctx, a); err != nil { t.Fatalf("after refund: %v", err) }
+    if err := g.Allow(ctx, a); err == nil { t.Fatal("budget not enforced after refund") }
+}
+
+func TestSharedBudgetsAcrossReplicas(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    kc := fake.NewSimpleClientset()
+    pol := &policy.Policy{MaxActionsPer10m: 2}
+    g1 := newGuard(pol, NewBudgets(kc, "ops", "budgets"), c)
+    g2 := newGuard(pol, NewBudgets(kc, "ops", "budgets"), c)
+
+    if err := g1.Allow(ctx, Action{Type: "evict_pod", Namespace: "a", Workload: "deployment/x"}); err != nil { t.Fatal(err) }
+    if err := g2.Allow(ctx, Action{Type: "evict_pod", Namespace: "b", Workload: "deployment/y"}); err != nil { t.Fatal(err) }
+    var be *BudgetError
+    if err := g1.Allow(ctx, Action{Type: "evict_pod", Namespace: "c", Workload: "deployment/z"}); !errors.As(err, &be) || be.Scope != ScopeCluster {
+        t.Fatalf("third action across replicas: err = %v, want cluster budget", err)
+    }
+}
+
+func TestRefreshReportsRecoveredBudget(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    g := newGuard(&policy.Policy{MaxActionsPerWorkloadHour: 3}, nil, c)
+    if err := g.Allow(ctx, Action{Type: "delete_pod", Namespace: "refresh", Workload: "deployment/api"}); err != nil { t.Fatal(err) }
+    gauge := obs.BudgetRemaining.WithLabelValues(ScopeWorkload, "refresh", "deployment/api")
+    if v := testutil.ToFloat64(gauge); v != 2 { t.Fatalf("remaining = %v, want 2", v) }
+
+    c.add(WorkloadWindow)
+    g.refresh(ctx)
+    if v := testutil.ToFloat64(gauge); v != 3 { t.Fatalf("remaining after the window = %v, want 3", v) }
+}
+
+func TestBudgetLogRoundTrip(t *testing.T) {
+    ts := []time.Time{time.UnixMilli(1700000000123), time.UnixMilli(1700000001456)}
+    got := parseLog(formatLog(ts))
+    if len(got) != 2 || !got[0].Equal(ts[0]) || !got[1].Equal(ts[1]) { t.Fatalf("got %v", got) }
+    if parseLog("") != nil { t.Error("empty log should parse to nil") }
+}
+
+// An action refused by the shared budget, after its own replica's check
+// passed, must not leave a cooldown behind: once the window rolls over, the
+// workload can act again.
+func TestBudgetRefusalReleasesCooldown(t *testing.T) {
+    ctx := context.Background()
+    c := &clock{t: time.Unix(1700000000, 0)}
+    kc := fake.NewSimpleClientset()
+    pol := &policy.Policy{MaxActionsPerNamespace10m: 1}
+    replica := func() *Guard {
+        g := newGuard(pol, NewBudgets(kc, "ops", "budgets"), c)
+        g.cd = NewCooldowns(ctx, kc, "ops", "cooldowns", nil, time.Hour)
+        g.cd.now = c.now
+        return g
+    }
+    g1, g2 := replica(), replica()
+
+    if err := g1.Allow(ctx, Action{Type: "delete_pod", Reason: "CrashLoopBackOff", Namespace: "a", Workload: "deployment/web"}); err != nil { t.Fatal(err) }
+    a := Action{Type: "delete_pod", Reason: "CrashLoopBackOff", Namespace: "a", Workload: "deployment/api"}
+    var be *BudgetError
+    if err := g2.Allow(ctx, a); !errors.As(err, &be) || be.Scope != ScopeNamespace { t.Fatalf("err = %v, want the namespace budget", err) }
+    cm, err := kc.CoreV1().ConfigMaps("ops").Get(ctx, "cooldowns", metav1.GetOptions{})
+    if err != nil { t.Fatal(err) }
+    if _, ok := cm.Data[cooldownKey(a)]; ok { t.Errorf("cooldown of the refused action persisted: %v", cm.Data) }
+
+    c.add(NamespaceWindow)
+    if err := g2.Allow(ctx, a); err != nil { t.Fatalf("after the window: %v, want allowed", err) }
+    c.add(NamespaceWindow)
+    var ce *CooldownError
+    if err := g1.Allow(ctx, a); !errors.As(err, &ce) { t.Fatalf("err = %v, want the cooldown of the allowed action", err) }
+}
@@ -0,0 +1,130 @@
+package helmvalues
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "text/template"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// Target is the workload whose settings are edited; it is the data the
+// path templates are rendered with.
+type Target struct {
+    Namespace, Kind, Workload, Container string
+}
+
+// Mapping locates a workload's settings in the values file. Each path is a
+// text/template rendered with a Target, e.g. "{{.Workload | camel}}.resources"
+// for charts that key workloads as paymentApi.
+type Mapping struct {
+    resources, replicas *template.Template
+}
+
+const (
+    DefaultResourcesPath = "{{.Workload}}.resources"
+    DefaultReplicasPath  = "{{.Workload}}.replicaCount"
+)
+
+// MappingFromEnv reads GITOPS_RESOURCES_PATH and GITOPS_REPLICAS_PATH.
+func MappingFromEnv() (Mapping, error) {
+    res, rep := os.Getenv("GITOPS_RESOURCES_PATH"), os.Getenv("GITOPS_REPLICAS_PATH")
+    if res == "" { res = DefaultResourcesPath }
+    if rep == "" { rep = DefaultReplicasPath }
+    return NewMapping(res, rep)
+}
+
+func NewMapping(resources, replicas string) (Mapping, error) {
+    var m Mapping
+    var err error
+    if m.resources, err = template.New("resources").Funcs(funcs).Option("missingkey=error").Parse(resources); err != nil { return m, fmt.Errorf("values: resources path: %w", err) }
+    if m.replicas, err = template.New("replicas").Funcs(funcs).Option("missingkey=error").Parse(replicas); err != nil { return m, fmt.Errorf("values: replicas path: %w", err) }
+    return m, nil
+}
+
+var funcs = template.FuncMap{
+    "camel": camel,
+    "lower": strings.ToLower,
+    "replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// camel turns a DNS name into lowerCamelCase ("payment-api" → "paymentApi").
+func camel(s string) string {
+    parts := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+    for i := 1; i < len(parts); i++ { parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:] }
+    return strings.Join(parts, "")
+}
+
+// ResourcesPath is the path of t's resources block (the node holding limits
+// and requests).
+func (m Mapping) ResourcesPath(t Target) (Path, error) { return render1(m.resources, t) }
+
+// ReplicasPath is the path of t's replica count.
+func (m Mapping) ReplicasPath(t Target) (Path, error) { return render1(m.replicas, t) }
+
+func render1(tpl *template.Template, t Target) (Path, error) {
+    if tpl == nil { return nil, fmt.Errorf("values: mapping not configured") }
+    var b strings.Builder
+    if err := tpl.Execute(&b, t); err != nil { return nil, fmt.Errorf("values: %s path: %w", tpl.Name(), err) }
+    p := ParsePath(b.String())
+    for _, s := range p {
+        if s == "" { return nil, fmt.Errorf("values: %s path %q has an empty segment", tpl.Name(), b.String()) }
+    }
+    return p, nil
+}
+
+// ResourceEdits returns the edits that set each limit and request in r under
+// the resources block at base.
+func ResourceEdits(base Path, r corev1.ResourceRequirements) []Edit {
+    var out []Edit
+    for _, kind := range []struct {
+        name string
+        list corev1.ResourceList
+    }{{"limits", r.Limits}, {"requests", r.Requests}} {
+        names := make([]string, 0, len(kind.list))
+        for n := range kind.list { names = append(names, string(n)) }
+        sort.Strings(names)
+        for _, n := range names {
+            q := kind.list[corev1.ResourceName(n)]
+            out = append(out, Edit{Path: append(append(Path{}, base...), kind.name, n), Value: q.String()})
+        }
+    }
+    return out
+}
+
+// ReplicasEdit sets the replica count at p.
+func ReplicasEdit(p Path, replicas int32) Edit { return Edit{Path: p, Value: fmt.Sprint(replicas)} }
+
+// Diff renders the changed region between old and new as a unified diff
+// hunk with context lines, for PR descriptions. Patches are local, so the
+// common prefix and suffix are trimmed rather than running a full LCS.
+func Diff(path string, old, new []byte, context int) string {
+    a, b := lines(old), lines(new)
+    p := 0
+    for p < len(a) && p < len(b) && a[p] == b[p] { p++ }
+    if p == len(a) && p == len(b) { return "" }
+    s := 0
+    for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] { s++ }
+    lo := p - context
+    if lo < 0 { lo = 0 }
+    ha, hb := len(a)-s+context, len(b)-s+context
+    if ha > len(a) { ha = len(a) }
+    if hb > len(b) { hb = len(b) }
+
+    var out strings.Builder
+    fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n@@ -%d,%d +%d,%d @@\n", path, path, lo+1, ha-lo, lo+1, hb-lo)
+    line := func(prefix, l string) { out.WriteString(prefix + strings.TrimRight(l, "\r\n") + "\n") }
+    for _, l := range a[lo:p] { line(" ", l) }
+    for _, l := range a[p : len(a)-s] { line("-", l) }
+    for _, l := range b[p : len(b)-s] { line("+", l) }
+    for _, l := range a[len(a)-s : ha] { line(" ", l) }
+    return out.String()
+}
+
+func lines(b []byte) []string {
+    l := strings.SplitAfter(string(b), "\n")
+    if l[len(l)-1] == "" { l = l[:len(l)-1] }
+    return l
+}
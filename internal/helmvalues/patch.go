@@ -0,0 +1,304 @@
+// Package helmvalues edits Helm values files in place. Nodes are located
+// with yaml.v3 and only their bytes are rewritten, so comments, key order,
+// quoting and indentation elsewhere in the file are left untouched and the
+// resulting diff is limited to the changed lines.
+package helmvalues
+
+import (
+    "bytes"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Path is a key path into a values file. Numeric segments index sequences.
+type Path []string
+
+// ParsePath splits a dotted path ("api.resources.limits.memory"); a literal
+// dot in a key is written as `\.`.
+func ParsePath(s string) Path {
+    var p Path
+    var cur strings.Builder
+    for i := 0; i < len(s); i++ {
+        switch {
+        case s[i] == '\\' && i+1 < len(s) && s[i+1] == '.':
+            cur.WriteByte('.'); i++
+        case s[i] == '.':
+            p = append(p, cur.String()); cur.Reset()
+        default:
+            cur.WriteByte(s[i])
+        }
+    }
+    return append(p, cur.String())
+}
+
+func (p Path) String() string {
+    seg := make([]string, len(p))
+    for i, s := range p { seg[i] = strings.ReplaceAll(s, ".", `\.`) }
+    return strings.Join(seg, ".")
+}
+
+// Edit sets the scalar at Path to Value, creating missing mapping keys.
+type Edit struct {
+    Path  Path
+    Value string
+}
+
+// Patch applies edits to src and returns the new content. Existing scalars
+// keep their quoting style; missing keys are appended to the innermost
+// existing block mapping using the file's indentation. Block scalars, flow
+// collections with content and paths through aliases are refused rather
+// than rewritten.
+func Patch(src []byte, edits ...Edit) ([]byte, error) {
+    out := src
+    for _, e := range edits {
+        if len(e.Path) == 0 { return nil, fmt.Errorf("values: empty path") }
+        d, err := parse(out)
+        if err != nil { return nil, err }
+        if out, err = d.apply(e); err != nil { return nil, fmt.Errorf("values: %s: %w", e.Path, err) }
+    }
+    return out, nil
+}
+
+// Lookup returns the scalar at p; ok is false if the path does not exist or
+// holds null.
+func Lookup(src []byte, p Path) (value string, ok bool, err error) {
+    d, err := parse(src)
+    if err != nil { return "", false, err }
+    n, _, depth, err := d.find(p)
+    if err != nil || depth < len(p) { return "", false, err }
+    if n.Kind != yaml.ScalarNode { return "", false, fmt.Errorf("values: %s is not a scalar", p) }
+    if n.Tag == "!!null" { return "", false, nil }
+    return n.Value, true, nil
+}
+
+type doc struct {
+    src   []byte
+    lines []int // byte offset of each line start
+    root  *yaml.Node
+    nl    string
+    step  int // indentation step for inserted keys
+}
+
+func parse(src []byte) (*doc, error) {
+    var n yaml.Node
+    if err := yaml.Unmarshal(src, &n); err != nil { return nil, fmt.Errorf("values: %w", err) }
+    d := &doc{src: src, lines: []int{0}, nl: "\n", step: 2}
+    for i, c := range src {
+        if c == '\n' { d.lines = append(d.lines, i+1) }
+    }
+    if bytes.Contains(src, []byte("\r\n")) { d.nl = "\r\n" }
+    if len(n.Content) > 0 { d.root = n.Content[0] }
+    if s := indentStep(d.root); s > 0 { d.step = s }
+    return d, nil
+}
+
+// indentStep returns the indentation of the first nested block mapping.
+func indentStep(n *yaml.Node) int {
+    if n == nil || n.Kind != yaml.MappingNode || n.Style&yaml.FlowStyle != 0 { return 0 }
+    for i := 0; i+1 < len(n.Content); i += 2 {
+        k, v := n.Content[i], n.Content[i+1]
+        if v.Kind == yaml.MappingNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 && v.Content[0].Column > k.Column {
+            return v.Content[0].Column - k.Column
+        }
+        if s := indentStep(v); s > 0 { return s }
+    }
+    return 0
+}
+
+// find resolves p as far as it exists: it returns the deepest existing node,
+// the mapping key it hangs off (nil for the root and sequence items) and the
+// number of segments matched.
+func (d *doc) find(p Path) (n, key *yaml.Node, depth int, err error) {
+    n = d.root
+    for i, seg := range p {
+        if n == nil { return nil, nil, i, nil }
+        switch n.Kind {
+        case yaml.AliasNode:
+            return nil, nil, i, fmt.Errorf("%s goes through an alias", p[:i])
+        case yaml.MappingNode:
+            var next *yaml.Node
+            for j := 0; j+1 < len(n.Content); j += 2 {
+                if n.Content[j].Value == seg { key, next = n.Content[j], n.Content[j+1]; break }
+            }
+            if next == nil { return n, key, i, nil }
+            n = next
+        case yaml.SequenceNode:
+            idx, err := strconv.Atoi(seg)
+            if err != nil || idx < 0 || idx >= len(n.Content) { return nil, nil, i, fmt.Errorf("%s has no item %q", p[:i], seg) }
+            n, key = n.Content[idx], nil
+        default:
+            return n, key, i, nil
+        }
+    }
+    if n != nil && n.Kind == yaml.AliasNode { return nil, nil, len(p), fmt.Errorf("%s is an alias", p) }
+    return n, key, len(p), nil
+}
+
+func (d *doc) apply(e Edit) ([]byte, error) {
+    n, key, depth, err := d.find(e.Path)
+    if err != nil { return nil, err }
+    if depth == len(e.Path) {
+        if n.Kind != yaml.ScalarNode { return nil, fmt.Errorf("not a scalar") }
+        if n.Tag != "!!null" && n.Value == e.Value { return d.src, nil }
+        if emptyNull(n) { return d.insertAfterKey(key, 0, 0, " "+render(e.Value, 0)) }
+        s, end, err := d.scalarSpan(n)
+        if err != nil { return nil, err }
+        return d.splice(s, end, render(e.Value, n.Style)), nil
+    }
+    rest := e.Path[depth:]
+    switch {
+    case n == nil: // empty document
+        at, pre := len(d.src), ""
+        if at > 0 && d.src[at-1] != '\n' { pre = d.nl }
+        return d.splice(at, at, pre+d.block(rest, 0, e.Value)), nil
+    case n.Kind == yaml.MappingNode && n.Style&yaml.FlowStyle == 0 && len(n.Content) > 0:
+        at, pre := d.entryEnd(n), ""
+        if at == len(d.src) && at > 0 && d.src[at-1] != '\n' { pre = d.nl }
+        return d.splice(at, at, pre+d.block(rest, n.Content[0].Column-1, e.Value)), nil
+    case key == nil:
+        return nil, fmt.Errorf("cannot add %s under %s", rest, e.Path[:depth])
+    case emptyNull(n):
+        return d.insertAfterKey(key, 0, 0, d.nested(rest, key, e.Value))
+    case n.Kind == yaml.ScalarNode && n.Tag == "!!null", n.Kind == yaml.MappingNode && len(n.Content) == 0:
+        // "key: ~" or "key: {}": drop the value and nest a block under key.
+        s, end, err := d.valueSpan(n)
+        if err != nil { return nil, err }
+        for s > 0 && (d.src[s-1] == ' ' || d.src[s-1] == '\t') { s-- }
+        return d.insertAfterKey(key, s, end, d.nested(rest, key, e.Value))
+    }
+    return nil, fmt.Errorf("cannot add %s under %s: not a block mapping", rest, e.Path[:depth])
+}
+
+// emptyNull reports whether n is an implicit null ("key:" with no value).
+func emptyNull(n *yaml.Node) bool {
+    return n.Kind == yaml.ScalarNode && n.Tag == "!!null" && n.Value == "" && n.Style == 0
+}
+
+func (d *doc) nested(rest Path, key *yaml.Node, value string) string {
+    return d.nl + strings.TrimSuffix(d.block(rest, key.Column-1+d.step, value), d.nl)
+}
+
+// insertAfterKey deletes [del, delEnd) on key's line and inserts text after
+// the key's colon, or at the end of the line when text starts a new line so
+// a trailing comment stays on the key.
+func (d *doc) insertAfterKey(key *yaml.Node, del, delEnd int, text string) ([]byte, error) {
+    _, end, err := d.scalarSpan(key)
+    if err != nil { return nil, err }
+    lineEnd := bytes.IndexByte(d.src[end:], '\n')
+    if lineEnd < 0 { lineEnd = len(d.src) } else { lineEnd += end }
+    if lineEnd > end && d.src[lineEnd-1] == '\r' { lineEnd-- }
+    at := lineEnd
+    if !strings.HasPrefix(text, d.nl) {
+        at = bytes.IndexByte(d.src[end:lineEnd], ':')
+        if at < 0 { return nil, fmt.Errorf("no ':' after key %q", key.Value) }
+        at += end + 1
+    }
+    if delEnd == 0 { return d.splice(at, at, text), nil }
+    var b bytes.Buffer
+    b.Write(d.src[:del]); b.Write(d.src[delEnd:at]); b.WriteString(text); b.Write(d.src[at:])
+    return b.Bytes(), nil
+}
+
+// entryEnd returns the offset just past the last entry of block mapping m:
+// the lines after its last key that are blank, indented deeper than the
+// mapping, or "- " items at its indentation.
+func (d *doc) entryEnd(m *yaml.Node) int {
+    ind := m.Content[0].Column - 1
+    last := m.Content[len(m.Content)-2].Line
+    for l := last + 1; l <= len(d.lines); l++ {
+        line := d.line(l)
+        t := strings.TrimLeft(line, " ")
+        if strings.TrimSpace(t) == "" { continue }
+        lead := len(line) - len(t)
+        if lead > ind || lead == ind && (t == "-" || strings.HasPrefix(t, "- ")) { last = l; continue }
+        break
+    }
+    if last >= len(d.lines) { return len(d.src) }
+    return d.lines[last]
+}
+
+func (d *doc) line(l int) string {
+    s, e := d.lines[l-1], len(d.src)
+    if l < len(d.lines) { e = d.lines[l] }
+    return strings.TrimRight(string(d.src[s:e]), "\r\n")
+}
+
+// offset converts a yaml.v3 position (1-based line, column in runes).
+func (d *doc) offset(line, col int) int {
+    o := d.lines[line-1]
+    for ; col > 1 && o < len(d.src); col-- {
+        _, w := utf8.DecodeRune(d.src[o:])
+        o += w
+    }
+    return o
+}
+
+// scalarSpan returns the byte range of a single-line scalar as written.
+func (d *doc) scalarSpan(n *yaml.Node) (int, int, error) {
+    s := d.offset(n.Line, n.Column)
+    switch {
+    case n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+        return 0, 0, fmt.Errorf("block scalar at line %d is not supported", n.Line)
+    case n.Style&yaml.DoubleQuotedStyle != 0:
+        for i := s + 1; i < len(d.src) && d.src[i] != '\n'; i++ {
+            if d.src[i] == '\\' { i++; continue }
+            if d.src[i] == '"' { return s, i + 1, nil }
+        }
+    case n.Style&yaml.SingleQuotedStyle != 0:
+        for i := s + 1; i < len(d.src) && d.src[i] != '\n'; i++ {
+            if d.src[i] != '\'' { continue }
+            if i+1 < len(d.src) && d.src[i+1] == '\'' { i++; continue }
+            return s, i + 1, nil
+        }
+    default:
+        if e := s + len(n.Value); e <= len(d.src) && string(d.src[s:e]) == n.Value { return s, e, nil }
+    }
+    return 0, 0, fmt.Errorf("scalar at line %d spans lines or is tagged; not supported", n.Line)
+}
+
+// valueSpan is scalarSpan extended to an empty flow mapping ("{}").
+func (d *doc) valueSpan(n *yaml.Node) (int, int, error) {
+    if n.Kind == yaml.ScalarNode { return d.scalarSpan(n) }
+    s := d.offset(n.Line, n.Column)
+    if e := bytes.IndexByte(d.src[s:], '}'); s < len(d.src) && d.src[s] == '{' && e > 0 { return s, s + e + 1, nil }
+    return 0, 0, fmt.Errorf("mapping at line %d is not supported", n.Line)
+}
+
+func (d *doc) splice(s, e int, text string) []byte {
+    var b bytes.Buffer
+    b.Grow(len(d.src) + len(text))
+    b.Write(d.src[:s]); b.WriteString(text); b.Write(d.src[e:])
+    return b.Bytes()
+}
+
+// block renders rest as nested keys at indentation ind, ending in value.
+func (d *doc) block(rest Path, ind int, value string) string {
+    var b strings.Builder
+    for i, seg := range rest {
+        b.WriteString(strings.Repeat(" ", ind+i*d.step) + render(seg, 0) + ":")
+        if i == len(rest)-1 { b.WriteString(" " + render(value, 0)) }
+        b.WriteString(d.nl)
+    }
+    return b.String()
+}
+
+var plainSafe = regexp.MustCompile(`^[A-Za-z0-9_/][A-Za-z0-9._/+-]*$`)
+
+// render writes v in the given scalar style; plain values that YAML would
+// read as something else are double-quoted.
+func render(v string, style yaml.Style) string {
+    switch {
+    case style&yaml.SingleQuotedStyle != 0:
+        return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+    case style&yaml.DoubleQuotedStyle == 0 && plainSafe.MatchString(v) && !reserved[strings.ToLower(v)]:
+        return v
+    }
+    return strconv.Quote(v)
+}
+
+var reserved = map[string]bool{"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true, "null": true}
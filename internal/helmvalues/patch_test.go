@@ -0,0 +1,139 @@
+package helmvalues
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestPatch(t *testing.T) {
+    tests := []struct {
+        name  string
+        src   string
+        path  string
+        value string
+        want  string
+        err   string
+    }{
+        {name: "plain scalar keeps comment",
+            src: "api:\n  memory: 256Mi # limit\n", path: "api.memory", value: "320Mi",
+            want: "api:\n  memory: 320Mi # limit\n"},
+        {name: "double quotes kept",
+            src: "api:\n  memory: \"256Mi\"\n", path: "api.memory", value: "320Mi",
+            want: "api:\n  memory: \"320Mi\"\n"},
+        {name: "single quotes kept and escaped",
+            src: "api:\n  note: 'old'\n", path: "api.note", value: "it's",
+            want: "api:\n  note: 'it''s'\n"},
+        {name: "unchanged value",
+            src: "api:\n  memory: 256Mi   # keep\n", path: "api.memory", value: "256Mi",
+            want: "api:\n  memory: 256Mi   # keep\n"},
+        {name: "reserved word quoted",
+            src: "api:\n  enabled: x\n", path: "api.enabled", value: "true",
+            want: "api:\n  enabled: \"true\"\n"},
+        {name: "value with spaces quoted",
+            src: "api:\n  x: 1\n", path: "api.tag", value: "a b",
+            want: "api:\n  x: 1\n  tag: \"a b\"\n"},
+        {name: "reserved key quoted",
+            src: "api:\n  x: 1\n", path: "api.y", value: "1",
+            want: "api:\n  x: 1\n  \"y\": 1\n"},
+        {name: "missing keys use the file's indentation",
+            src: "# values\napi:\n    image: nginx\n    resources:\n        limits:\n            cpu: 1\nweb:\n    image: httpd\n", path: "api.resources.limits.memory", value: "1Gi",
+            want: "# values\napi:\n    image: nginx\n    resources:\n        limits:\n            cpu: 1\n            memory: 1Gi\nweb:\n    image: httpd\n"},
+        {name: "missing block nested under existing mapping",
+            src: "api:\n  image: nginx\n\n# web tier\nweb: {}\n", path: "api.resources.limits.memory", value: "1Gi",
+            want: "api:\n  image: nginx\n  resources:\n    limits:\n      memory: 1Gi\n\n# web tier\nweb: {}\n"},
+        {name: "empty key keeps its comment",
+            src: "api:\n  resources: # set by auto-agent\nweb:\n  x: 1\n", path: "api.resources.limits.memory", value: "1Gi",
+            want: "api:\n  resources: # set by auto-agent\n    limits:\n      memory: 1Gi\nweb:\n  x: 1\n"},
+        {name: "empty leaf gets a value",
+            src: "api:\n  memory:\n  cpu: 1\n", path: "api.memory", value: "1Gi",
+            want: "api:\n  memory: 1Gi\n  cpu: 1\n"},
+        {name: "empty flow mapping replaced",
+            src: "api:\n  resources: {}  # none yet\n  image: nginx\n", path: "api.resources.limits.memory", value: "1Gi",
+            want: "api:\n  resources:  # none yet\n    limits:\n      memory: 1Gi\n  image: nginx\n"},
+        {name: "explicit null replaced",
+            src: "api:\n  resources: ~\n", path: "api.resources.requests.cpu", value: "500m",
+            want: "api:\n  resources:\n    requests:\n      cpu: 500m\n"},
+        {name: "sequence item",
+            src: "containers:\n  - name: app\n    memory: 1Gi\n  - name: sidecar\n    memory: 64Mi\n", path: "containers.1.memory", value: "128Mi",
+            want: "containers:\n  - name: app\n    memory: 1Gi\n  - name: sidecar\n    memory: 128Mi\n"},
+        {name: "key added after a sequence at the same indentation",
+            src: "api:\n  tolerations:\n  - key: a\n  - key: b\nweb:\n  x: 1\n", path: "api.replicaCount", value: "3",
+            want: "api:\n  tolerations:\n  - key: a\n  - key: b\n  replicaCount: 3\nweb:\n  x: 1\n"},
+        {name: "dotted key",
+            src: "podAnnotations:\n  a: b\n", path: `podAnnotations.auto-agent\.io/owner`, value: "team",
+            want: "podAnnotations:\n  a: b\n  auto-agent.io/owner: team\n"},
+        {name: "no trailing newline",
+            src: "api:\n  x: 1", path: "api.tag", value: "2",
+            want: "api:\n  x: 1\n  tag: 2\n"},
+        {name: "CRLF preserved",
+            src: "api:\r\n  x: 1\r\n", path: "api.resources.cpu", value: "1",
+            want: "api:\r\n  x: 1\r\n  resources:\r\n    cpu: 1\r\n"},
+        {name: "empty document",
+            src: "", path: "api.replicaCount", value: "2",
+            want: "api:\n  replicaCount: 2\n"},
+        {name: "multibyte before the value",
+            src: "api:\n  ünïcode: 1\n  memory: 1Gi\n", path: "api.memory", value: "2Gi",
+            want: "api:\n  ünïcode: 1\n  memory: 2Gi\n"},
+        {name: "sequence index out of range",
+            src: "containers:\n  - name: app\n", path: "containers.3.memory", value: "1Gi", err: "has no item"},
+        {name: "block scalar refused",
+            src: "api:\n  script: |\n    echo hi\n", path: "api.script", value: "x", err: "block scalar"},
+        {name: "flow mapping with content refused",
+            src: "api:\n  resources: {limits: {cpu: 1}}\n", path: "api.resources.limits.memory", value: "1Gi", err: "not a block mapping"},
+        {name: "alias refused",
+            src: "base: &b\n  memory: 1Gi\napi: *b\n", path: "api.memory", value: "2Gi", err: "alias"},
+        {name: "mapping is not a scalar",
+            src: "api:\n  resources:\n    cpu: 1\n", path: "api.resources", value: "1", err: "not a scalar"},
+        {name: "invalid YAML",
+            src: "api: [\n", path: "api.x", value: "1", err: "values:"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := Patch([]byte(tt.src), Edit{Path: ParsePath(tt.path), Value: tt.value})
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) { t.Fatalf("err = %v, want %q", err, tt.err) }
+                return
+            }
+            if err != nil { t.Fatal(err) }
+            if string(got) != tt.want { t.Errorf("got:\n%s\nwant:\n%s", got, tt.want) }
+            if v, ok, err := Lookup(got, ParsePath(tt.path)); err != nil || !ok || v != tt.value { t.Errorf("Lookup after Patch = %q, %t, %v", v, ok, err) }
+        })
+    }
+}
+
+func TestPatchSeveralEdits(t *testing.T) {
+    src := "api:\n  resources: {}\n"
+    got, err := Patch([]byte(src),
+        Edit{Path: ParsePath("api.resources.limits.memory"), Value: "1Gi"},
+        Edit{Path: ParsePath("api.resources.requests.memory"), Value: "512Mi"},
+        Edit{Path: ParsePath("api.resources.limits.cpu"), Value: "1"})
+    if err != nil { t.Fatal(err) }
+    want := "api:\n  resources:\n    limits:\n      memory: 1Gi\n      cpu: 1\n    requests:\n      memory: 512Mi\n"
+    if string(got) != want { t.Errorf("got:\n%s\nwant:\n%s", got, want) }
+}
+
+func TestLookup(t *testing.T) {
+    src := []byte("api:\n  memory: \"1Gi\"\n  cpu: ~\n  resources: {}\n")
+    tests := []struct {
+        path  string
+        want  string
+        ok    bool
+        isErr bool
+    }{
+        {path: "api.memory", want: "1Gi", ok: true},
+        {path: "api.cpu"},
+        {path: "api.missing"},
+        {path: "api.resources.limits"},
+        {path: "api", isErr: true},
+    }
+    for _, tt := range tests {
+        v, ok, err := Lookup(src, ParsePath(tt.path))
+        if (err != nil) != tt.isErr || ok != tt.ok || v != tt.want { t.Errorf("Lookup(%s) = %q, %t, %v", tt.path, v, ok, err) }
+    }
+}
+
+func TestParsePath(t *testing.T) {
+    p := ParsePath(`a.b\.c.0`)
+    if len(p) != 3 || p[1] != "b.c" || p[2] != "0" { t.Fatalf("ParsePath = %q", p) }
+    if p.String() != `a.b\.c.0` { t.Errorf("String() = %s", p) }
+}
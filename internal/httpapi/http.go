@@ -1,13 +1,202 @@
 package httpapi
 
 import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "io"
     "net/http"
+    "strings"
+    "time"
+
     "github.com/prometheus/client_golang/prometheus/promhttp"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/slack"
 )
 
-func Serve(addr string) {
+// Config wires optional endpoints. A nil Approvals disables /approvals, a nil
+// Changes disables /changes, an empty SlackSigningSecret disables
+// /slack/interactions. /approvals and /changes act on workloads, so they are
+// only served with an ApprovalToken.
+type Config struct {
+    Approvals     *approval.Queue
+    ApprovalToken string                 // bearer token required by /approvals and /changes
+    OnDecision    func(*approval.Action) // called after an approve/reject/snooze
+
+    Changes *changes.Ledger
+    Revert  func(ctx context.Context, id, by string) (*changes.Change, error)
+
+    Slack              *slack.Client
+    SlackSigningSecret string
+    SnoozeFor          time.Duration
+}
+
+func Serve(addr string, cfg Config) {
+    go http.ListenAndServe(addr, Handler(cfg))
+}
+
+// Handler returns the mux Serve listens with.
+func Handler(cfg Config) http.Handler {
     mux := http.NewServeMux()
     mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request){ w.Write([]byte("ok")) })
     mux.Handle("/metrics", promhttp.Handler())
-    go http.ListenAndServe(addr, mux)
+    if cfg.ApprovalToken == "" && (cfg.Approvals != nil || cfg.Changes != nil) {
+        klog.Warning("httpapi: APPROVALS_TOKEN is not set; /approvals and /changes are disabled")
+    }
+    if cfg.Approvals != nil {
+        a := &approvals{cfg: cfg}
+        if cfg.ApprovalToken != "" {
+            mux.HandleFunc("GET /approvals", a.auth(a.list))
+            mux.HandleFunc("GET /approvals/{id}", a.auth(a.get))
+            mux.HandleFunc("POST /approvals/{id}/approve", a.auth(a.decide(true)))
+            mux.HandleFunc("POST /approvals/{id}/reject", a.auth(a.decide(false)))
+        }
+        if cfg.SlackSigningSecret != "" {
+            mux.HandleFunc("POST /slack/interactions", a.slackInteraction)
+        }
+    }
+    if cfg.Changes != nil && cfg.Revert != nil && cfg.ApprovalToken != "" {
+        c := &approvals{cfg: cfg}
+        mux.HandleFunc("GET /changes", c.auth(c.listChanges))
+        mux.HandleFunc("GET /changes/{id}", c.auth(c.getChange))
+        mux.HandleFunc("POST /changes/{id}/revert", c.auth(c.revert))
+    }
+    return mux
+}
+
+type approvals struct{ cfg Config }
+
+func (a *approvals) auth(h http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if a.cfg.ApprovalToken == "" || subtle.ConstantTimeCompare([]byte(got), []byte(a.cfg.ApprovalToken)) != 1 {
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+        h(w, r)
+    }
+}
+
+func (a *approvals) list(w http.ResponseWriter, r *http.Request) {
+    all, err := a.cfg.Approvals.List(r.Context())
+    if err != nil { writeErr(w, err); return }
+    if st := r.URL.Query().Get("state"); st != "" {
+        out := all[:0]
+        for _, x := range all { if string(x.State) == st { out = append(out, x) } }
+        all = out
+    }
+    writeJSON(w, http.StatusOK, all)
+}
+
+func (a *approvals) get(w http.ResponseWriter, r *http.Request) {
+    x, err := a.cfg.Approvals.Get(r.Context(), r.PathValue("id"))
+    if err != nil { writeErr(w, err); return }
+    writeJSON(w, http.StatusOK, x)
+}
+
+// decide accepts an optional JSON body {"by": "..."} naming the approver;
+// otherwise the X-Remote-User header or "api" is recorded.
+func (a *approvals) decide(approve bool) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var body struct{ By string `json:"by"` }
+        _ = json.NewDecoder(r.Body).Decode(&body)
+        by := body.By
+        if by == "" { by = r.Header.Get("X-Remote-User") }
+        if by == "" { by = "api" }
+        x, err := a.cfg.Approvals.Decide(r.Context(), r.PathValue("id"), approve, by)
+        if err != nil { writeErr(w, err); return }
+        if a.cfg.OnDecision != nil { a.cfg.OnDecision(x) }
+        writeJSON(w, http.StatusOK, x)
+    }
+}
+
+func (a *approvals) listChanges(w http.ResponseWriter, r *http.Request) {
+    all, err := a.cfg.Changes.List(r.Context())
+    if err != nil { writeErr(w, err); return }
+    if st := r.URL.Query().Get("state"); st != "" {
+        out := all[:0]
+        for _, x := range all { if string(x.State) == st { out = append(out, x) } }
+        all = out
+    }
+    writeJSON(w, http.StatusOK, all)
+}
+
+func (a *approvals) getChange(w http.ResponseWriter, r *http.Request) {
+    x, err := a.cfg.Changes.Get(r.Context(), r.PathValue("id"))
+    if err != nil { writeErr(w, err); return }
+    writeJSON(w, http.StatusOK, x)
+}
+
+// revert takes the same optional {"by": "..."} body as decide.
+func (a *approvals) revert(w http.ResponseWriter, r *http.Request) {
+    var body struct{ By string `json:"by"` }
+    _ = json.NewDecoder(r.Body).Decode(&body)
+    by := body.By
+    if by == "" { by = r.Header.Get("X-Remote-User") }
+    if by == "" { by = "api" }
+    x, err := a.cfg.Revert(r.Context(), r.PathValue("id"), by)
+    if err != nil { writeErr(w, err); return }
+    writeJSON(w, http.StatusOK, x)
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+    code := http.StatusInternalServerError
+    switch {
+    case errors.Is(err, approval.ErrNotFound), errors.Is(err, changes.ErrNotFound):
+        code = http.StatusNotFound
+    case errors.Is(err, approval.ErrNotPending), errors.Is(err, changes.ErrNotApplied):
+        code = http.StatusConflict
+    }
+    http.Error(w, err.Error(), code)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    _ = json.NewEncoder(w).Encode(v)
+}
+
+// slackInteraction handles Block Kit button clicks. The request must carry a
+// valid Slack signature; the clicked button's value is the pending action ID.
+func (a *approvals) slackInteraction(w http.ResponseWriter, r *http.Request) {
+    body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+    if err != nil { http.Error(w, "read body", http.StatusBadRequest); return }
+    if err := slack.VerifySignature(a.cfg.SlackSigningSecret, r.Header.Get("X-Slack-Request-Timestamp"), r.Header.Get("X-Slack-Signature"), body, time.Now()); err != nil {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    in, err := slack.ParseInteraction(body)
+    if err != nil || len(in.Actions) == 0 { http.Error(w, "bad payload", http.StatusBadRequest); return }
+
+    ctx, act := r.Context(), in.Actions[0]
+    id := act.Value
+    if in.ResponseURL != "" {
+        _, _ = a.cfg.Approvals.SetMeta(ctx, id, approval.MetaSlackResponseURL, in.ResponseURL)
+    }
+    var x *approval.Action
+    switch act.ActionID {
+    case slack.ActionApprove:
+        x, err = a.cfg.Approvals.Decide(ctx, id, true, in.Who())
+    case slack.ActionReject:
+        x, err = a.cfg.Approvals.Decide(ctx, id, false, in.Who())
+    case slack.ActionSnooze:
+        d := a.cfg.SnoozeFor
+        if d <= 0 { d = time.Hour }
+        x, err = a.cfg.Approvals.Snooze(ctx, id, d, in.Who())
+    default:
+        err = errors.New("unknown action " + act.ActionID)
+    }
+    if err != nil {
+        if a.cfg.Slack != nil && in.ResponseURL != "" {
+            _ = a.cfg.Slack.Respond(in.ResponseURL, slack.Message{Text: "Action `" + id + "`: " + err.Error()})
+        }
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if a.cfg.OnDecision != nil { a.cfg.OnDecision(x) }
+    w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "k8s.io/client-go/kubernetes/fake"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
+)
+
+const token = "s3cret"
+
+func newServer(t *testing.T) (*httptest.Server, *approval.Queue, *changes.Ledger) {
+    kc := fake.NewSimpleClientset()
+    q := approval.NewQueue(kc, "ops", time.Hour)
+    l := changes.NewLedger(kc, "ops", time.Hour)
+    srv := httptest.NewServer(Handler(Config{
+        Approvals: q, ApprovalToken: token,
+        Changes: l,
+        Revert: func(ctx context.Context, id, by string) (*changes.Change, error) {
+            return l.Revert(ctx, id, by, func(context.Context, *changes.Change) error { return nil })
+        },
+    }))
+    t.Cleanup(srv.Close)
+    return srv, q, l
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, auth string) *http.Response {
+    t.Helper()
+    req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(`{"by":"alice"}`))
+    if err != nil { t.Fatal(err) }
+    if auth != "" { req.Header.Set("Authorization", auth) }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil { t.Fatal(err) }
+    t.Cleanup(func() { resp.Body.Close() })
+    return resp
+}
+
+func TestBearerAuth(t *testing.T) {
+    srv, _, _ := newServer(t)
+    for _, tc := range []struct {
+        name, auth string
+        want       int
+    }{
+        {"no header", "", http.StatusUnauthorized},
+        {"wrong token", "Bearer nope", http.StatusUnauthorized},
+        {"token prefix", "Bearer s3cre", http.StatusUnauthorized},
+        {"valid", "Bearer " + token, http.StatusOK},
+    } {
+        for _, path := range []string{"/approvals", "/changes"} {
+            if resp := do(t, srv, "GET", path, tc.auth); resp.StatusCode != tc.want {
+                t.Errorf("%s: GET %s = %d, want %d", tc.name, path, resp.StatusCode, tc.want)
+            }
+        }
+    }
+    if resp := do(t, srv, "GET", "/healthz", ""); resp.StatusCode != http.StatusOK { t.Errorf("/healthz = %d, want 200 without a token", resp.StatusCode) }
+}
+
+func TestUnauthenticatedEndpointsNeedAToken(t *testing.T) {
+    srv := httptest.NewServer(Handler(Config{Approvals: approval.NewQueue(fake.NewSimpleClientset(), "ops", time.Hour)}))
+    defer srv.Close()
+    if resp := do(t, srv, "GET", "/approvals", ""); resp.StatusCode != http.StatusNotFound { t.Fatalf("GET /approvals without APPROVALS_TOKEN = %d, want 404", resp.StatusCode) }
+}
+
+func TestErrorMapping(t *testing.T) {
+    ctx := context.Background()
+    srv, q, l := newServer(t)
+    a, _, err := q.Propose(ctx, approval.Action{Kind: approval.Scale, Namespace: "a", Target: "deployment/api"})
+    if err != nil { t.Fatal(err) }
+    c, err := l.Record(ctx, changes.Change{Namespace: "a", Kind: "Deployment", Name: "api"})
+    if err != nil { t.Fatal(err) }
+    auth := "Bearer " + token
+
+    for _, tc := range []struct {
+        name, method, path string
+        want               int
+    }{
+        {"unknown action", "GET", "/approvals/missing", http.StatusNotFound},
+        {"approve unknown", "POST", "/approvals/missing/approve", http.StatusNotFound},
+        {"approve", "POST", "/approvals/" + a.ID + "/approve", http.StatusOK},
+        {"decide twice", "POST", "/approvals/" + a.ID + "/reject", http.StatusConflict},
+        {"unknown change", "GET", "/changes/missing", http.StatusNotFound},
+        {"revert unknown", "POST", "/changes/missing/revert", http.StatusNotFound},
+        {"revert", "POST", "/changes/" + c.ID + "/revert", http.StatusOK},
+        {"revert twice", "POST", "/changes/" + c.ID + "/revert", http.StatusConflict},
+    } {
+        if resp := do(t, srv, tc.method, tc.path, auth); resp.StatusCode != tc.want {
+            t.Errorf("%s: %s %s = %d, want %d", tc.name, tc.method, tc.path, resp.StatusCode, tc.want)
+        }
+    }
+
+    resp := do(t, srv, "GET", "/approvals/"+a.ID, auth)
+    var x approval.Action
+    if err := json.NewDecoder(resp.Body).Decode(&x); err != nil { t.Fatal(err) }
+    if x.State != approval.Approved || x.DecidedBy != "alice" { t.Fatalf("action %s by %q, want approved by alice", x.State, x.DecidedBy) }
+}
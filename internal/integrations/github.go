@@ -0,0 +1,146 @@
+package integrations
+
+import (
+    "context"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+
+    "k8s.io/klog/v2"
+)
+
+// githubClient opens pull requests through the GitHub REST API. The API base
+// defaults to api.github.com; set GITHUB_API_URL for GitHub Enterprise
+// (https://ghe.example.com/api/v3).
+type githubClient struct {
+    token, repo, base, api string
+}
+
+func NewGitHub(token, repo, base string) GitOps {
+    api := os.Getenv("GITHUB_API_URL")
+    if api == "" { api = "https://api.github.com" }
+    return &githubClient{token: token, repo: repo, base: base, api: strings.TrimRight(api, "/")}
+}
+
+type ghPull struct {
+    Number  int    `json:"number"`
+    HTMLURL string `json:"html_url"`
+}
+
+// OpenPR commits ch.Content to ch.FilePath on the change's branch and opens a
+// pull request against the base branch. If a PR from that branch is already
+// open, the file is committed on top of it and its title and body are
+// updated instead, so repeated detections update one PR.
+func (g *githubClient) OpenPR(ctx context.Context, ch GitOpsChange) (string, error) {
+    branch := ch.Branch
+    if branch == "" { branch = BranchFor(ch.Key) }
+    if branch == "auto-agent/" { return "", fmt.Errorf("github: change needs a Branch or Key") }
+    msg := ch.CommitMessage
+    if msg == "" { msg = ch.Title }
+
+    existing, err := g.openPR(ctx, branch)
+    if err != nil { return "", err }
+    if existing == nil {
+        if cur, err := g.ReadFile(ctx, ch.FilePath); err == nil && string(cur) == string(ch.Content) { return "", ErrNoChange }
+        if err := g.resetBranch(ctx, branch); err != nil { return "", err }
+    }
+    if err := g.putFile(ctx, branch, ch.FilePath, ch.Content, msg); err != nil { return "", err }
+
+    pr := existing
+    if pr == nil {
+        pr = &ghPull{}
+        in := map[string]interface{}{"title": ch.Title, "body": ch.Body, "head": branch, "base": g.base}
+        if err := g.call(ctx, "POST", g.repoURL("/pulls"), in, pr); err != nil { return "", fmt.Errorf("github: create PR: %w", err) }
+    } else {
+        in := map[string]interface{}{"title": ch.Title, "body": ch.Body}
+        if err := g.call(ctx, "PATCH", g.repoURL(fmt.Sprintf("/pulls/%d", pr.Number)), in, nil); err != nil { return "", fmt.Errorf("github: update PR #%d: %w", pr.Number, err) }
+    }
+    // Labels, assignees and reviewers are best effort: the PR exists either way.
+    if len(ch.Labels) > 0 {
+        if err := g.call(ctx, "POST", g.repoURL(fmt.Sprintf("/issues/%d/labels", pr.Number)), map[string]interface{}{"labels": ch.Labels}, nil); err != nil {
+            klog.Warningf("github: label PR #%d: %v", pr.Number, err)
+        }
+    }
+    if len(ch.Assignees) > 0 {
+        if err := g.call(ctx, "POST", g.repoURL(fmt.Sprintf("/issues/%d/assignees", pr.Number)), map[string]interface{}{"assignees": ch.Assignees}, nil); err != nil {
+            klog.Warningf("github: assign PR #%d: %v", pr.Number, err)
+        }
+    }
+    if len(ch.Reviewers) > 0 && existing == nil {
+        if err := g.call(ctx, "POST", g.repoURL(fmt.Sprintf("/pulls/%d/requested_reviewers", pr.Number)), map[string]interface{}{"reviewers": ch.Reviewers}, nil); err != nil {
+            klog.Warningf("github: request reviewers on PR #%d: %v", pr.Number, err)
+        }
+    }
+    return pr.HTMLURL, nil
+}
+
+// openPR returns the open PR whose head is branch, if any.
+func (g *githubClient) openPR(ctx context.Context, branch string) (*ghPull, error) {
+    owner, _, _ := strings.Cut(g.repo, "/")
+    q := url.Values{"state": {"open"}, "head": {owner + ":" + branch}, "base": {g.base}}
+    var prs []ghPull
+    if err := g.call(ctx, "GET", g.repoURL("/pulls?"+q.Encode()), nil, &prs); err != nil { return nil, fmt.Errorf("github: list PRs: %w", err) }
+    if len(prs) == 0 { return nil, nil }
+    return &prs[0], nil
+}
+
+// resetBranch points branch at the current base head, creating it if needed.
+// A leftover branch without an open PR (e.g. a closed one) is reset rather
+// than reused, so the new PR only carries this change.
+func (g *githubClient) resetBranch(ctx context.Context, branch string) error {
+    var ref struct{ Object struct{ SHA string `json:"sha"` } `json:"object"` }
+    if err := g.call(ctx, "GET", g.repoURL("/git/ref/heads/"+g.base), nil, &ref); err != nil { return fmt.Errorf("github: read base %s: %w", g.base, err) }
+    sha := ref.Object.SHA
+    err := g.call(ctx, "POST", g.repoURL("/git/refs"), map[string]interface{}{"ref": "refs/heads/" + branch, "sha": sha}, nil)
+    if IsStatus(err, http.StatusUnprocessableEntity) { // already exists
+        err = g.call(ctx, "PATCH", g.repoURL("/git/refs/heads/"+branch), map[string]interface{}{"sha": sha, "force": true}, nil)
+    }
+    if err != nil { return fmt.Errorf("github: create branch %s: %w", branch, err) }
+    return nil
+}
+
+// putFile commits content to path on branch via the contents API. Unchanged
+// content is not committed again.
+func (g *githubClient) putFile(ctx context.Context, branch, path string, content []byte, msg string) error {
+    u := g.repoURL("/contents/" + escapePath(path))
+    var cur struct {
+        SHA     string `json:"sha"`
+        Content string `json:"content"`
+    }
+    err := g.call(ctx, "GET", u+"?ref="+url.QueryEscape(branch), nil, &cur)
+    if err != nil && !IsStatus(err, http.StatusNotFound) { return fmt.Errorf("github: read %s: %w", path, err) }
+    if cur.SHA != "" {
+        if old, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(cur.Content, "\n", "")); err == nil && string(old) == string(content) { return nil }
+    }
+    in := map[string]interface{}{"message": msg, "content": base64.StdEncoding.EncodeToString(content), "branch": branch}
+    if cur.SHA != "" { in["sha"] = cur.SHA }
+    if err := g.call(ctx, "PUT", u, in, nil); err != nil { return fmt.Errorf("github: commit %s: %w", path, err) }
+    return nil
+}
+
+// ReadFile returns the content of path on the base branch.
+func (g *githubClient) ReadFile(ctx context.Context, path string) ([]byte, error) {
+    var cur struct{ Content string `json:"content"` }
+    if err := g.call(ctx, "GET", g.repoURL("/contents/"+escapePath(path))+"?ref="+url.QueryEscape(g.base), nil, &cur); err != nil { return nil, fmt.Errorf("github: read %s: %w", path, err) }
+    return base64.StdEncoding.DecodeString(strings.ReplaceAll(cur.Content, "\n", ""))
+}
+
+func (g *githubClient) repoURL(p string) string { return g.api + "/repos/" + g.repo + p }
+
+func (g *githubClient) call(ctx context.Context, method, u string, in, out interface{}) error {
+    hdr := http.Header{}
+    hdr.Set("Authorization", "Bearer "+g.token)
+    hdr.Set("Accept", "application/vnd.github+json")
+    hdr.Set("X-GitHub-Api-Version", "2022-11-28")
+    return doJSON(ctx, method, u, hdr, in, out)
+}
+
+// escapePath escapes each segment of a repository file path.
+func escapePath(p string) string {
+    seg := strings.Split(strings.TrimLeft(p, "/"), "/")
+    for i := range seg { seg[i] = url.PathEscape(seg[i]) }
+    return strings.Join(seg, "/")
+}
@@ -0,0 +1,257 @@
+package integrations
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// fakeGitHub is an in-memory stand-in for the parts of the GitHub REST API
+// used by githubClient and githubIssues, for repository o/r.
+type fakeGitHub struct {
+    mu       sync.Mutex
+    files    map[string]map[string]string // branch → path → content
+    pulls    []*fakePull
+    issues   []*fakeIssue
+    calls    []string // "METHOD /path" of every request
+    badUsers map[string]bool // assignees GitHub rejects with 422
+}
+
+type fakePull struct {
+    Number                  int
+    Head, Base, Title, Body string
+    Labels, Assignees       []string
+    Reviewers               []string
+}
+
+type fakeIssue struct {
+    Number           int
+    Title, Body      string
+    State, Reason    string
+    Labels, Assignees []string
+    Comments         []string
+    PullRequest      bool
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, string) {
+    f := &fakeGitHub{files: map[string]map[string]string{"main": {}}, badUsers: map[string]bool{}}
+    srv := httptest.NewServer(f)
+    t.Cleanup(srv.Close)
+    return f, srv.URL
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    f.mu.Lock(); defer f.mu.Unlock()
+    f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+    if r.Header.Get("Authorization") != "Bearer tok" { http.Error(w, "bad credentials", http.StatusUnauthorized); return }
+    p := strings.TrimPrefix(r.URL.Path, "/repos/o/r")
+    var in map[string]interface{}
+    _ = json.NewDecoder(r.Body).Decode(&in)
+    reply := func(v interface{}) { _ = json.NewEncoder(w).Encode(v) }
+    seg := strings.Split(strings.Trim(p, "/"), "/")
+    num := 0
+    if len(seg) > 1 { num, _ = strconv.Atoi(seg[1]) }
+
+    switch {
+    case p == "/pulls" && r.Method == "GET":
+        head := r.URL.Query().Get("head")
+        out := []map[string]interface{}{}
+        for _, pr := range f.pulls {
+            if "o:"+pr.Head == head && pr.Base == r.URL.Query().Get("base") { out = append(out, f.pullJSON(pr)) }
+        }
+        reply(out)
+    case p == "/pulls" && r.Method == "POST":
+        pr := &fakePull{Number: f.next(), Head: str(in["head"]), Base: str(in["base"]), Title: str(in["title"]), Body: str(in["body"])}
+        f.pulls = append(f.pulls, pr)
+        reply(f.pullJSON(pr))
+    case seg[0] == "pulls" && len(seg) == 2 && r.Method == "PATCH":
+        pr := f.pull(num)
+        pr.Title, pr.Body = str(in["title"]), str(in["body"])
+        reply(f.pullJSON(pr))
+    case seg[0] == "pulls" && len(seg) == 3 && seg[2] == "requested_reviewers":
+        pr := f.pull(num)
+        pr.Reviewers = append(pr.Reviewers, strs(in["reviewers"])...)
+        reply(f.pullJSON(pr))
+    case strings.HasPrefix(p, "/git/ref/heads/"):
+        b := strings.TrimPrefix(p, "/git/ref/heads/")
+        if f.files[b] == nil { http.NotFound(w, r); return }
+        reply(map[string]interface{}{"object": map[string]string{"sha": "sha-" + b}})
+    case p == "/git/refs" && r.Method == "POST":
+        b := strings.TrimPrefix(str(in["ref"]), "refs/heads/")
+        if f.files[b] != nil { http.Error(w, `{"message":"Reference already exists"}`, http.StatusUnprocessableEntity); return }
+        f.files[b] = copyFiles(f.files["main"])
+        reply(map[string]string{})
+    case strings.HasPrefix(p, "/git/refs/heads/") && r.Method == "PATCH":
+        f.files[strings.TrimPrefix(p, "/git/refs/heads/")] = copyFiles(f.files["main"])
+        reply(map[string]string{})
+    case strings.HasPrefix(p, "/contents/"):
+        path := strings.TrimPrefix(p, "/contents/")
+        if r.Method == "GET" {
+            c, ok := f.files[r.URL.Query().Get("ref")][path]
+            if !ok { http.NotFound(w, r); return }
+            reply(map[string]string{"sha": "blob", "content": base64.StdEncoding.EncodeToString([]byte(c))})
+            return
+        }
+        files := f.files[str(in["branch"])]
+        if _, ok := files[path]; ok && in["sha"] != "blob" { http.Error(w, "sha mismatch", http.StatusConflict); return }
+        b, _ := base64.StdEncoding.DecodeString(str(in["content"]))
+        files[path] = string(b)
+        reply(map[string]string{})
+    case seg[0] == "issues" && len(seg) == 3 && seg[2] == "labels":
+        f.pull(num).Labels = append(f.pull(num).Labels, strs(in["labels"])...)
+        reply([]string{})
+    case seg[0] == "issues" && len(seg) == 3 && seg[2] == "assignees":
+        f.pull(num).Assignees = append(f.pull(num).Assignees, strs(in["assignees"])...)
+        reply(map[string]string{})
+    case p == "/issues" && r.Method == "GET":
+        out := []map[string]interface{}{}
+        for i := len(f.issues) - 1; i >= 0; i-- {
+            if iss := f.issues[i]; iss.State == "open" && hasLabels(iss.Labels, r.URL.Query().Get("labels")) { out = append(out, issueJSON(iss)) }
+        }
+        reply(out)
+    case p == "/issues" && r.Method == "POST":
+        for _, a := range strs(in["assignees"]) {
+            if f.badUsers[a] { http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity); return }
+        }
+        iss := &fakeIssue{Number: f.next(), Title: str(in["title"]), Body: str(in["body"]), State: "open", Labels: strs(in["labels"]), Assignees: strs(in["assignees"])}
+        f.issues = append(f.issues, iss)
+        reply(issueJSON(iss))
+    case seg[0] == "issues" && len(seg) == 2:
+        iss := f.issue(num)
+        if iss == nil { http.NotFound(w, r); return }
+        if r.Method == "PATCH" {
+            if b, ok := in["body"]; ok { iss.Body = str(b) }
+            if s, ok := in["state"]; ok { iss.State, iss.Reason = str(s), str(in["state_reason"]) }
+        }
+        reply(issueJSON(iss))
+    case seg[0] == "issues" && len(seg) == 3 && seg[2] == "comments":
+        iss := f.issue(num)
+        iss.Comments = append(iss.Comments, str(in["body"]))
+        reply(map[string]string{})
+    default:
+        http.Error(w, "unexpected "+r.Method+" "+p, http.StatusNotImplemented)
+    }
+}
+
+func (f *fakeGitHub) next() int { return len(f.pulls) + len(f.issues) + 1 }
+
+func (f *fakeGitHub) pull(n int) *fakePull {
+    for _, pr := range f.pulls {
+        if pr.Number == n { return pr }
+    }
+    return &fakePull{}
+}
+
+func (f *fakeGitHub) issue(n int) *fakeIssue {
+    for _, iss := range f.issues {
+        if iss.Number == n { return iss }
+    }
+    return nil
+}
+
+func (f *fakeGitHub) pullJSON(pr *fakePull) map[string]interface{} {
+    return map[string]interface{}{"number": pr.Number, "html_url": fmt.Sprintf("https://github.test/o/r/pull/%d", pr.Number)}
+}
+
+func issueJSON(iss *fakeIssue) map[string]interface{} {
+    m := map[string]interface{}{"number": iss.Number, "state": iss.State, "body": iss.Body, "html_url": fmt.Sprintf("https://github.test/o/r/issues/%d", iss.Number)}
+    if iss.PullRequest { m["pull_request"] = map[string]string{} }
+    return m
+}
+
+func hasLabels(have []string, want string) bool {
+    if want == "" { return true }
+    for _, w := range strings.Split(want, ",") {
+        found := false
+        for _, h := range have { found = found || h == w }
+        if !found { return false }
+    }
+    return true
+}
+
+func copyFiles(m map[string]string) map[string]string {
+    out := make(map[string]string, len(m))
+    for k, v := range m { out[k] = v }
+    return out
+}
+
+func str(v interface{}) string { s, _ := v.(string); return s }
+
+func strs(v interface{}) []string {
+    var out []string
+    l, _ := v.([]interface{})
+    for _, x := range l { out = append(out, str(x)) }
+    return out
+}
+
+func newTestGitHub(t *testing.T) (*fakeGitHub, GitOps) {
+    f, u := newFakeGitHub(t)
+    t.Setenv("GITHUB_API_URL", u)
+    return f, NewGitHub("tok", "o/r", "main")
+}
+
+func TestGitHubOpenPR(t *testing.T) {
+    ctx := context.Background()
+    f, gh := newTestGitHub(t)
+    f.files["main"]["deploy/values.yaml"] = "memory: 256Mi\n"
+    ch := GitOpsChange{Key: "shop/api/OOMKilled", FilePath: "deploy/values.yaml", Content: []byte("memory: 320Mi\n"), Title: "Bump api memory", Body: "OOM",
+        Labels: []string{"auto-agent"}, Assignees: []string{"alice"}, Reviewers: []string{"bob"}}
+
+    u, err := gh.OpenPR(ctx, ch)
+    if err != nil { t.Fatal(err) }
+    if u != "https://github.test/o/r/pull/1" { t.Fatalf("url = %s", u) }
+    branch := BranchFor(ch.Key)
+    if got := f.files[branch]["deploy/values.yaml"]; got != "memory: 320Mi\n" { t.Errorf("branch content = %q", got) }
+    if got := f.files["main"]["deploy/values.yaml"]; got != "memory: 256Mi\n" { t.Errorf("base changed to %q", got) }
+    pr := f.pulls[0]
+    if pr.Head != branch || pr.Base != "main" || pr.Title != ch.Title { t.Errorf("pr = %+v", pr) }
+    if len(pr.Labels) != 1 || len(pr.Assignees) != 1 || len(pr.Reviewers) != 1 { t.Errorf("labels/assignees/reviewers = %v/%v/%v", pr.Labels, pr.Assignees, pr.Reviewers) }
+
+    // A repeated detection updates the open PR instead of opening another.
+    ch.Content, ch.Title = []byte("memory: 400Mi\n"), "Bump api memory again"
+    if u2, err := gh.OpenPR(ctx, ch); err != nil || u2 != u { t.Fatalf("second OpenPR = %s, %v", u2, err) }
+    if len(f.pulls) != 1 { t.Fatalf("%d PRs, want 1", len(f.pulls)) }
+    if pr.Title != ch.Title || f.files[branch]["deploy/values.yaml"] != "memory: 400Mi\n" { t.Errorf("open PR not updated: %+v", pr) }
+    if len(pr.Reviewers) != 1 { t.Errorf("reviewers requested again: %v", pr.Reviewers) }
+}
+
+func TestGitHubOpenPRNoChange(t *testing.T) {
+    f, gh := newTestGitHub(t)
+    f.files["main"]["values.yaml"] = "a: 1\n"
+    _, err := gh.OpenPR(context.Background(), GitOpsChange{Key: "k", FilePath: "values.yaml", Content: []byte("a: 1\n"), Title: "t"})
+    if !errors.Is(err, ErrNoChange) { t.Fatalf("err = %v, want ErrNoChange", err) }
+    if len(f.pulls) != 0 { t.Errorf("opened a PR for unchanged content") }
+}
+
+func TestGitHubOpenPRResetsLeftoverBranch(t *testing.T) {
+    f, gh := newTestGitHub(t)
+    f.files["main"]["values.yaml"] = "a: 1\n"
+    branch := BranchFor("k")
+    f.files[branch] = map[string]string{"values.yaml": "a: 1\n", "stale.txt": "from a closed PR"}
+    if _, err := gh.OpenPR(context.Background(), GitOpsChange{Key: "k", FilePath: "values.yaml", Content: []byte("a: 2\n"), Title: "t"}); err != nil { t.Fatal(err) }
+    if _, ok := f.files[branch]["stale.txt"]; ok { t.Errorf("leftover branch was reused") }
+    if f.files[branch]["values.yaml"] != "a: 2\n" { t.Errorf("content = %q", f.files[branch]["values.yaml"]) }
+}
+
+func TestGitHubReadFile(t *testing.T) {
+    f, gh := newTestGitHub(t)
+    f.files["main"]["dir/my values.yaml"] = "x: y\n"
+    b, err := gh.ReadFile(context.Background(), "/dir/my values.yaml")
+    if err != nil || string(b) != "x: y\n" { t.Fatalf("ReadFile = %q, %v", b, err) }
+    if _, err := gh.ReadFile(context.Background(), "missing.yaml"); !IsStatus(errors.Unwrap(err), http.StatusNotFound) { t.Errorf("missing file: err = %v", err) }
+}
+
+func TestGitHubBadToken(t *testing.T) {
+    _, u := newFakeGitHub(t)
+    t.Setenv("GITHUB_API_URL", u)
+    _, err := NewGitHub("wrong", "o/r", "main").OpenPR(context.Background(), GitOpsChange{Key: "k", FilePath: "v.yaml", Content: []byte("a"), Title: "t"})
+    if !IsStatus(errors.Unwrap(err), http.StatusUnauthorized) { t.Fatalf("err = %v, want 401", err) }
+}
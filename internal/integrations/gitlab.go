@@ -0,0 +1,140 @@
+package integrations
+
+import (
+    "context"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+
+    "k8s.io/klog/v2"
+)
+
+// gitlabClient opens merge requests through the GitLab REST API (v4). repo is
+// the project as a path ("group/sub/project") or a numeric ID; the instance
+// defaults to gitlab.com and is set with GITLAB_URL for self-hosted GitLab.
+type gitlabClient struct {
+    token, project, base, api string
+    mu    sync.Mutex
+    users map[string]int // username → ID cache for assignees/reviewers
+}
+
+func NewGitLab(token, repo, base string) GitOps {
+    host := os.Getenv("GITLAB_URL")
+    if host == "" { host = "https://gitlab.com" }
+    return &gitlabClient{
+        token: token, base: base, project: url.PathEscape(repo),
+        api: strings.TrimRight(host, "/") + "/api/v4", users: map[string]int{},
+    }
+}
+
+type glMR struct {
+    IID    int    `json:"iid"`
+    WebURL string `json:"web_url"`
+}
+
+// OpenPR commits ch.Content to ch.FilePath with the commits API and opens a
+// merge request into the base branch. A new change (no open MR from its
+// branch) starts the branch from the base head, overwriting any leftover
+// branch; an open MR gets a new commit and an updated title and description.
+func (g *gitlabClient) OpenPR(ctx context.Context, ch GitOpsChange) (string, error) {
+    branch := ch.Branch
+    if branch == "" { branch = BranchFor(ch.Key) }
+    if branch == "auto-agent/" { return "", fmt.Errorf("gitlab: change needs a Branch or Key") }
+    msg := ch.CommitMessage
+    if msg == "" { msg = ch.Title }
+
+    existing, err := g.openMR(ctx, branch)
+    if err != nil { return "", err }
+    ref := g.base
+    if existing != nil { ref = branch }
+    cur, err := g.file(ctx, ch.FilePath, ref)
+    if err != nil && !IsStatus(err, http.StatusNotFound) { return "", fmt.Errorf("gitlab: read %s: %w", ch.FilePath, err) }
+    exists := err == nil
+    if existing == nil && exists && string(cur) == string(ch.Content) { return "", ErrNoChange }
+
+    if existing == nil || !exists || string(cur) != string(ch.Content) {
+        action := "update"
+        if !exists { action = "create" }
+        in := map[string]interface{}{
+            "branch": branch, "commit_message": msg,
+            "actions": []map[string]interface{}{{"action": action, "file_path": strings.TrimLeft(ch.FilePath, "/"), "content": string(ch.Content)}},
+        }
+        if existing == nil { in["start_branch"], in["force"] = g.base, true }
+        if err := g.call(ctx, "POST", g.projectURL("/repository/commits"), in, nil); err != nil { return "", fmt.Errorf("gitlab: commit %s: %w", ch.FilePath, err) }
+    }
+
+    in := map[string]interface{}{"title": ch.Title, "description": ch.Body}
+    if ids := g.userIDs(ctx, ch.Assignees); len(ids) > 0 { in["assignee_ids"] = ids }
+    if ids := g.userIDs(ctx, ch.Reviewers); len(ids) > 0 && existing == nil { in["reviewer_ids"] = ids }
+    mr := existing
+    if mr == nil {
+        mr = &glMR{}
+        in["source_branch"], in["target_branch"] = branch, g.base
+        in["labels"] = strings.Join(ch.Labels, ",")
+        in["remove_source_branch"] = true
+        if err := g.call(ctx, "POST", g.projectURL("/merge_requests"), in, mr); err != nil { return "", fmt.Errorf("gitlab: create MR: %w", err) }
+    } else {
+        if len(ch.Labels) > 0 { in["add_labels"] = strings.Join(ch.Labels, ",") }
+        if err := g.call(ctx, "PUT", g.projectURL(fmt.Sprintf("/merge_requests/%d", mr.IID)), in, nil); err != nil { return "", fmt.Errorf("gitlab: update MR !%d: %w", mr.IID, err) }
+    }
+    return mr.WebURL, nil
+}
+
+// openMR returns the open MR from branch into the base branch, if any.
+func (g *gitlabClient) openMR(ctx context.Context, branch string) (*glMR, error) {
+    q := url.Values{"state": {"opened"}, "source_branch": {branch}, "target_branch": {g.base}}
+    var mrs []glMR
+    if err := g.call(ctx, "GET", g.projectURL("/merge_requests?"+q.Encode()), nil, &mrs); err != nil { return nil, fmt.Errorf("gitlab: list MRs: %w", err) }
+    if len(mrs) == 0 { return nil, nil }
+    return &mrs[0], nil
+}
+
+func (g *gitlabClient) file(ctx context.Context, path, ref string) ([]byte, error) {
+    var f struct{ Content string `json:"content"` }
+    u := g.projectURL("/repository/files/"+url.PathEscape(strings.TrimLeft(path, "/"))) + "?ref=" + url.QueryEscape(ref)
+    if err := g.call(ctx, "GET", u, nil, &f); err != nil { return nil, err }
+    return base64.StdEncoding.DecodeString(f.Content)
+}
+
+// ReadFile returns the content of path on the base branch.
+func (g *gitlabClient) ReadFile(ctx context.Context, path string) ([]byte, error) {
+    b, err := g.file(ctx, path, g.base)
+    if err != nil { return nil, fmt.Errorf("gitlab: read %s: %w", path, err) }
+    return b, nil
+}
+
+// userIDs resolves usernames (or numeric IDs) to user IDs; unknown users are
+// logged and skipped.
+func (g *gitlabClient) userIDs(ctx context.Context, names []string) []int {
+    var ids []int
+    for _, n := range names {
+        if id, err := strconv.Atoi(n); err == nil { ids = append(ids, id); continue }
+        g.mu.Lock()
+        id, ok := g.users[n]
+        g.mu.Unlock()
+        if ok { ids = append(ids, id); continue }
+        var us []struct{ ID int `json:"id"` }
+        if err := g.call(ctx, "GET", g.api+"/users?username="+url.QueryEscape(n), nil, &us); err != nil || len(us) == 0 {
+            klog.Warningf("gitlab: unknown user %q: %v", n, err)
+            continue
+        }
+        g.mu.Lock()
+        g.users[n] = us[0].ID
+        g.mu.Unlock()
+        ids = append(ids, us[0].ID)
+    }
+    return ids
+}
+
+func (g *gitlabClient) projectURL(p string) string { return g.api + "/projects/" + g.project + p }
+
+func (g *gitlabClient) call(ctx context.Context, method, u string, in, out interface{}) error {
+    hdr := http.Header{}
+    hdr.Set("PRIVATE-TOKEN", g.token)
+    return doJSON(ctx, method, u, hdr, in, out)
+}
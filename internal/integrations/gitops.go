@@ -2,33 +2,33 @@ package integrations
 
 import (
     "context"
-    "fmt"
+    "errors"
 )
 
+// ErrNoChange is returned by OpenPR when the content already matches the base
+// branch and no request is open for the change.
+var ErrNoChange = errors.New("gitops: content already matches base branch")
+
+// GitOpsChange is one file change proposed as a pull/merge request. Key
+// identifies the problem (e.g. "prod/api/OOMKilled"): it picks the branch, so
+// a change with the same key updates the open request instead of opening a
+// duplicate. Branch overrides the derived branch name.
 type GitOpsChange struct {
-    FilePath string
-    Content  []byte
-    Title    string
-    Body     string
-    Branch   string
+    Key           string
+    FilePath      string
+    Content       []byte
+    Title         string
+    Body          string
+    CommitMessage string // default: Title
+    Branch        string
+    Labels        []string
+    Assignees     []string // GitHub logins / GitLab usernames or user IDs
+    Reviewers     []string
 }
 
 type GitOps interface {
     OpenPR(ctx context.Context, ch GitOpsChange) (string, error) // returns PR URL
+    // ReadFile returns a file from the base branch.
+    ReadFile(ctx context.Context, path string) ([]byte, error)
 }
 
-type githubClient struct {
-    token, repo, base string
-}
-func NewGitHub(token, repo, base string) GitOps { return &githubClient{token: token, repo: repo, base: base} }
-
-func (g *githubClient) OpenPR(ctx context.Context, ch GitOpsChange) (string, error) {
-    // Placeholder: implement full GitHub API calls (create branch, commit blob/tree, open PR).
-    return fmt.Sprintf("https://github.com/%s/pull/123 (stub)", g.repo), nil
-}
-
-type gitlabClient struct { token, repo, base string }
-func NewGitLab(token, repo, base string) GitOps { return &gitlabClient{token: token, repo: repo, base: base} }
-func (g *gitlabClient) OpenPR(ctx context.Context, ch GitOpsChange) (string, error) {
-    return fmt.Sprintf("https://gitlab.com/%s/-/merge_requests/1 (stub)", g.repo), nil
-}
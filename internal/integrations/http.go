@@ -0,0 +1,74 @@
+package integrations
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// HTTPError is returned for non-2xx responses from a provider API.
+type HTTPError struct {
+    Method, URL string
+    Status      int
+    Body        string
+}
+
+func (e *HTTPError) Error() string {
+    return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+// IsStatus reports whether err is an *HTTPError with the given status.
+func IsStatus(err error, status int) bool {
+    he, ok := err.(*HTTPError)
+    return ok && he.Status == status
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// doJSON sends in (if non-nil) as JSON and decodes the response into out (if
+// non-nil).
+func doJSON(ctx context.Context, method, url string, hdr http.Header, in, out interface{}) error {
+    var body io.Reader
+    if in != nil {
+        b, err := json.Marshal(in)
+        if err != nil { return err }
+        body = bytes.NewReader(b)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, url, body)
+    if err != nil { return err }
+    for k, vs := range hdr {
+        for _, v := range vs { req.Header.Add(k, v) }
+    }
+    if in != nil { req.Header.Set("Content-Type", "application/json") }
+    if req.Header.Get("Accept") == "" { req.Header.Set("Accept", "application/json") }
+    resp, err := httpClient.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+    if resp.StatusCode >= 300 {
+        return &HTTPError{Method: method, URL: url, Status: resp.StatusCode, Body: strings.TrimSpace(string(truncate(b, 512)))}
+    }
+    if out == nil || len(b) == 0 { return nil }
+    return json.Unmarshal(b, out)
+}
+
+func truncate(b []byte, n int) []byte {
+    if len(b) > n { return b[:n] }
+    return b
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// BranchFor derives the deterministic branch used for a change key, so a
+// repeated change for the same workload and reason lands on the same branch.
+func BranchFor(key string) string {
+    s := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(key), "-"), "-")
+    if len(s) > 80 { s = s[:80] }
+    return "auto-agent/" + s
+}
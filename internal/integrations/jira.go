@@ -0,0 +1,309 @@
+package integrations
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "k8s.io/klog/v2"
+)
+
+// jiraClient files tickets as Jira issues. With an email the token is an
+// Atlassian API token (Jira Cloud: basic auth, REST v3, descriptions in
+// Atlassian Document Format); without one it is a personal access token
+// (Jira Server/Data Center: bearer auth, REST v2, wiki markup rendered from
+// the same document).
+//
+// Open issues are found by a dedup label, auto-agent-<key hash>. Set
+// JIRA_DEDUP_FIELD to a text custom field (customfield_10050) to match on
+// that instead, e.g. when labels are curated by hand.
+type jiraClient struct {
+    token, base, project, email string
+    api   string // <base>/rest/api/3 or /rest/api/2
+    field string // dedup custom field, "" for the label
+    mu    sync.Mutex
+    known map[string]string // key hash → issue key, covers search index lag
+}
+
+func NewJira(token, base, project, email string) Ticketer {
+    base = strings.TrimRight(base, "/")
+    api := base + "/rest/api/3"
+    if email == "" { api = base + "/rest/api/2" }
+    return &jiraClient{token: token, base: base, project: project, email: email, api: api, field: jiraField(), known: map[string]string{}}
+}
+
+var customField = regexp.MustCompile(`^customfield_(\d+)$`)
+
+func jiraField() string {
+    f := os.Getenv("JIRA_DEDUP_FIELD")
+    if f != "" && !customField.MatchString(f) {
+        klog.Warningf("jira: JIRA_DEDUP_FIELD %q is not customfield_<id>; using the dedup label", f)
+        return ""
+    }
+    return f
+}
+
+func (j *jiraClient) cloud() bool { return j.email != "" }
+
+// jiraMaxField is the most characters Jira stores in a description or a
+// comment; longer ones fail the request.
+const jiraMaxField = 32767
+
+// jiraOccurrences is the issue property counting an incident's detections,
+// the counterpart of the GitHub issue marker.
+const jiraOccurrences = "auto-agent-occurrences"
+
+const truncatedMarker = "…(truncated)\n"
+
+type jiraIssue struct {
+    Key    string `json:"key"`
+    Fields struct {
+        Status struct {
+            StatusCategory struct{ Key string `json:"key"` } `json:"statusCategory"`
+        } `json:"status"`
+    } `json:"fields"`
+}
+
+func (j *jiraClient) CreateOrUpdate(ctx context.Context, key string, t Ticket) (string, error) {
+    id := ticketKey(key)
+    ik, err := j.find(ctx, id)
+    if err != nil { return "", err }
+    if ik == "" { return j.create(ctx, id, t) }
+
+    when := " at " + time.Now().UTC().Format(time.RFC3339) + "."
+    if n := j.occurred(ctx, ik); n > 0 { when = fmt.Sprintf(" (occurrence %d)%s", n, when) }
+    doc := adfDoc(adfParagraph(adfStrong("Occurred again"), adfText(when)))
+    var logs *adfNode
+    if t.Logs != "" { logs = adfCode(t.Logs); doc.Content = append(doc.Content, logs) }
+    if t.BundleURL != "" { doc.Content = append(doc.Content, adfParagraph(adfText("Log bundle: "), adfLink(t.BundleURL))) }
+    if err := j.call(ctx, "POST", j.api+"/issue/"+ik+"/comment", map[string]interface{}{"body": j.fit(doc, logs)}, nil); err != nil {
+        return "", fmt.Errorf("jira: comment on %s: %w", ik, err)
+    }
+    return j.browse(ik), nil
+}
+
+// occurred bumps the occurrence count of issue ik and returns it, or 0 if it
+// could not be read. An issue without the property has occurred once.
+func (j *jiraClient) occurred(ctx context.Context, ik string) int {
+    u := j.api + "/issue/" + ik + "/properties/" + jiraOccurrences
+    var prop struct{ Value int `json:"value"` }
+    err := j.call(ctx, "GET", u, nil, &prop)
+    if err != nil && !IsStatus(err, http.StatusNotFound) {
+        klog.Warningf("jira: read occurrences of %s: %v", ik, err)
+        return 0
+    }
+    n := 2
+    if prop.Value > 0 { n = prop.Value + 1 }
+    if err := j.call(ctx, "PUT", u, n, nil); err != nil { klog.Warningf("jira: store occurrences of %s: %v", ik, err) }
+    return n
+}
+
+// Resolve comments note on the unresolved issue for key and moves it to a
+// done status: the transition named JIRA_RESOLVE_TRANSITION, else the first
+// one leading to the Done category.
+func (j *jiraClient) Resolve(ctx context.Context, key, note string) (string, error) {
+    id := ticketKey(key)
+    ik, err := j.find(ctx, id)
+    if err != nil || ik == "" { return "", err }
+    if err := j.call(ctx, "POST", j.api+"/issue/"+ik+"/comment", map[string]interface{}{"body": j.render(adfDoc(adfParagraph(adfText(note))))}, nil); err != nil {
+        return "", fmt.Errorf("jira: comment on %s: %w", ik, err)
+    }
+    var res struct {
+        Transitions []struct {
+            ID   string `json:"id"`
+            Name string `json:"name"`
+            To   struct {
+                StatusCategory struct{ Key string `json:"key"` } `json:"statusCategory"`
+            } `json:"to"`
+        } `json:"transitions"`
+    }
+    if err := j.call(ctx, "GET", j.api+"/issue/"+ik+"/transitions", nil, &res); err != nil { return "", fmt.Errorf("jira: transitions of %s: %w", ik, err) }
+    want, tid := os.Getenv("JIRA_RESOLVE_TRANSITION"), ""
+    for _, t := range res.Transitions {
+        if (want != "" && strings.EqualFold(t.Name, want)) || (want == "" && t.To.StatusCategory.Key == "done") { tid = t.ID; break }
+    }
+    if tid == "" { return "", fmt.Errorf("jira: %s has no transition to a done status", ik) }
+    if err := j.call(ctx, "POST", j.api+"/issue/"+ik+"/transitions", map[string]interface{}{"transition": map[string]string{"id": tid}}, nil); err != nil {
+        return "", fmt.Errorf("jira: transition %s: %w", ik, err)
+    }
+    j.forget(id)
+    return j.browse(ik), nil
+}
+
+// find returns the key of the unresolved issue carrying id, checking the
+// issue remembered for id before searching.
+func (j *jiraClient) find(ctx context.Context, id string) (string, error) {
+    j.mu.Lock()
+    ik, ok := j.known[id]
+    j.mu.Unlock()
+    if ok {
+        var iss jiraIssue
+        err := j.call(ctx, "GET", j.api+"/issue/"+ik+"?fields=status", nil, &iss)
+        if err == nil && iss.Fields.Status.StatusCategory.Key != "done" { return ik, nil }
+        if err != nil && !IsStatus(err, http.StatusNotFound) { return "", fmt.Errorf("jira: get %s: %w", ik, err) }
+        j.forget(id)
+    }
+    match := fmt.Sprintf("labels = %q", "auto-agent-"+id)
+    if j.field != "" { match = fmt.Sprintf("cf[%s] ~ %q", customField.FindStringSubmatch(j.field)[1], id) }
+    jql := fmt.Sprintf("project = %q AND %s AND statusCategory != Done ORDER BY created DESC", j.project, match)
+    q := url.Values{"jql": {jql}, "fields": {"status"}, "maxResults": {"1"}}
+    // Jira Cloud retired /search in favour of /search/jql; Server only has /search.
+    path := "/search/jql?"
+    if !j.cloud() { path = "/search?" }
+    var res struct{ Issues []jiraIssue `json:"issues"` }
+    if err := j.call(ctx, "GET", j.api+path+q.Encode(), nil, &res); err != nil { return "", fmt.Errorf("jira: search: %w", err) }
+    if len(res.Issues) == 0 { return "", nil }
+    j.remember(id, res.Issues[0].Key)
+    return res.Issues[0].Key, nil
+}
+
+func (j *jiraClient) create(ctx context.Context, id string, t Ticket) (string, error) {
+    doc := adfDoc()
+    for _, p := range strings.Split(strings.TrimSpace(t.Body), "\n\n") {
+        if p != "" { doc.Content = append(doc.Content, adfParagraph(adfText(p))) }
+    }
+    var logs *adfNode
+    if t.Logs != "" { logs = adfCode(t.Logs); doc.Content = append(doc.Content, adfHeading("Logs"), logs) }
+    if t.BundleURL != "" { doc.Content = append(doc.Content, adfParagraph(adfText("Log bundle: "), adfLink(t.BundleURL))) }
+    if t.RunbookURL != "" { doc.Content = append(doc.Content, adfParagraph(adfText("Runbook: "), adfLink(t.RunbookURL))) }
+
+    labels := []string{"auto-agent"}
+    if j.field == "" { labels = append(labels, "auto-agent-"+id) }
+    for _, l := range t.Labels { labels = append(labels, strings.Join(strings.Fields(l), "-")) } // labels cannot contain spaces
+    issueType := t.IssueType
+    if issueType == "" { issueType = "Task" }
+    summary := t.Title
+    if r := []rune(summary); len(r) > 250 { summary = string(r[:250]) }
+    fields := map[string]interface{}{
+        "project": map[string]string{"key": j.project}, "issuetype": map[string]string{"name": issueType},
+        "summary": summary, "description": j.fit(doc, logs), "labels": labels,
+    }
+    if j.field != "" { fields[j.field] = id }
+    if t.Priority != "" { fields["priority"] = map[string]string{"name": t.Priority} }
+    if len(t.Assignees) > 0 {
+        // Cloud identifies users by account ID, Server by username.
+        if j.cloud() { fields["assignee"] = map[string]string{"accountId": t.Assignees[0]} } else { fields["assignee"] = map[string]string{"name": t.Assignees[0]} }
+    }
+    var out struct{ Key string `json:"key"` }
+    err := j.call(ctx, "POST", j.api+"/issue", map[string]interface{}{"fields": fields}, &out)
+    if IsStatus(err, http.StatusBadRequest) && (fields["assignee"] != nil || fields["priority"] != nil) {
+        // An unknown assignee, or a priority missing from the create screen,
+        // fails the whole request.
+        klog.Warningf("jira: create issue in %s: %v; retrying without assignee and priority", j.project, err)
+        delete(fields, "assignee"); delete(fields, "priority")
+        err = j.call(ctx, "POST", j.api+"/issue", map[string]interface{}{"fields": fields}, &out)
+    }
+    if err != nil { return "", fmt.Errorf("jira: create issue in %s: %w", j.project, err) }
+    j.remember(id, out.Key)
+    return j.browse(out.Key), nil
+}
+
+func (j *jiraClient) browse(key string) string { return j.base + "/browse/" + key }
+
+// render returns doc as ADF for REST v3 and as wiki markup for v2.
+func (j *jiraClient) render(doc *adfNode) interface{} {
+    if j.cloud() { return doc }
+    return strings.TrimSpace(doc.wiki())
+}
+
+// fit renders doc, cutting the start of the logs code block (nil: none) until
+// the result fits in jiraMaxField. The newest lines are kept.
+func (j *jiraClient) fit(doc, logs *adfNode) interface{} {
+    out := j.render(doc)
+    if logs == nil { return out }
+    text := logs.Content[0]
+    full := []rune(text.Text)
+    keep := len(full)
+    for {
+        over := renderedLen(out) - jiraMaxField
+        if over <= 0 || keep == 0 { return out }
+        if keep -= over + utf8.RuneCountInString(truncatedMarker); keep < 0 { keep = 0 }
+        text.Text = truncatedMarker + string(full[len(full)-keep:])
+        out = j.render(doc)
+    }
+}
+
+// renderedLen is the length Jira counts for a rendered body: the characters
+// of wiki markup, or of the serialised ADF document.
+func renderedLen(body interface{}) int {
+    if s, ok := body.(string); ok { return utf8.RuneCountInString(s) }
+    b, _ := json.Marshal(body)
+    return utf8.RuneCount(b)
+}
+
+func (j *jiraClient) call(ctx context.Context, method, u string, in, out interface{}) error {
+    hdr := http.Header{}
+    if j.cloud() {
+        hdr.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(j.email+":"+j.token)))
+    } else {
+        hdr.Set("Authorization", "Bearer "+j.token)
+    }
+    return doJSON(ctx, method, u, hdr, in, out)
+}
+
+func (j *jiraClient) remember(id, key string) { j.mu.Lock(); j.known[id] = key; j.mu.Unlock() }
+func (j *jiraClient) forget(id string)        { j.mu.Lock(); delete(j.known, id); j.mu.Unlock() }
+
+// adfNode is the subset of Atlassian Document Format used for tickets.
+type adfNode struct {
+    Type    string                 `json:"type"`
+    Version int                    `json:"version,omitempty"`
+    Attrs   map[string]interface{} `json:"attrs,omitempty"`
+    Content []*adfNode             `json:"content,omitempty"`
+    Text    string                 `json:"text,omitempty"`
+    Marks   []adfMark              `json:"marks,omitempty"`
+}
+
+type adfMark struct {
+    Type  string            `json:"type"`
+    Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func adfDoc(c ...*adfNode) *adfNode       { return &adfNode{Type: "doc", Version: 1, Content: c} }
+func adfParagraph(c ...*adfNode) *adfNode { return &adfNode{Type: "paragraph", Content: c} }
+func adfText(s string) *adfNode           { return &adfNode{Type: "text", Text: s} }
+func adfStrong(s string) *adfNode         { return &adfNode{Type: "text", Text: s, Marks: []adfMark{{Type: "strong"}}} }
+func adfLink(u string) *adfNode {
+    return &adfNode{Type: "text", Text: u, Marks: []adfMark{{Type: "link", Attrs: map[string]string{"href": u}}}}
+}
+func adfHeading(s string) *adfNode {
+    return &adfNode{Type: "heading", Attrs: map[string]interface{}{"level": 3}, Content: []*adfNode{adfText(s)}}
+}
+func adfCode(s string) *adfNode {
+    return &adfNode{Type: "codeBlock", Content: []*adfNode{adfText(strings.TrimRight(s, "\n"))}}
+}
+
+// wiki renders n as Jira wiki markup.
+func (n *adfNode) wiki() string {
+    var b strings.Builder
+    for _, c := range n.Content { b.WriteString(c.wiki()) }
+    switch n.Type {
+    case "paragraph":
+        return b.String() + "\n\n"
+    case "heading":
+        return fmt.Sprintf("h%v. %s\n", n.Attrs["level"], b.String())
+    case "codeBlock":
+        return "{noformat}\n" + b.String() + "\n{noformat}\n\n"
+    case "text":
+        s := n.Text
+        for _, m := range n.Marks {
+            switch m.Type {
+            case "strong":
+                s = "*" + s + "*"
+            case "link":
+                s = "[" + m.Attrs["href"] + "]"
+            }
+        }
+        return s
+    }
+    return b.String()
+}
@@ -0,0 +1,128 @@
+package integrations
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// fakeJira stands in for one Jira project: it files issues, searches them by
+// dedup label, and stores comments and issue properties as raw JSON.
+type fakeJira struct {
+    mu     sync.Mutex
+    issues []*fakeJiraIssue
+    props  map[string]json.RawMessage // "<issue>/<property>" → value
+}
+
+type fakeJiraIssue struct {
+    Key         string
+    Labels      []string
+    Description json.RawMessage
+    Comments    []json.RawMessage
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    f.mu.Lock(); defer f.mu.Unlock()
+    p := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/rest/api/3"), "/rest/api/2")
+    switch {
+    case r.Method == "POST" && p == "/issue":
+        var in struct {
+            Fields struct {
+                Labels      []string        `json:"labels"`
+                Description json.RawMessage `json:"description"`
+            } `json:"fields"`
+        }
+        _ = json.NewDecoder(r.Body).Decode(&in)
+        iss := &fakeJiraIssue{Key: fmt.Sprintf("OPS-%d", len(f.issues)+1), Labels: in.Fields.Labels, Description: in.Fields.Description}
+        f.issues = append(f.issues, iss)
+        fmt.Fprintf(w, `{"key":%q}`, iss.Key)
+    case strings.HasPrefix(p, "/search"):
+        jql := r.URL.Query().Get("jql")
+        var out []map[string]string
+        for _, iss := range f.issues {
+            for _, l := range iss.Labels {
+                if strings.Contains(jql, fmt.Sprintf("labels = %q", l)) { out = append(out, map[string]string{"key": iss.Key}) }
+            }
+        }
+        _ = json.NewEncoder(w).Encode(map[string]interface{}{"issues": out})
+    case strings.Contains(p, "/properties/"):
+        k := strings.TrimPrefix(strings.Replace(p, "/properties", "", 1), "/issue/")
+        if r.Method == "PUT" {
+            var v json.RawMessage
+            _ = json.NewDecoder(r.Body).Decode(&v)
+            f.props[k] = v
+            w.WriteHeader(http.StatusNoContent)
+            return
+        }
+        v, ok := f.props[k]
+        if !ok { http.Error(w, `{"errorMessages":["not found"]}`, http.StatusNotFound); return }
+        fmt.Fprintf(w, `{"key":%q,"value":%s}`, k, v)
+    case r.Method == "POST" && strings.HasSuffix(p, "/comment"):
+        var in struct{ Body json.RawMessage `json:"body"` }
+        _ = json.NewDecoder(r.Body).Decode(&in)
+        for _, iss := range f.issues {
+            if p == "/issue/"+iss.Key+"/comment" { iss.Comments = append(iss.Comments, in.Body) }
+        }
+        fmt.Fprint(w, `{}`)
+    case strings.HasPrefix(p, "/issue/"):
+        fmt.Fprint(w, `{"fields":{"status":{"statusCategory":{"key":"new"}}}}`)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func newTestJira(t *testing.T, email string) (*fakeJira, Ticketer) {
+    f := &fakeJira{props: map[string]json.RawMessage{}}
+    srv := httptest.NewServer(f)
+    t.Cleanup(srv.Close)
+    return f, NewJira("tok", srv.URL, "OPS", email)
+}
+
+// text returns a rendered body as Jira measures it: wiki markup as is, ADF
+// as its JSON.
+func text(raw json.RawMessage) string {
+    var s string
+    if json.Unmarshal(raw, &s) == nil { return s }
+    return string(raw)
+}
+
+func TestJiraRecurrenceCountsOccurrences(t *testing.T) {
+    for _, email := range []string{"", "bot@example.com"} {
+        f, tk := newTestJira(t, email)
+        ctx := context.Background()
+        ticket := Ticket{Title: "CrashLoopBackOff: shop/api", Body: "crashed", Logs: "panic: boom\n"}
+        for i := 0; i < 3; i++ {
+            if _, err := tk.CreateOrUpdate(ctx, "shop/api/CrashLoopBackOff/app", ticket); err != nil { t.Fatal(err) }
+        }
+        if len(f.issues) != 1 { t.Fatalf("email %q: %d issues, want 1", email, len(f.issues)) }
+        c := f.issues[0].Comments
+        if len(c) != 2 || !strings.Contains(text(c[0]), "(occurrence 2)") || !strings.Contains(text(c[1]), "(occurrence 3)") {
+            t.Errorf("email %q: comments = %s", email, c)
+        }
+    }
+}
+
+func TestJiraTruncatesLogsToFieldLimit(t *testing.T) {
+    // Quotes and newlines grow in JSON, so the ADF body is longer than the logs.
+    logs := strings.Repeat("line \"x\"\n", 10000) + "last line"
+    for _, email := range []string{"", "bot@example.com"} {
+        f, tk := newTestJira(t, email)
+        ctx := context.Background()
+        ticket := Ticket{Title: "t", Body: "crashed", Logs: logs, RunbookURL: "https://runbooks.test/crash"}
+        for i := 0; i < 2; i++ {
+            if _, err := tk.CreateOrUpdate(ctx, "k", ticket); err != nil { t.Fatal(err) }
+        }
+        iss := f.issues[0]
+        for _, body := range []json.RawMessage{iss.Description, iss.Comments[0]} {
+            s := text(body)
+            if n := len([]rune(s)); n > jiraMaxField { t.Errorf("email %q: %d characters, limit %d", email, n, jiraMaxField) }
+            if !strings.Contains(s, "(truncated)") || !strings.Contains(s, "last line") { t.Errorf("email %q: logs not cut from the start", email) }
+        }
+        if !strings.Contains(text(iss.Description), "runbooks.test") { t.Errorf("email %q: runbook dropped", email) }
+    }
+}
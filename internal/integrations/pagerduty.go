@@ -0,0 +1,67 @@
+package integrations
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+)
+
+// PagerDuty sends Events API v2 events. The endpoint defaults to
+// events.pagerduty.com; PAGERDUTY_EVENTS_URL overrides it (EU service
+// region: https://events.eu.pagerduty.com/v2/enqueue).
+type PagerDuty struct{ url string }
+
+func NewPagerDuty() *PagerDuty {
+    u := os.Getenv("PAGERDUTY_EVENTS_URL")
+    if u == "" { u = "https://events.pagerduty.com/v2/enqueue" }
+    return &PagerDuty{url: u}
+}
+
+// PDEvent is one event. Action is trigger, acknowledge or resolve; events for
+// the same DedupKey act on the same PagerDuty alert. The remaining fields are
+// only sent with trigger.
+type PDEvent struct {
+    RoutingKey string
+    Action     string
+    DedupKey   string
+    Summary    string
+    Source     string // affected object, e.g. pod or node name
+    Severity   string // critical|error|warning|info
+    Component  string
+    Group      string
+    Class      string
+    Details    map[string]string
+    Links      []PDLink
+}
+
+type PDLink struct {
+    Href string `json:"href"`
+    Text string `json:"text,omitempty"`
+}
+
+func (p *PagerDuty) Send(ctx context.Context, ev PDEvent) error {
+    if ev.RoutingKey == "" { return fmt.Errorf("pagerduty: no routing key") }
+    in := map[string]interface{}{"routing_key": ev.RoutingKey, "event_action": ev.Action, "dedup_key": ev.DedupKey}
+    if ev.Action == "trigger" {
+        summary := ev.Summary
+        if len(summary) > 1024 { summary = summary[:1024] }
+        payload := map[string]interface{}{"summary": summary, "source": ev.Source, "severity": ev.Severity}
+        if ev.Component != "" { payload["component"] = ev.Component }
+        if ev.Group != "" { payload["group"] = ev.Group }
+        if ev.Class != "" { payload["class"] = ev.Class }
+        if len(ev.Details) > 0 { payload["custom_details"] = ev.Details }
+        in["payload"] = payload
+        in["client"] = "auto-agent"
+        var links []PDLink
+        for _, l := range ev.Links {
+            // Only http(s) links are rendered; bundle paths such as s3:// go
+            // in the details instead.
+            if strings.HasPrefix(l.Href, "http://") || strings.HasPrefix(l.Href, "https://") { links = append(links, l) }
+        }
+        if len(links) > 0 { in["links"] = links }
+    }
+    if err := doJSON(ctx, http.MethodPost, p.url, nil, in, nil); err != nil { return fmt.Errorf("pagerduty: %s %s: %w", ev.Action, ev.DedupKey, err) }
+    return nil
+}
@@ -1,27 +1,162 @@
 package integrations
 
-import "context"
+import (
+    "context"
+    "crypto/sha1"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
 
+    "k8s.io/klog/v2"
+)
+
+// Ticket is an incident ticket. Body is plain text, paragraphs separated by
+// blank lines; Logs is shown as a code block. BundleURL links the incident's
+// log bundle and is repeated in the comment added when the incident recurs.
 type Ticket struct {
-    Title string
-    Body  string
-    Labels []string
-    Assignees []string
+    Title      string
+    Body       string
+    Logs       string
+    BundleURL  string
+    RunbookURL string
+    Labels     []string
+    Assignees  []string
+    IssueType  string // Jira only
+    Priority   string // Jira only
 }
 
 type Ticketer interface {
-    CreateOrUpdate(ctx context.Context, key string, t Ticket) (string, error) // returns URL
+    // CreateOrUpdate files t under key: the open ticket for key gets a
+    // recurrence comment, otherwise a new ticket is created. Returns its URL.
+    CreateOrUpdate(ctx context.Context, key string, t Ticket) (string, error)
+    // Resolve adds note to the open ticket for key and closes it. Returns
+    // its URL, or "" when no ticket is open.
+    Resolve(ctx context.Context, key, note string) (string, error)
+}
+
+// ticketKey is the stable dedup ID of a key, embedded in ticket bodies.
+func ticketKey(key string) string {
+    h := sha1.Sum([]byte(key))
+    return hex.EncodeToString(h[:])[:16]
+}
+
+// githubIssues files tickets as GitHub issues. Each issue body carries a
+// hidden marker with the key's hash and the occurrence count, e.g.
+// <!-- auto-agent:ticket key=0123abcd… occurrences=3 -->.
+type githubIssues struct {
+    gh    *githubClient
+    mu    sync.Mutex
+    known map[string]int // key hash → issue number, covers GitHub's listing lag
+}
+
+func NewGitHubIssues(token, repo string) Ticketer {
+    return &githubIssues{gh: NewGitHub(token, repo, "").(*githubClient), known: map[string]int{}}
+}
+
+var issueMarker = regexp.MustCompile(`<!-- auto-agent:ticket key=([0-9a-f]+) occurrences=(\d+) -->`)
+
+type ghIssue struct {
+    Number      int       `json:"number"`
+    State       string    `json:"state"`
+    Body        string    `json:"body"`
+    HTMLURL     string    `json:"html_url"`
+    PullRequest *struct{} `json:"pull_request"` // set when the "issue" is a PR
 }
 
-type githubIssues struct { token, repo string }
-func NewGitHubIssues(token, repo string) Ticketer { return &githubIssues{token: token, repo: repo} }
 func (g *githubIssues) CreateOrUpdate(ctx context.Context, key string, t Ticket) (string, error) {
-    // Placeholder: search by title key, create or update.
-    return "https://github.com/"+g.repo+"/issues/999 (stub)", nil
+    id := ticketKey(key)
+    iss, err := g.find(ctx, id, t.Labels)
+    if err != nil { return "", err }
+    if iss == nil { return g.create(ctx, id, t) }
+
+    n := 1
+    if m := issueMarker.FindStringSubmatch(iss.Body); m != nil { n, _ = strconv.Atoi(m[2]) }
+    n++
+    body := issueMarker.ReplaceAllString(iss.Body, marker(id, n))
+    if err := g.gh.call(ctx, "PATCH", g.gh.repoURL(fmt.Sprintf("/issues/%d", iss.Number)), map[string]interface{}{"body": body}, nil); err != nil {
+        return "", fmt.Errorf("github: update issue #%d: %w", iss.Number, err)
+    }
+    c := fmt.Sprintf("**Occurred again** (occurrence %d) at %s.", n, time.Now().UTC().Format(time.RFC3339))
+    if t.BundleURL != "" { c += "\n\nLog bundle: " + t.BundleURL }
+    if err := g.gh.call(ctx, "POST", g.gh.repoURL(fmt.Sprintf("/issues/%d/comments", iss.Number)), map[string]interface{}{"body": c}, nil); err != nil {
+        return "", fmt.Errorf("github: comment on issue #%d: %w", iss.Number, err)
+    }
+    return iss.HTMLURL, nil
+}
+
+func (g *githubIssues) Resolve(ctx context.Context, key, note string) (string, error) {
+    id := ticketKey(key)
+    iss, err := g.find(ctx, id, nil)
+    if err != nil || iss == nil { return "", err }
+    if err := g.gh.call(ctx, "POST", g.gh.repoURL(fmt.Sprintf("/issues/%d/comments", iss.Number)), map[string]interface{}{"body": note}, nil); err != nil {
+        return "", fmt.Errorf("github: comment on issue #%d: %w", iss.Number, err)
+    }
+    in := map[string]interface{}{"state": "closed", "state_reason": "completed"}
+    if err := g.gh.call(ctx, "PATCH", g.gh.repoURL(fmt.Sprintf("/issues/%d", iss.Number)), in, nil); err != nil {
+        return "", fmt.Errorf("github: close issue #%d: %w", iss.Number, err)
+    }
+    g.forget(id)
+    return iss.HTMLURL, nil
 }
 
-type jiraClient struct { token, base, project, email string }
-func NewJira(token, base, project, email string) Ticketer { return &jiraClient{token: token, base: base, project: project, email: email} }
-func (j *jiraClient) CreateOrUpdate(ctx context.Context, key string, t Ticket) (string, error) {
-    return j.base + "/browse/" + j.project + "-123 (stub)", nil
+// find returns the open issue carrying id's marker. It checks the issue
+// remembered for id first, then scans open issues with the ticket's labels.
+func (g *githubIssues) find(ctx context.Context, id string, labels []string) (*ghIssue, error) {
+    g.mu.Lock()
+    num, ok := g.known[id]
+    g.mu.Unlock()
+    if ok {
+        var iss ghIssue
+        err := g.gh.call(ctx, "GET", g.gh.repoURL(fmt.Sprintf("/issues/%d", num)), nil, &iss)
+        if err == nil && iss.State == "open" { return &iss, nil }
+        if err != nil && !IsStatus(err, http.StatusNotFound) { return nil, fmt.Errorf("github: get issue #%d: %w", num, err) }
+        g.forget(id)
+    }
+    q := url.Values{"state": {"open"}, "per_page": {"100"}, "sort": {"created"}, "direction": {"desc"}}
+    if len(labels) > 0 { q.Set("labels", strings.Join(labels, ",")) }
+    for page := 1; page <= 10; page++ {
+        q.Set("page", strconv.Itoa(page))
+        var list []ghIssue
+        if err := g.gh.call(ctx, "GET", g.gh.repoURL("/issues?"+q.Encode()), nil, &list); err != nil { return nil, fmt.Errorf("github: list issues: %w", err) }
+        for i := range list {
+            if m := issueMarker.FindStringSubmatch(list[i].Body); m != nil && m[1] == id && list[i].PullRequest == nil {
+                g.remember(id, list[i].Number)
+                return &list[i], nil
+            }
+        }
+        if len(list) < 100 { break }
+    }
+    return nil, nil
 }
+
+func (g *githubIssues) create(ctx context.Context, id string, t Ticket) (string, error) {
+    body := strings.TrimRight(t.Body, "\n")
+    if t.Logs != "" { body += "\n\n```\n" + strings.TrimRight(t.Logs, "\n") + "\n```" }
+    if t.BundleURL != "" { body += "\n\nLog bundle: " + t.BundleURL }
+    if t.RunbookURL != "" { body += "\n\nRunbook: " + t.RunbookURL }
+    in := map[string]interface{}{"title": t.Title, "body": body + "\n\n" + marker(id, 1)}
+    if len(t.Labels) > 0 { in["labels"] = t.Labels }
+    if len(t.Assignees) > 0 { in["assignees"] = t.Assignees }
+    var iss ghIssue
+    err := g.gh.call(ctx, "POST", g.gh.repoURL("/issues"), in, &iss)
+    if IsStatus(err, http.StatusUnprocessableEntity) && in["assignees"] != nil {
+        // An assignee without access to the repository fails the whole request.
+        klog.Warningf("github: create issue with assignees %v: %v; retrying unassigned", t.Assignees, err)
+        delete(in, "assignees")
+        err = g.gh.call(ctx, "POST", g.gh.repoURL("/issues"), in, &iss)
+    }
+    if err != nil { return "", fmt.Errorf("github: create issue: %w", err) }
+    g.remember(id, iss.Number)
+    return iss.HTMLURL, nil
+}
+
+func marker(id string, n int) string { return fmt.Sprintf("<!-- auto-agent:ticket key=%s occurrences=%d -->", id, n) }
+
+func (g *githubIssues) remember(id string, n int) { g.mu.Lock(); g.known[id] = n; g.mu.Unlock() }
+func (g *githubIssues) forget(id string)          { g.mu.Lock(); delete(g.known, id); g.mu.Unlock() }
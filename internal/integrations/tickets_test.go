@@ -0,0 +1,67 @@
+package integrations
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+func newTestIssues(t *testing.T) (*fakeGitHub, Ticketer) {
+    f, u := newFakeGitHub(t)
+    t.Setenv("GITHUB_API_URL", u)
+    return f, NewGitHubIssues("tok", "o/r")
+}
+
+func TestGitHubIssuesLifecycle(t *testing.T) {
+    ctx := context.Background()
+    f, tk := newTestIssues(t)
+    key := "shop/api/CrashLoopBackOff/app"
+    ticket := Ticket{Title: "CrashLoopBackOff: shop/api", Body: "crashed", Logs: "panic: boom\n", BundleURL: "https://logs.test/b1", Labels: []string{"auto-agent"}}
+
+    u, err := tk.CreateOrUpdate(ctx, key, ticket)
+    if err != nil { t.Fatal(err) }
+    if len(f.issues) != 1 { t.Fatalf("%d issues, want 1", len(f.issues)) }
+    iss := f.issues[0]
+    if !strings.Contains(iss.Body, "```\npanic: boom\n```") || !strings.Contains(iss.Body, marker(ticketKey(key), 1)) { t.Errorf("body = %q", iss.Body) }
+
+    // A recurrence comments on the open issue and bumps the marker.
+    ticket.BundleURL = "https://logs.test/b2"
+    if u2, err := tk.CreateOrUpdate(ctx, key, ticket); err != nil || u2 != u { t.Fatalf("recurrence = %s, %v", u2, err) }
+    if len(f.issues) != 1 { t.Fatalf("recurrence opened a second issue") }
+    if !strings.Contains(iss.Body, marker(ticketKey(key), 2)) { t.Errorf("marker not bumped: %q", iss.Body) }
+    if len(iss.Comments) != 1 || !strings.Contains(iss.Comments[0], "occurrence 2") || !strings.Contains(iss.Comments[0], "b2") { t.Errorf("comments = %q", iss.Comments) }
+
+    if got, err := tk.Resolve(ctx, key, "Recovered after 5m."); err != nil || got != u { t.Fatalf("Resolve = %s, %v", got, err) }
+    if iss.State != "closed" || iss.Reason != "completed" || iss.Comments[1] != "Recovered after 5m." { t.Errorf("issue after resolve = %+v", iss) }
+
+    // With the issue closed, the next detection opens a new one.
+    if _, err := tk.CreateOrUpdate(ctx, key, ticket); err != nil { t.Fatal(err) }
+    if len(f.issues) != 2 { t.Fatalf("%d issues, want 2", len(f.issues)) }
+}
+
+func TestGitHubIssuesFindsExistingIssue(t *testing.T) {
+    ctx := context.Background()
+    f, tk := newTestIssues(t)
+    key := "shop/api/OOMKilled/app"
+    // Filed by another replica: only the listing finds it. A PR carrying the
+    // same marker is not an issue.
+    f.issues = append(f.issues,
+        &fakeIssue{Number: 1, State: "open", Body: marker(ticketKey(key), 4), PullRequest: true},
+        &fakeIssue{Number: 2, State: "open", Body: "other\n\n" + marker(ticketKey("x"), 1)},
+        &fakeIssue{Number: 3, State: "open", Body: "oom\n\n" + marker(ticketKey(key), 4)})
+    if _, err := tk.CreateOrUpdate(ctx, key, Ticket{Title: "t"}); err != nil { t.Fatal(err) }
+    if len(f.issues) != 3 { t.Fatalf("opened a duplicate issue") }
+    if !strings.Contains(f.issues[2].Body, marker(ticketKey(key), 5)) || f.issues[0].Body != marker(ticketKey(key), 4) { t.Errorf("wrong issue updated") }
+}
+
+func TestGitHubIssuesRetryWithoutBadAssignee(t *testing.T) {
+    f, tk := newTestIssues(t)
+    f.badUsers["ghost"] = true
+    if _, err := tk.CreateOrUpdate(context.Background(), "k", Ticket{Title: "t", Assignees: []string{"ghost"}}); err != nil { t.Fatal(err) }
+    if len(f.issues) != 1 || len(f.issues[0].Assignees) != 0 { t.Fatalf("issues = %+v", f.issues) }
+}
+
+func TestGitHubIssuesResolveWithoutIssue(t *testing.T) {
+    _, tk := newTestIssues(t)
+    if u, err := tk.Resolve(context.Background(), "none", "note"); u != "" || err != nil { t.Fatalf("Resolve = %q, %v", u, err) }
+}
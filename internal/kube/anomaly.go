@@ -0,0 +1,208 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "sync"
+    "time"
+
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/llm"
+    "github.com/yourorg/auto-agent/internal/metrics"
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// Rule defaults when the CR leaves them empty.
+const (
+    defaultZScore   = 3.0
+    defaultLookback = time.Hour
+)
+
+// minStdDev is the standard deviation assumed for a baseline that varies less,
+// relative to its mean with an absolute floor for a mean of 0. A flat baseline
+// (an error rate or queue depth sitting at 0) would otherwise never breach.
+const (
+    minStdDevRel = 0.01
+    minStdDevAbs = 1e-6
+)
+
+type sample struct {
+    t time.Time
+    v float64
+}
+
+// ruleState is the rolling history and alert state of one anomaly rule.
+type ruleState struct {
+    labels      []string // namespace, policy, rule for the z-score gauge
+    history     []sample
+    breachSince time.Time
+    firing      bool
+    firedAt     time.Time
+    rebased     bool   // the baseline aged out while firing and was rebuilt
+    paged       string // routing key of the open PagerDuty alert
+}
+
+// anomalyTracker keeps per-rule state between leader ticks. It is in-memory;
+// a rule seen for the first time (e.g. after a leader change) is seeded from
+// a range query over its lookback window.
+type anomalyTracker struct {
+    mu    sync.Mutex
+    rules map[string]*ruleState
+}
+
+var anomalies = &anomalyTracker{rules: map[string]*ruleState{}}
+
+// CheckAnomalies evaluates every AnomalyRule of every AutoRemediationPolicy.
+// Each tick the rule's PromQL is sampled; the z-score of the new value is
+// computed against the non-breaching samples seen within the rule's lookback
+// window. An alert fires once at least MinSamples are available and |z| has
+// stayed above the threshold for the rule's "for" duration; a resolved notice
+// follows when it drops back below. With fewer samples the rule is not judged
+// and a firing alert stays open. Outside observe mode both are also sent to
+// PagerDuty.
+func CheckAnomalies(ctx context.Context, kc *kubernetes.Clientset, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client, store *crd.Store, pg *Pager) {
+    now := time.Now()
+    seen := map[string]bool{}
+    for _, p := range store.All() {
+        for _, rule := range p.Anomalies {
+            if rule.PromQL == "" { continue }
+            key := fmt.Sprintf("%s/%s/%s", p.Namespace, p.Name, rule.Name)
+            seen[key] = true
+            anomalies.seed(ctx, mp, key, p, rule, now)
+            v, err := mp.QueryInstant(ctx, rule.PromQL)
+            if err != nil { klog.V(2).Infof("anomaly %s: query: %v", key, err); continue }
+            mode := p.Mode
+            if mode == "" { mode = pol.Mode }
+            evaluateRule(ctx, key, p, rule, v, now, sl, ll, pg, mode)
+        }
+    }
+    // A rule removed while firing would otherwise leave its alert open.
+    gone := map[string]string{}
+    anomalies.mu.Lock()
+    for k := range anomalies.rules {
+        if !seen[k] {
+            if rk := anomalies.rules[k].paged; rk != "" { gone[k] = rk }
+            obs.AnomalyZScore.DeleteLabelValues(anomalies.rules[k].labels...)
+            delete(anomalies.rules, k)
+        }
+    }
+    anomalies.mu.Unlock()
+    for k, rk := range gone { pg.resolveAnomaly(ctx, rk, k) }
+}
+
+// seed creates the state for key, back-filling the history from Prometheus so
+// the rule does not have to wait MinSamples ticks before it can fire.
+func (a *anomalyTracker) seed(ctx context.Context, mp metrics.Provider, key string, p crd.Policy, rule crd.AnomalyRule, now time.Time) {
+    a.mu.Lock()
+    _, ok := a.rules[key]
+    a.mu.Unlock()
+    if ok { return }
+    st := &ruleState{labels: []string{p.Namespace, p.Name, rule.Name}}
+    lookback := parseDur(rule.Lookback)
+    if lookback <= 0 { lookback = defaultLookback }
+    step := parseDur(getenv("ANOMALIES_POLL_INTERVAL", "30s"))
+    if step <= 0 { step = 30 * time.Second }
+    series, err := mp.QueryRange(ctx, rule.PromQL, now.Add(-lookback), now.Add(-step), step)
+    err = metrics.IgnoreWarnings(rule.PromQL, err)
+    if err != nil {
+        klog.V(2).Infof("anomaly %s: seed: %v", key, err)
+    } else if len(series) > 0 {
+        for _, pt := range series[0].Points {
+            if !math.IsNaN(pt.Value) { st.history = append(st.history, sample{pt.Time, pt.Value}) }
+        }
+    }
+    a.mu.Lock()
+    if _, ok := a.rules[key]; !ok { a.rules[key] = st }
+    a.mu.Unlock()
+}
+
+func evaluateRule(ctx context.Context, key string, p crd.Policy, rule crd.AnomalyRule, v float64, now time.Time, sl *slack.Client, ll *llm.Client, pg *Pager, mode policy.Mode) {
+    lookback := parseDur(rule.Lookback)
+    if lookback <= 0 { lookback = defaultLookback }
+    hold := parseDur(rule.For)
+    thr := rule.ZScoreThreshold
+    if thr <= 0 { thr = defaultZScore }
+    minSamples := rule.MinSamples
+    if minSamples <= 0 { minSamples = parseInt(getenv("MIN_SAMPLES", "12")) }
+
+    anomalies.mu.Lock()
+    st, ok := anomalies.rules[key]
+    if !ok { st = &ruleState{labels: []string{p.Namespace, p.Name, rule.Name}}; anomalies.rules[key] = st }
+    // The baseline excludes the sample being judged, and breaching samples
+    // never join it: a sustained step change would otherwise raise the
+    // baseline until it stops breaching before "for" has passed.
+    i := 0
+    for i < len(st.history) && now.Sub(st.history[i].t) > lookback { i++ }
+    st.history = st.history[i:]
+    base := st.history
+    mean, sd := meanStd(base)
+
+    var z float64
+    breach := false
+    judged := len(base) >= minSamples
+    if judged {
+        sd = math.Max(sd, math.Max(math.Abs(mean)*minStdDevRel, minStdDevAbs))
+        z = (v - mean) / sd
+        breach = math.Abs(z) >= thr
+    }
+    if !breach { st.history = append(st.history, sample{now, v}) }
+    var fire, resolve bool
+    switch {
+    case !judged:
+        // Too short a baseline says nothing about the value: a firing alert
+        // stays open until there are enough samples to judge again.
+        if st.firing { st.rebased = true } else { st.breachSince = time.Time{} }
+    case breach:
+        if st.breachSince.IsZero() { st.breachSince = now }
+        if !st.firing && now.Sub(st.breachSince) >= hold {
+            st.firing, st.firedAt, fire = true, now, true
+        }
+    default:
+        st.breachSince = time.Time{}
+        if st.firing { st.firing, resolve = false, true }
+    }
+    firedAt, paged, rebased := st.firedAt, st.paged, st.rebased
+    if fire && mode != policy.Observe { st.paged = pg.routingKeyFor(p.PagerDutyRoutingKey) }
+    if resolve { st.paged, st.rebased = "", false }
+    anomalies.mu.Unlock()
+
+    obs.AnomalyZScore.WithLabelValues(p.Namespace, p.Name, rule.Name).Set(z)
+    switch {
+    case fire:
+        msg := fmt.Sprintf("*Anomaly* `%s` (policy `%s/%s`): value=%.4g, baseline mean=%.4g sd=%.4g over %s (%d samples), z=%.2f ≥ %.2f",
+            rule.Name, p.Namespace, p.Name, v, mean, sd, lookback, len(base), z, thr)
+        if hold > 0 { msg += fmt.Sprintf(", sustained %s", hold) }
+        msg += "\n"
+        if ll.Enabled() {
+            advice, _ := ll.Diagnose("Metric anomaly: "+rule.Name, fmt.Sprintf("PromQL: %s\n%s", rule.PromQL, msg))
+            if advice != "" { msg += "\n_LLM_: " + advice + "\n" }
+        }
+        if p.RunbookURL != "" { msg += fmt.Sprintf("<%s|runbook>\n", p.RunbookURL) }
+        if mode != policy.Observe {
+            msg += pg.triggerAnomaly(ctx, key, p, rule, fmt.Sprintf("Anomaly %s (policy %s/%s): value=%.4g, z=%.2f", rule.Name, p.Namespace, p.Name, v, z),
+                map[string]string{"value": fmt.Sprintf("%.4g", v), "mean": fmt.Sprintf("%.4g", mean), "sd": fmt.Sprintf("%.4g", sd), "zscore": fmt.Sprintf("%.2f", z)})
+        }
+        _ = sl.PostTo(p.SlackChannel, msg)
+        obs.IncidentsTotal.WithLabelValues("Anomaly", p.Namespace, p.Name).Inc()
+    case resolve:
+        pg.resolveAnomaly(ctx, paged, key)
+        how := fmt.Sprintf("back within %.2f sd", thr)
+        if rebased { how = "within the rebuilt baseline: the shift has become the new normal" }
+        _ = sl.PostTo(p.SlackChannel, fmt.Sprintf("*Resolved* anomaly `%s` (policy `%s/%s`): value=%.4g %s after %s",
+            rule.Name, p.Namespace, p.Name, v, how, now.Sub(firedAt).Round(time.Second)))
+    }
+}
+
+func meanStd(xs []sample) (mean, sd float64) {
+    if len(xs) == 0 { return 0, 0 }
+    for _, s := range xs { mean += s.v }
+    mean /= float64(len(xs))
+    for _, s := range xs { sd += (s.v - mean) * (s.v - mean) }
+    return mean, math.Sqrt(sd / float64(len(xs)))
+}
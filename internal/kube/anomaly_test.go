@@ -0,0 +1,158 @@
+package kube
+
+import (
+    "context"
+    "encoding/json"
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/llm"
+    "github.com/yourorg/auto-agent/internal/metrics"
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// slackHook stands in for an incoming webhook and records the posted texts.
+func slackHook(t *testing.T) (*slack.Client, func() []string) {
+    var mu sync.Mutex
+    var got []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var m slack.Message
+        _ = json.NewDecoder(r.Body).Decode(&m)
+        mu.Lock(); got = append(got, m.Text); mu.Unlock()
+    }))
+    t.Cleanup(srv.Close)
+    return slack.New(srv.URL), func() []string { mu.Lock(); defer mu.Unlock(); return append([]string(nil), got...) }
+}
+
+// repeat returns n copies of v.
+func repeat(v float64, n int) []float64 {
+    out := make([]float64, n)
+    for i := range out { out[i] = v }
+    return out
+}
+
+// noisy returns n samples alternating 10 and 12: mean 11, sd 1.
+func noisy(n int) []float64 {
+    out := make([]float64, n)
+    for i := range out { out[i] = 10 + float64(2*(i%2)) }
+    return out
+}
+
+func TestEvaluateRule(t *testing.T) {
+    tests := []struct {
+        name   string
+        rule   crd.AnomalyRule
+        values []float64 // one per 30s tick
+        want   []string  // "fire@<tick>" / "resolve@<tick>"
+        how    string    // text the resolved notice must contain
+    }{
+        {name: "minSamples gate", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(noisy(5), 50), want: nil},
+        {name: "fires once", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(noisy(6), 50, 50, 50), want: []string{"fire@6"}},
+        {name: "for holds the alert", rule: crd.AnomalyRule{MinSamples: 6, For: "1m"},
+            values: append(noisy(6), 50, 50, 50), want: []string{"fire@8"}},
+        {name: "breach shorter than for", rule: crd.AnomalyRule{MinSamples: 6, For: "1m"},
+            values: append(noisy(6), 50, 50, 11, 50), want: nil},
+        {name: "resolves when back", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(noisy(6), 50, 11), want: []string{"fire@6", "resolve@7"}, how: "back within 3.00 sd"},
+        {name: "negative z", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(noisy(6), -30), want: []string{"fire@6"}},
+        {name: "flat zero baseline", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(repeat(0, 6), 500), want: []string{"fire@6"}},
+        {name: "flat baseline tolerates small noise", rule: crd.AnomalyRule{MinSamples: 6},
+            values: append(repeat(100, 6), 102), want: nil},
+        // The baseline ages out while the shift lasts: the alert stays open
+        // until the new level has rebuilt a baseline.
+        {name: "sustained shift", rule: crd.AnomalyRule{MinSamples: 4, Lookback: "3m"},
+            values: append(noisy(6), repeat(50, 12)...), want: []string{"fire@6", "resolve@13"}, how: "new normal"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            anomalies = &anomalyTracker{rules: map[string]*ruleState{}}
+            sl, posted := slackHook(t)
+            p := crd.Policy{Namespace: "shop", Name: "api"}
+            tt.rule.Name = "r"
+            now := time.Unix(1700000000, 0)
+            var got []string
+            var texts []string
+            for i, v := range tt.values {
+                before := len(posted())
+                evaluateRule(context.Background(), "shop/api/r", p, tt.rule, v, now.Add(time.Duration(i)*30*time.Second), sl, &llm.Client{}, nil, policy.Fix)
+                for _, m := range posted()[before:] {
+                    texts = append(texts, m)
+                    switch {
+                    case strings.HasPrefix(m, "*Anomaly*"):
+                        got = append(got, "fire@"+strconv.Itoa(i))
+                    case strings.HasPrefix(m, "*Resolved*"):
+                        got = append(got, "resolve@"+strconv.Itoa(i))
+                    }
+                }
+            }
+            if strings.Join(got, " ") != strings.Join(tt.want, " ") { t.Fatalf("events = %v, want %v\n%s", got, tt.want, strings.Join(texts, "\n")) }
+            if tt.how != "" && !strings.Contains(texts[len(texts)-1], tt.how) { t.Errorf("resolved notice = %q, want %q", texts[len(texts)-1], tt.how) }
+        })
+    }
+}
+
+func TestMeanStd(t *testing.T) {
+    tests := []struct {
+        xs       []float64
+        mean, sd float64
+    }{
+        {xs: nil, mean: 0, sd: 0},
+        {xs: []float64{5}, mean: 5, sd: 0},
+        {xs: []float64{10, 12}, mean: 11, sd: 1},
+        {xs: []float64{2, 4, 4, 4, 5, 5, 7, 9}, mean: 5, sd: 2},
+    }
+    for _, tt := range tests {
+        var ss []sample
+        for _, x := range tt.xs { ss = append(ss, sample{v: x}) }
+        mean, sd := meanStd(ss)
+        if math.Abs(mean-tt.mean) > 1e-9 || math.Abs(sd-tt.sd) > 1e-9 { t.Errorf("meanStd(%v) = %v, %v, want %v, %v", tt.xs, mean, sd, tt.mean, tt.sd) }
+    }
+}
+
+// constProvider answers every instant query with v and has no history.
+type constProvider struct{ v float64 }
+
+func (c constProvider) AvgWorkloadCPU(context.Context, metrics.Workload, string) (float64, error) { return 0, metrics.ErrUnsupported }
+func (c constProvider) QueryInstant(context.Context, string) (float64, error)                    { return c.v, nil }
+func (c constProvider) QueryVector(context.Context, string) ([]metrics.Sample, error)             { return nil, metrics.ErrUnsupported }
+func (c constProvider) QueryRange(context.Context, string, time.Time, time.Time, time.Duration) ([]metrics.Series, error) {
+    return nil, nil
+}
+
+func TestCheckAnomaliesRemovedRule(t *testing.T) {
+    anomalies = &anomalyTracker{rules: map[string]*ruleState{}}
+    events := pdEvents(t)
+    pg := NewPagerFromEnv()
+    sl, _ := slackHook(t)
+    ctx := context.Background()
+    store := crd.NewStore()
+    p := crd.Policy{Namespace: "gone", Name: "api", Anomalies: []crd.AnomalyRule{{Name: "r", PromQL: "up", MinSamples: 1}}}
+    store.Update("gone", []crd.Policy{p})
+
+    // Seed a firing alert, then let the poll see the rule.
+    evaluateRule(ctx, "gone/api/r", p, p.Anomalies[0], 1, time.Now(), sl, &llm.Client{}, pg, policy.Fix)
+    evaluateRule(ctx, "gone/api/r", p, p.Anomalies[0], 500, time.Now(), sl, &llm.Client{}, pg, policy.Fix)
+    CheckAnomalies(ctx, nil, constProvider{v: 500}, &policy.Policy{Mode: policy.Fix}, sl, &llm.Client{}, store, pg)
+    n := testutil.CollectAndCount(obs.AnomalyZScore)
+
+    store.Update("gone", nil)
+    CheckAnomalies(ctx, nil, constProvider{v: 500}, &policy.Policy{Mode: policy.Fix}, sl, &llm.Client{}, store, pg)
+    if got := testutil.CollectAndCount(obs.AnomalyZScore); got != n-1 { t.Errorf("%d z-score series after removal, want %d", got, n-1) }
+    if len(anomalies.rules) != 0 { t.Errorf("state kept for %v", anomalies.rules) }
+    if len(*events) != 2 || (*events)[0] != "trigger anomaly/gone/api/r" || (*events)[1] != "resolve anomaly/gone/api/r" { t.Errorf("events = %q", *events) }
+}
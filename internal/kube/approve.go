@@ -0,0 +1,202 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/integrations"
+    "github.com/yourorg/auto-agent/internal/metrics"
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// propose enqueues a and returns the Slack line announcing it plus the pending
+// action ID. The line is empty when the same action is already pending, so
+// repeated detections stay quiet.
+func propose(ctx context.Context, q *approval.Queue, a approval.Action) (line, id string) {
+    pa, created, err := q.Propose(ctx, a)
+    if err != nil { return fmt.Sprintf("_Suggest_: %s (approval queue unavailable: %v)\n", a.Summary, err), "" }
+    if !created { return "", "" }
+    return fmt.Sprintf("_Suggest_: %s. Pending action `%s`, approve with `POST /approvals/%s/approve` before %s.\n",
+        a.Summary, pa.ID, pa.ID, pa.ExpiresAt.Format(time.RFC3339)), pa.ID
+}
+
+// postIncident posts msg to channel (empty: default), with Approve / Reject /
+// Snooze buttons when it announces a pending action.
+func postIncident(sl *slack.Client, channel, msg, pendingID string) error {
+    var err error
+    if pendingID == "" {
+        err = sl.PostTo(channel, msg)
+    } else {
+        m := slack.ApprovalMessage(msg, pendingID, sl.Snooze)
+        m.Channel = channel
+        err = sl.PostMessage(m)
+    }
+    if err != nil { klog.Warningf("slack: post incident (pending %q): %v", pendingID, err) }
+    return err
+}
+
+// postPodIncident posts a pod incident. The first line of msg is the
+// headline; the rest (actions, ticket and paging lines) and the LLM advice
+// follow. With the webhook this is one message as before. A Slack bot posts
+// the headline and policy footer as the incident's parent message and the
+// rest as thread replies; repeated detections of key reply in that thread.
+func postPodIncident(sl *slack.Client, r remediation, key, msg, advice, pendingID string) error {
+    llm := ""
+    if advice != "" { llm = "_LLM_: " + advice + "\n" }
+    if !sl.Bot() { return postIncident(sl, r.SlackChannel, msg+llm+r.footer(), pendingID) }
+    head, rest, _ := strings.Cut(msg, "\n")
+    body := slack.Message{Text: rest}
+    if pendingID != "" && rest != "" { body = slack.ApprovalMessage(rest, pendingID, sl.Snooze) }
+    err := sl.PostIncident(key, slack.Message{Channel: r.SlackChannel, Text: head + "\n" + r.footer()}, body, slack.Message{Text: llm})
+    if err != nil { klog.Warningf("slack: post incident %s (pending %q): %v", key, pendingID, err) }
+    return err
+}
+
+// proposeScale queues a scaling decision; hpa names the HPA whose bounds are
+// moved instead of the replica count, if any.
+func proposeScale(ctx context.Context, q *approval.Queue, w *workload, from, to int32, direction string, cpu float64, hpa string) (string, string) {
+    a := approval.Action{
+        Kind: approval.Scale, Namespace: w.Namespace, Target: strings.ToLower(w.Kind) + "/" + w.Name, Workload: w.Name, Labels: w.Template.Labels,
+        Params: map[string]string{"replicas": strconv.Itoa(int(to)), "direction": direction, "resource": gvrString(w.GVR)},
+        Summary: fmt.Sprintf("scale %s %d → %d%s", w, from, to, fmtCPU(cpu)),
+    }
+    if hpa != "" {
+        a.Params["hpa"] = hpa
+        a.Summary += fmt.Sprintf(" via HPA `%s`", hpa)
+    }
+    return propose(ctx, q, a)
+}
+
+// ExecuteApproved returns the executor for approved actions. Execution still
+// goes through the guard, so budgets and cooldowns apply at run time; an
+// action that then fails gives its budget back.
+func ExecuteApproved(kc *kubernetes.Clientset, dyn dynamic.Interface, g *guard.Guard, gops *GitOps) approval.Executor {
+    return func(ctx context.Context, a *approval.Action) (_ string, err error) {
+        ga := guard.Action{Type: string(a.Kind), Reason: a.Reason, Namespace: a.Namespace, Workload: budgetWorkload(a.Workload, a.Labels), Labels: a.Labels}
+        if a.Kind == approval.Scale { ga.Workload = a.Target }
+        taken := false
+        allow := func() error { err := g.Allow(ctx, ga); taken = err == nil; return err }
+        defer func() { if err != nil && taken { g.Refund(ctx, ga) } }()
+        switch a.Kind {
+        case approval.DeletePod:
+            if err := allow(); err != nil { return "", err }
+            if err := kc.CoreV1().Pods(a.Namespace).Delete(ctx, a.Target, metav1.DeleteOptions{}); err != nil { return "", err }
+            obs.ActionsTotal.WithLabelValues("delete_pod", a.Namespace, a.Workload).Inc()
+            return fmt.Sprintf("deleted pod %s/%s", a.Namespace, a.Target), nil
+        case approval.EvictPod:
+            if err := allow(); err != nil { return "", err }
+            gr := int64(30)
+            ev := &policyv1.Eviction{
+                ObjectMeta: metav1.ObjectMeta{Namespace: a.Namespace, Name: a.Target},
+                DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: &gr},
+            }
+            if err := kc.PolicyV1().Evictions(a.Namespace).Evict(ctx, ev); err != nil { return "", err }
+            obs.ActionsTotal.WithLabelValues("evict_pod", a.Namespace, a.Workload).Inc()
+            return fmt.Sprintf("evicted pod %s/%s", a.Namespace, a.Target), nil
+        case approval.Scale:
+            n, err := strconv.Atoi(a.Params["replicas"])
+            if err != nil { return "", fmt.Errorf("bad replicas param %q", a.Params["replicas"]) }
+            ga.Type = "scale_" + a.Params["direction"]
+            if err := allow(); err != nil { return "", err }
+            gvr := deploymentsGVR // actions queued before the resource param existed
+            if s := a.Params["resource"]; s != "" {
+                if gvr, err = parseGVR(s); err != nil { return "", err }
+            }
+            rep := int32(n)
+            var res string
+            if h := a.Params["hpa"]; h != "" {
+                desc, err := scaleViaHPA(ctx, kc, a.Namespace, h, rep)
+                if err != nil { return "", err }
+                res = fmt.Sprintf("scaled %s via %s", a.Target, desc)
+            } else {
+                var from int32
+                var c *changes.Change
+                if gops.live() {
+                    kind, _, _ := strings.Cut(a.Target, "/")
+                    w := &workload{Workload: metrics.Workload{Kind: kind, Namespace: a.Namespace, Name: a.Workload}, GVR: gvr}
+                    from, c, err = gops.scaleLive(ctx, w, rep, ga.Type)
+                } else {
+                    from, err = scaleTo(ctx, dyn, gvr, a.Namespace, a.Workload, rep)
+                }
+                if err != nil { return "", err }
+                res = fmt.Sprintf("scaled %s/%s %d → %d", a.Namespace, a.Target, from, rep)
+                if c != nil { res += fmt.Sprintf("; change `%s`, revert with `POST /changes/%s/revert`", c.ID, c.ID) }
+            }
+            if err := markScaled(ctx, dyn, gvr, a.Namespace, a.Workload, a.Params["direction"]); err != nil { res += fmt.Sprintf(" (cooldown annotation failed: %v)", err) }
+            obs.ActionsTotal.WithLabelValues(ga.Type, a.Namespace, a.Workload).Inc()
+            return res, nil
+        case approval.MemoryBump:
+            if gops == nil { return "", fmt.Errorf("gitops is not configured") }
+            b, evidence, err := memoryBumpFrom(a)
+            if err != nil { return "", err }
+            if err := allow(); err != nil { return "", err }
+            if gops.live() {
+                c, err := b.applyLive(ctx, gops)
+                if err != nil { return "", err }
+                obs.ActionsTotal.WithLabelValues("memory_bump", a.Namespace, a.Workload).Inc()
+                return fmt.Sprintf("raised the %s; change `%s`, revert with `POST /changes/%s/revert`", b, c.ID, c.ID), nil
+            }
+            pr, err := b.apply(ctx, gops, evidence)
+            if err == integrations.ErrNoChange { g.Refund(ctx, ga); return fmt.Sprintf("%s already sets the memory limit to at least %s", gops.ValuesFile, b.To.String()), nil }
+            if err != nil { return "", err }
+            obs.ActionsTotal.WithLabelValues("memory_bump", a.Namespace, a.Workload).Inc()
+            return fmt.Sprintf("opened %s raising the %s", pr, b), nil
+        case approval.ImageMirror:
+            if !gops.live() { return "", fmt.Errorf("image swaps need gitops.mode live") }
+            if err := allow(); err != nil { return "", err }
+            p := a.Params
+            c, err := swapImage(ctx, gops, a.Namespace, p["kind"], p["workload"], p["container"], p["image"])
+            if err != nil { return "", err }
+            obs.ActionsTotal.WithLabelValues("image_mirror", a.Namespace, a.Workload).Inc()
+            return fmt.Sprintf("%s; change `%s`, revert with `POST /changes/%s/revert`", c.Summary, c.ID, c.ID), nil
+        default:
+            return "", fmt.Errorf("no executor for %s", a.Kind)
+        }
+    }
+}
+
+// NotifyDecision reports a pending action's state to Slack. A due reminder
+// (snooze over) is re-posted with buttons; any other state replaces the
+// original button message when its response_url is known, else it is posted.
+// Approval acknowledges the incident's PagerDuty alert.
+func NotifyDecision(sl *slack.Client, pg *Pager) func(*approval.Action) {
+    return func(a *approval.Action) {
+        pg.acknowledge(context.Background(), a)
+        if a.State == approval.Pending && a.SnoozedUntil.IsZero() {
+            _ = postIncident(sl, a.Meta[approval.MetaSlackChannel], fmt.Sprintf("*Reminder*: %s\nPending action `%s` expires %s.", a.Summary, a.ID, a.ExpiresAt.Format(time.RFC3339)), a.ID)
+            return
+        }
+        m := DecisionMessage(a)
+        m.Channel = a.Meta[approval.MetaSlackChannel]
+        if u := a.Meta[approval.MetaSlackResponseURL]; u != "" {
+            m.ReplaceOriginal = true
+            if sl.Respond(u, m) == nil { return }
+            m.ReplaceOriginal = false
+        }
+        _ = sl.PostMessage(m)
+    }
+}
+
+// DecisionMessage summarises who decided on a and what happened.
+func DecisionMessage(a *approval.Action) slack.Message {
+    state := string(a.State)
+    if a.State == approval.Pending && !a.SnoozedUntil.IsZero() { state = "snoozed" }
+    msg := fmt.Sprintf("*Pending action* `%s` (%s): *%s*", a.ID, a.Summary, state)
+    if a.DecidedBy != "" { msg += " by " + a.DecidedBy }
+    if !a.SnoozedUntil.IsZero() { msg += " until " + a.SnoozedUntil.Format(time.RFC3339) }
+    if a.Result != "" { msg += "\n" + a.Result }
+    return slack.Message{Text: msg, Blocks: []slack.Block{slack.Section(msg)}}
+}
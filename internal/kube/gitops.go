@@ -0,0 +1,90 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+
+    "k8s.io/client-go/dynamic"
+
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/helmvalues"
+    "github.com/yourorg/auto-agent/internal/integrations"
+)
+
+// GitOps is the setup shared by remediations that change a workload's
+// configuration: with Mode "pr" they edit the Helm values file through a PR,
+// with Mode "live" they patch the owning workload and record the change in
+// Changes. A nil *GitOps means neither is configured and those remediations
+// only recommend.
+type GitOps struct {
+    Mode       string // pr|live
+    Client     integrations.GitOps
+    Provider   string
+    ValuesFile string
+    Paths      helmvalues.Mapping
+    Labels, Assignees, Reviewers []string
+    Changes    *changes.Ledger
+
+    dyn dynamic.Interface
+}
+
+// NewGitOpsFromEnv builds the setup from GITOPS_* and GIT_TOKEN. PR mode
+// returns nil when no repository or token is set; live mode only needs the
+// dynamic client and the ledger.
+func NewGitOpsFromEnv(dyn dynamic.Interface, ledger *changes.Ledger) (*GitOps, error) {
+    mode := getenv("GITOPS_MODE", "pr")
+    if mode == "live" { return &GitOps{Mode: mode, Changes: ledger, dyn: dyn}, nil }
+    if mode != "pr" { return nil, fmt.Errorf("gitops: unknown mode %q", mode) }
+    repo, token := os.Getenv("GITOPS_REPO"), os.Getenv("GIT_TOKEN")
+    if repo == "" || token == "" { return nil, nil }
+    paths, err := helmvalues.MappingFromEnv()
+    if err != nil { return nil, err }
+    g := &GitOps{
+        Mode: mode, Provider: getenv("GITOPS_PROVIDER", "github"), ValuesFile: getenv("GITOPS_VALUES_FILE", "values.yaml"), Paths: paths,
+        Labels: splitList(os.Getenv("GITOPS_LABELS")), Assignees: splitList(os.Getenv("GITOPS_ASSIGNEES")), Reviewers: splitList(os.Getenv("GITOPS_REVIEWERS")),
+    }
+    branch := getenv("GITOPS_BRANCH", "main")
+    switch g.Provider {
+    case "github":
+        g.Client = integrations.NewGitHub(token, repo, branch)
+    case "gitlab":
+        g.Client = integrations.NewGitLab(token, repo, branch)
+    default:
+        return nil, fmt.Errorf("gitops: unknown provider %q", g.Provider)
+    }
+    return g, nil
+}
+
+func splitList(s string) []string {
+    var out []string
+    for _, v := range strings.Split(s, ",") {
+        if v = strings.TrimSpace(v); v != "" { out = append(out, v) }
+    }
+    return out
+}
+
+// valuesChange is a values-file edit proposed as one PR.
+type valuesChange struct {
+    Key, Title, Body string
+    Edits            []helmvalues.Edit
+}
+
+// propose applies c to the values file on the base branch and opens (or
+// updates) its PR. It returns the PR URL and the rendered diff; err is
+// integrations.ErrNoChange when the file already has the values.
+func (g *GitOps) propose(ctx context.Context, c valuesChange) (url, diff string, err error) {
+    cur, err := g.Client.ReadFile(ctx, g.ValuesFile)
+    if err != nil { return "", "", err }
+    next, err := helmvalues.Patch(cur, c.Edits...)
+    if err != nil { return "", "", err }
+    diff = helmvalues.Diff(g.ValuesFile, cur, next, 2)
+    if diff == "" { return "", "", integrations.ErrNoChange }
+    body := c.Body + "\n```diff\n" + diff + "```\n"
+    url, err = g.Client.OpenPR(ctx, integrations.GitOpsChange{
+        Key: c.Key, FilePath: g.ValuesFile, Content: next, Title: c.Title, Body: body,
+        Labels: g.Labels, Assignees: g.Assignees, Reviewers: g.Reviewers,
+    })
+    return url, diff, err
+}
@@ -0,0 +1,61 @@
+package kube
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
+)
+
+// hpaIndex maps "Kind/name" of a scale target to the HPA driving it.
+type hpaIndex map[string]*autoscalingv2.HorizontalPodAutoscaler
+
+func listHPAs(ctx context.Context, kc kubernetes.Interface, ns string) (hpaIndex, error) {
+    l, err := kc.AutoscalingV2().HorizontalPodAutoscalers(ns).List(ctx, metav1.ListOptions{})
+    if err != nil { return nil, err }
+    ix := hpaIndex{}
+    for i := range l.Items {
+        h := &l.Items[i]
+        ix[h.Spec.ScaleTargetRef.Kind+"/"+h.Spec.ScaleTargetRef.Name] = h
+    }
+    return ix, nil
+}
+
+func (ix hpaIndex) For(kind, name string) *autoscalingv2.HorizontalPodAutoscaler {
+    return ix[kind+"/"+name]
+}
+
+// hpaBounds computes the HPA bounds that move the workload towards to
+// replicas: scaling up raises minReplicas (and maxReplicas if needed), scaling
+// down only lowers minReplicas so the HPA may follow.
+func hpaBounds(h *autoscalingv2.HorizontalPodAutoscaler, to int32) (min, max int32) {
+    min, max = 1, h.Spec.MaxReplicas
+    if h.Spec.MinReplicas != nil { min = *h.Spec.MinReplicas }
+    if to < 1 { to = 1 }
+    switch {
+    case to > min:
+        min = to
+        if max < to { max = to }
+    case to < min:
+        min = to
+    }
+    return min, max
+}
+
+// scaleViaHPA moves the bounds of HPA ns/name so that it settles at to
+// replicas, and returns a description of the change.
+func scaleViaHPA(ctx context.Context, kc kubernetes.Interface, ns, name string, to int32) (string, error) {
+    h, err := kc.AutoscalingV2().HorizontalPodAutoscalers(ns).Get(ctx, name, metav1.GetOptions{})
+    if err != nil { return "", err }
+    oldMin := int32(1); if h.Spec.MinReplicas != nil { oldMin = *h.Spec.MinReplicas }
+    oldMax := h.Spec.MaxReplicas
+    min, max := hpaBounds(h, to)
+    if min == oldMin && max == oldMax { return fmt.Sprintf("HPA `%s` already at min %d / max %d", name, min, max), nil }
+    patch, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"minReplicas": min, "maxReplicas": max}})
+    if _, err := kc.AutoscalingV2().HorizontalPodAutoscalers(ns).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil { return "", err }
+    return fmt.Sprintf("HPA `%s` min %d → %d, max %d → %d", name, oldMin, min, oldMax, max), nil
+}
@@ -0,0 +1,155 @@
+package kube
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/types"
+
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// fieldManager owns the fields auto-agent patches, so server-side apply users
+// see who changed them.
+const fieldManager = "auto-agent"
+
+var daemonSetsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
+
+// podTemplateGVR maps the owner kinds whose pod template can be patched.
+func podTemplateGVR(kind string) (schema.GroupVersionResource, error) {
+    switch kind {
+    case "Deployment":
+        return deploymentsGVR, nil
+    case "StatefulSet":
+        return statefulSetsGVR, nil
+    case "DaemonSet":
+        return daemonSetsGVR, nil
+    case "ReplicaSet":
+        return replicaSetsGVR, nil
+    }
+    return schema.GroupVersionResource{}, fmt.Errorf("cannot live-patch the pod template of a %s", kind)
+}
+
+// live reports whether remediations patch workloads directly (gitops.mode:
+// live) instead of opening PRs.
+func (g *GitOps) live() bool { return g != nil && g.Mode == "live" }
+
+// patchLive applies c.Patch to the workload as fieldManager and records c in
+// the ledger so it can be reverted.
+func (g *GitOps) patchLive(ctx context.Context, c changes.Change) (*changes.Change, error) {
+    if err := g.applyPatch(ctx, &c, c.Patch); err != nil { return nil, err }
+    rec, err := g.Changes.Record(ctx, c)
+    if err != nil { return nil, fmt.Errorf("applied but not recorded, revert by hand: %w", err) }
+    return rec, nil
+}
+
+// Revert puts back the previous values of a recorded change.
+func (g *GitOps) Revert(ctx context.Context, id, by string) (*changes.Change, error) {
+    if g == nil || g.Changes == nil { return nil, fmt.Errorf("live mode is not enabled") }
+    return g.Changes.Revert(ctx, id, by, func(ctx context.Context, c *changes.Change) error { return g.applyPatch(ctx, c, c.Revert) })
+}
+
+func (g *GitOps) applyPatch(ctx context.Context, c *changes.Change, patch []byte) error {
+    gvr, err := parseGVR(c.Resource)
+    if err != nil { return err }
+    var sub []string
+    if c.Subresource != "" { sub = append(sub, c.Subresource) }
+    _, err = g.dyn.Resource(gvr).Namespace(c.Namespace).Patch(ctx, c.Name, types.PatchType(c.PatchType), patch, metav1.PatchOptions{FieldManager: fieldManager}, sub...)
+    if err != nil { return fmt.Errorf("patch %s %s/%s: %w", c.Kind, c.Namespace, c.Name, err) }
+    return nil
+}
+
+// containerChange builds a strategic-merge change setting one field of a
+// container in the pod template of kind/name. The previous value is read
+// from the live template; a field that was unset is removed again on revert.
+func (g *GitOps) containerChange(ctx context.Context, ns, kind, name, container string, path []string, value string) (changes.Change, error) {
+    c := changes.Change{Namespace: ns, Kind: kind, Name: name, PatchType: string(types.StrategicMergePatchType)}
+    gvr, err := podTemplateGVR(kind)
+    if err != nil { return c, err }
+    c.Resource = gvrString(gvr)
+    obj, err := g.dyn.Resource(gvr).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+    if err != nil { return c, err }
+    cs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+    var prev interface{}
+    found := false
+    for _, x := range cs {
+        m, ok := x.(map[string]interface{})
+        if !ok || m["name"] != container { continue }
+        found = true
+        if v, ok, _ := unstructured.NestedFieldNoCopy(m, path...); ok { prev = v }
+    }
+    if !found { return c, fmt.Errorf("%s %s/%s has no container %q", kind, ns, name, container) }
+    field := strings.Join(path, ".")
+    c.Previous = map[string]string{container + "." + field: fmt.Sprint(prev)}
+    if prev == nil { c.Previous[container+"."+field] = "" }
+    if c.Patch, err = containerPatch(container, path, value); err != nil { return c, err }
+    if c.Revert, err = containerPatch(container, path, prev); err != nil { return c, err }
+    return c, nil
+}
+
+// containerPatch renders {"spec":{"template":{"spec":{"containers":[{"name":
+// container, <path>: value}]}}}}; containers merge by name.
+func containerPatch(container string, path []string, value interface{}) ([]byte, error) {
+    ctr := map[string]interface{}{"name": container}
+    m := ctr
+    for _, p := range path[:len(path)-1] {
+        next := map[string]interface{}{}
+        m[p] = next
+        m = next
+    }
+    m[path[len(path)-1]] = value
+    return json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{ctr}}}}})
+}
+
+// swapImage live-patches the image of one container of kind/name.
+func swapImage(ctx context.Context, gops *GitOps, ns, kind, name, container, image string) (*changes.Change, error) {
+    c, err := gops.containerChange(ctx, ns, kind, name, container, []string{"image"}, image)
+    if err != nil { return nil, err }
+    c.Summary, c.Reason = fmt.Sprintf("set %s `%s/%s` container `%s` image to `%s`", kind, ns, name, container, image), "ImagePullBackOff"
+    return gops.patchLive(ctx, c)
+}
+
+// scaleLive sets the replicas of w to `to` and records the change. Built-in
+// workloads get a strategic-merge patch on the object; custom resources only
+// expose replicas through their /scale subresource, which takes a merge patch.
+// It returns the replica count it replaced.
+func (g *GitOps) scaleLive(ctx context.Context, w *workload, to int32, reason string) (int32, *changes.Change, error) {
+    c := changes.Change{
+        Namespace: w.Namespace, Kind: w.Kind, Name: w.Name, Resource: gvrString(w.GVR),
+        PatchType: string(types.StrategicMergePatchType), Summary: fmt.Sprintf("scale %s to %d", w, to), Reason: reason,
+    }
+    if w.GVR != deploymentsGVR && w.GVR != statefulSetsGVR && w.GVR != replicaSetsGVR { c.Subresource, c.PatchType = "scale", string(types.MergePatchType) }
+    var sub []string
+    if c.Subresource != "" { sub = append(sub, c.Subresource) }
+    obj, err := g.dyn.Resource(w.GVR).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{}, sub...)
+    if err != nil { return 0, nil, err }
+    cur, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+    from := int32(cur)
+    patch := func(n int32) json.RawMessage { return json.RawMessage(fmt.Sprintf(`{"spec":{"replicas":%d}}`, n)) }
+    c.Patch, c.Revert = patch(to), patch(from)
+    c.Previous = map[string]string{"replicas": fmt.Sprint(from)}
+    c.Summary = fmt.Sprintf("scale %s %d → %d", w, from, to)
+    rec, err := g.patchLive(ctx, c)
+    return from, rec, err
+}
+
+// RevertChange reverts a recorded change and announces it in Slack.
+func RevertChange(gops *GitOps, sl *slack.Client) func(context.Context, string, string) (*changes.Change, error) {
+    return func(ctx context.Context, id, by string) (*changes.Change, error) {
+        c, err := gops.Revert(ctx, id, by)
+        if err != nil { return c, err }
+        _ = sl.Post(fmt.Sprintf("*Reverted* change `%s` (%s) by %s.", c.ID, c.Summary, by))
+        return c, nil
+    }
+}
+
+// revertLine is appended to Slack messages announcing a live change.
+func revertLine(c *changes.Change) string {
+    return fmt.Sprintf("_Live_: change `%s`, revert with `POST /changes/%s/revert`.\n", c.ID, c.ID)
+}
@@ -0,0 +1,201 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/helmvalues"
+    "github.com/yourorg/auto-agent/internal/integrations"
+    "github.com/yourorg/auto-agent/internal/policy"
+)
+
+// oomSeen remembers handled OOM kills. The pod watcher sees the same
+// LastTerminationState on every status update until the container dies
+// again, so each termination is handled once.
+var oomSeen = struct {
+    sync.Mutex
+    m map[string]time.Time
+}{m: map[string]time.Time{}}
+
+// firstOOM reports whether the OOM kill in cs has not been handled yet.
+func firstOOM(pod *corev1.Pod, cs corev1.ContainerStatus) bool {
+    t := cs.LastTerminationState.Terminated
+    key := fmt.Sprintf("%s/%s/%d", pod.UID, cs.Name, t.FinishedAt.Unix())
+    now := time.Now()
+    oomSeen.Lock(); defer oomSeen.Unlock()
+    if _, ok := oomSeen.m[key]; ok { return false }
+    for k, at := range oomSeen.m {
+        if now.Sub(at) > 24*time.Hour { delete(oomSeen.m, k) }
+    }
+    oomSeen.m[key] = now
+    return true
+}
+
+// memoryBump is a planned memory limit change for one container of a
+// workload. Caps lists the limits that held To below the policy percentage.
+type memoryBump struct {
+    Namespace, Kind, Workload, Container string
+    From, To                             resource.Quantity
+    Percent                              int
+    Caps                                 []string
+}
+
+func (b memoryBump) String() string {
+    return fmt.Sprintf("memory limit of %s `%s/%s` (container `%s`) %s → %s", b.Kind, b.Namespace, b.Workload, b.Container, b.From.String(), b.To.String())
+}
+
+func (b memoryBump) raises() bool { return b.To.Cmp(b.From) > 0 }
+
+func (b memoryBump) capNote() string {
+    if len(b.Caps) == 0 { return "" }
+    return " (capped by " + strings.Join(b.Caps, ", ") + ")"
+}
+
+// planMemoryBump raises the container's current memory limit by percent,
+// rounded up to a MiB, then caps it at ceiling (zero: none) and the
+// namespace LimitRanges: container max, pod max less the other containers'
+// limits, and maxLimitRequestRatio.
+func planMemoryBump(ctx context.Context, kc kubernetes.Interface, pod *corev1.Pod, cname string, percent int, ceiling resource.Quantity) (memoryBump, error) {
+    b := memoryBump{Namespace: pod.Namespace, Container: cname, Percent: percent}
+    var err error
+    if b.Kind, b.Workload, err = topOwner(ctx, kc, pod); err != nil { return b, err }
+    var c *corev1.Container
+    var others int64
+    for i := range pod.Spec.Containers {
+        if pod.Spec.Containers[i].Name == cname { c = &pod.Spec.Containers[i]; continue }
+        others += pod.Spec.Containers[i].Resources.Limits.Memory().Value()
+    }
+    if c == nil { return b, fmt.Errorf("container %q not in pod spec", cname) }
+    cur, ok := c.Resources.Limits[corev1.ResourceMemory]
+    if !ok { return b, fmt.Errorf("container %q has no memory limit", cname) }
+    b.From = cur
+
+    const mi = 1 << 20
+    to := cur.Value() * int64(100+percent) / 100
+    to = (to + mi - 1) / mi * mi
+    b.To = *resource.NewQuantity(to, resource.BinarySI)
+    limit := func(q resource.Quantity, why string) {
+        if q.Cmp(b.To) < 0 { b.To = q; b.Caps = append(b.Caps, fmt.Sprintf("%s %s", why, q.String())) }
+    }
+    if !ceiling.IsZero() { limit(ceiling, "MAX_MEMORY_LIMIT") }
+
+    lrs, err := kc.CoreV1().LimitRanges(pod.Namespace).List(ctx, metav1.ListOptions{})
+    if err != nil { klog.Warningf("oom: list LimitRanges in %s: %v", pod.Namespace, err); return b, nil }
+    for _, lr := range lrs.Items {
+        for _, it := range lr.Spec.Limits {
+            switch it.Type {
+            case corev1.LimitTypeContainer:
+                if q, ok := it.Max[corev1.ResourceMemory]; ok { limit(q, "LimitRange "+lr.Name+" max") }
+                req, hasReq := c.Resources.Requests[corev1.ResourceMemory]
+                if r, ok := it.MaxLimitRequestRatio[corev1.ResourceMemory]; ok && hasReq {
+                    q := resource.NewQuantity(int64(float64(req.Value())*r.AsApproximateFloat64()), resource.BinarySI)
+                    limit(*q, "LimitRange "+lr.Name+" maxLimitRequestRatio")
+                }
+            case corev1.LimitTypePod:
+                if q, ok := it.Max[corev1.ResourceMemory]; ok {
+                    limit(*resource.NewQuantity(q.Value()-others, resource.BinarySI), "LimitRange "+lr.Name+" pod max")
+                }
+            }
+        }
+    }
+    return b, nil
+}
+
+// memoryCeiling parses MAX_MEMORY_LIMIT; a bad value is logged and ignored.
+func memoryCeiling(pol *policy.Policy) resource.Quantity {
+    if pol.MaxMemoryLimit == "" { return resource.Quantity{} }
+    q, err := resource.ParseQuantity(pol.MaxMemoryLimit)
+    if err != nil { klog.Warningf("oom: bad MAX_MEMORY_LIMIT %q: %v", pol.MaxMemoryLimit, err); return resource.Quantity{} }
+    return q
+}
+
+// params stores b and the PR evidence on a pending action; memoryBumpFrom
+// reads them back when the action is approved.
+func (b memoryBump) params(evidence string) map[string]string {
+    return map[string]string{
+        "kind": b.Kind, "workload": b.Workload, "container": b.Container,
+        "from": b.From.String(), "to": b.To.String(), "percent": strconv.Itoa(b.Percent),
+        "caps": strings.Join(b.Caps, "; "), "evidence": evidence,
+    }
+}
+
+func memoryBumpFrom(a *approval.Action) (memoryBump, string, error) {
+    p := a.Params
+    b := memoryBump{Namespace: a.Namespace, Kind: p["kind"], Workload: p["workload"], Container: p["container"]}
+    var err error
+    if b.From, err = resource.ParseQuantity(p["from"]); err != nil { return b, "", fmt.Errorf("bad from param %q", p["from"]) }
+    if b.To, err = resource.ParseQuantity(p["to"]); err != nil { return b, "", fmt.Errorf("bad to param %q", p["to"]) }
+    b.Percent, _ = strconv.Atoi(p["percent"])
+    if p["caps"] != "" { b.Caps = strings.Split(p["caps"], "; ") }
+    return b, p["evidence"], nil
+}
+
+// topOwner returns the workload that owns pod: the Deployment behind a
+// ReplicaSet, otherwise the pod's controller.
+func topOwner(ctx context.Context, kc kubernetes.Interface, pod *corev1.Pod) (kind, name string, err error) {
+    ref := metav1.GetControllerOf(pod)
+    if ref == nil { return "", "", fmt.Errorf("pod %s/%s has no controller", pod.Namespace, pod.Name) }
+    if ref.Kind != "ReplicaSet" { return ref.Kind, ref.Name, nil }
+    rs, err := kc.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+    if err != nil { return "", "", fmt.Errorf("get replicaset %s: %w", ref.Name, err) }
+    if d := metav1.GetControllerOf(rs); d != nil { return d.Kind, d.Name, nil }
+    return ref.Kind, ref.Name, nil
+}
+
+// apply opens or updates the GitOps PR setting the new limit. A values file
+// that already sets at least To returns integrations.ErrNoChange.
+func (b memoryBump) apply(ctx context.Context, gops *GitOps, evidence string) (string, error) {
+    base, err := gops.Paths.ResourcesPath(helmvalues.Target{Namespace: b.Namespace, Kind: b.Kind, Workload: b.Workload, Container: b.Container})
+    if err != nil { return "", err }
+    path := append(base, "limits", "memory")
+    if src, err := gops.Client.ReadFile(ctx, gops.ValuesFile); err == nil {
+        if v, ok, _ := helmvalues.Lookup(src, path); ok {
+            if q, err := resource.ParseQuantity(v); err == nil && q.Cmp(b.To) >= 0 { return "", integrations.ErrNoChange }
+        }
+    }
+    body := fmt.Sprintf("Raises the %s by %d%%%s after an OOM kill.\n\n%s", b, b.Percent, b.capNote(), evidence)
+    url, _, err := gops.propose(ctx, valuesChange{
+        Key:   fmt.Sprintf("%s/%s/%s/OOMKilled", b.Namespace, b.Workload, b.Container),
+        Title: fmt.Sprintf("auto-agent: raise %s/%s %s memory limit to %s", b.Namespace, b.Workload, b.Container, b.To.String()),
+        Body:  body,
+        Edits: []helmvalues.Edit{{Path: path, Value: b.To.String()}},
+    })
+    return url, err
+}
+
+// applyLive patches the new limit into the workload's pod template.
+func (b memoryBump) applyLive(ctx context.Context, gops *GitOps) (*changes.Change, error) {
+    c, err := gops.containerChange(ctx, b.Namespace, b.Kind, b.Workload, b.Container, []string{"resources", "limits", "memory"}, b.To.String())
+    if err != nil { return nil, err }
+    c.Summary, c.Reason = "raise the "+b.String(), "OOMKilled"
+    return gops.patchLive(ctx, c)
+}
+
+// oomEvidence renders the OOM kill for the PR description.
+func oomEvidence(pod *corev1.Pod, cs corev1.ContainerStatus, bundle, logs string, events []string) string {
+    t := cs.LastTerminationState.Terminated
+    var s strings.Builder
+    fmt.Fprintf(&s, "**Evidence**\n- Pod: `%s/%s` on node `%s`\n- Container: `%s`, exit code %d, killed at %s, restarts %d\n",
+        pod.Namespace, pod.Name, pod.Spec.NodeName, cs.Name, t.ExitCode, t.FinishedAt.UTC().Format(time.RFC3339), cs.RestartCount)
+    if bundle != "" { fmt.Fprintf(&s, "- Log bundle: %s\n", bundle) }
+    if len(events) > 0 {
+        if len(events) > 10 { events = events[len(events)-10:] }
+        s.WriteString("\n<details><summary>Events</summary>\n\n```\n" + strings.Join(events, "\n") + "\n```\n</details>\n")
+    }
+    if logs = strings.TrimSpace(logs); logs != "" {
+        s.WriteString("\n<details><summary>Last logs</summary>\n\n```\n" + logs + "\n```\n</details>\n")
+    }
+    return s.String()
+}
@@ -0,0 +1,167 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sync"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/integrations"
+)
+
+// Meta keys of pending actions whose approval acknowledges a PagerDuty alert.
+const (
+    metaPagerDutyKey     = "pagerduty_dedup_key"
+    metaPagerDutyRouting = "pagerduty_routing_key"
+)
+
+// Pager escalates pod incidents, anomaly alerts and node pressure to
+// PagerDuty with the routing key of the matching policy's escalation, falling
+// back to PAGERDUTY_ROUTING_KEY. For pod incidents the incident key is the
+// dedup key, so detection triggers, approving a pending action for it
+// acknowledges, and recovery resolves the same alert. A nil *Pager disables
+// paging.
+type Pager struct {
+    RoutingKey string
+    pd         *integrations.PagerDuty
+
+    mu    sync.Mutex
+    nodes map[string]bool // nodes with an open pressure alert
+}
+
+// NewPagerFromEnv returns nil unless PAGERDUTY_ENABLED is true.
+func NewPagerFromEnv() *Pager {
+    if !osGetBool("PAGERDUTY_ENABLED", false) { return nil }
+    return &Pager{RoutingKey: os.Getenv("PAGERDUTY_ROUTING_KEY"), pd: integrations.NewPagerDuty(), nodes: map[string]bool{}}
+}
+
+func (p *Pager) routingKey(r remediation) string { return p.routingKeyFor(r.PagerDutyRoutingKey) }
+
+// routingKeyFor returns a policy's own routing key, or else the default.
+func (p *Pager) routingKeyFor(policyKey string) string {
+    if p == nil { return "" }
+    if policyKey != "" { return policyKey }
+    return p.RoutingKey
+}
+
+// severity maps an incident reason to a PagerDuty severity; pods of a
+// critical priority class are always critical.
+func severity(reason string, pod *corev1.Pod) string {
+    if pod != nil && isCritical(pod) { return "critical" }
+    switch reason {
+    case "CrashLoopBackOff", "OOMKilled":
+        return "error"
+    }
+    return "warning" // ImagePullBackOff: the old pods keep serving
+}
+
+// trigger raises the alert for key and returns the Slack line announcing it,
+// or "" when paging is off.
+func (p *Pager) trigger(ctx context.Context, r remediation, key string, pod *corev1.Pod, reason, container, bundle string) string {
+    rk := p.routingKey(r)
+    if rk == "" { return "" }
+    ev := integrations.PDEvent{
+        RoutingKey: rk, Action: "trigger", DedupKey: key,
+        Summary:  fmt.Sprintf("%s: %s/%s container %s", reason, pod.Namespace, incidentOwner(pod), container),
+        Source:   fmt.Sprintf("%s/%s", pod.Namespace, pod.Name), Severity: severity(reason, pod),
+        Component: container, Group: pod.Namespace, Class: reason,
+        Details:  map[string]string{"pod": pod.Name, "node": pod.Spec.NodeName, "policy": r.Source, "mode": string(r.Mode)},
+    }
+    if bundle != "" { ev.Details["logBundle"] = bundle; ev.Links = append(ev.Links, integrations.PDLink{Href: bundle, Text: "Log bundle"}) }
+    if r.RunbookURL != "" { ev.Links = append(ev.Links, integrations.PDLink{Href: r.RunbookURL, Text: "Runbook"}) }
+    return p.raise(ctx, ev)
+}
+
+// triggerAnomaly raises the alert of a firing anomaly rule, keyed by the
+// rule's "<ns>/<policy>/<rule>", and returns the Slack line announcing it, or
+// "" when paging is off.
+func (p *Pager) triggerAnomaly(ctx context.Context, key string, pol crd.Policy, rule crd.AnomalyRule, summary string, details map[string]string) string {
+    rk := p.routingKeyFor(pol.PagerDutyRoutingKey)
+    if rk == "" { return "" }
+    details["policy"], details["promql"] = pol.Namespace+"/"+pol.Name, rule.PromQL
+    ev := integrations.PDEvent{
+        RoutingKey: rk, Action: "trigger", DedupKey: "anomaly/" + key,
+        Summary: summary, Source: pol.Namespace + "/" + pol.Name, Severity: "warning",
+        Component: rule.Name, Group: pol.Namespace, Class: "Anomaly", Details: details,
+    }
+    if pol.RunbookURL != "" { ev.Links = append(ev.Links, integrations.PDLink{Href: pol.RunbookURL, Text: "Runbook"}) }
+    return p.raise(ctx, ev)
+}
+
+// resolveAnomaly resolves the alert of the anomaly rule key, raised with
+// routingKey.
+func (p *Pager) resolveAnomaly(ctx context.Context, routingKey, key string) {
+    p.send(ctx, routingKey, "resolve", "anomaly/"+key)
+}
+
+// node raises an alert for memory or disk pressure on node and resolves it
+// once the pressure clears, with the default routing key since a node has no
+// policy. Only the agent running on the node pages it, so every replica's
+// node watcher does not raise its own. It returns the Slack line for a
+// trigger or resolve that was sent, or "".
+func (p *Pager) node(ctx context.Context, node *corev1.Node, memP, diskP bool) string {
+    if p == nil || p.RoutingKey == "" { return "" }
+    if self := os.Getenv("NODE_NAME"); self != "" && self != node.Name { return "" }
+    key := "node/" + node.Name + "/pressure"
+    p.mu.Lock(); defer p.mu.Unlock()
+    open := p.nodes[node.Name]
+    switch {
+    case (memP || diskP) && !open:
+        ev := integrations.PDEvent{
+            RoutingKey: p.RoutingKey, Action: "trigger", DedupKey: key,
+            Summary: fmt.Sprintf("NodePressure on %s (mem:%t disk:%t)", node.Name, memP, diskP),
+            Source:  node.Name, Severity: "error", Class: "NodePressure",
+            Details: map[string]string{"memoryPressure": fmt.Sprint(memP), "diskPressure": fmt.Sprint(diskP)},
+        }
+        // A failed trigger is retried on the node's next status update; the
+        // failure is only logged, as those come every few seconds.
+        if err := p.pd.Send(ctx, ev); err != nil { klog.Warningf("pager: could not trigger the PagerDuty alert for pressure on node %s: %v", node.Name, err); return "" }
+        p.nodes[node.Name] = true
+        return fmt.Sprintf("_PagerDuty_: triggered (%s).\n", ev.Severity)
+    case !(memP || diskP) && open:
+        if err := p.pd.Send(ctx, integrations.PDEvent{RoutingKey: p.RoutingKey, Action: "resolve", DedupKey: key}); err != nil {
+            klog.Warningf("pager: could not resolve the PagerDuty alert for pressure on node %s: %v", node.Name, err)
+            return ""
+        }
+        delete(p.nodes, node.Name)
+        return "_PagerDuty_: resolved.\n"
+    }
+    return ""
+}
+
+// raise sends a trigger event and returns the Slack line reporting it.
+func (p *Pager) raise(ctx context.Context, ev integrations.PDEvent) string {
+    if err := p.pd.Send(ctx, ev); err != nil {
+        klog.Warningf("pager: could not trigger the PagerDuty alert %s: %v", ev.DedupKey, err)
+        return fmt.Sprintf("_PagerDuty_: trigger failed: %v\n", err)
+    }
+    return fmt.Sprintf("_PagerDuty_: triggered (%s).\n", ev.Severity)
+}
+
+// send posts an acknowledge or resolve event for key.
+func (p *Pager) send(ctx context.Context, routingKey, action, key string) {
+    if p == nil || routingKey == "" { return }
+    if err := p.pd.Send(ctx, integrations.PDEvent{RoutingKey: routingKey, Action: action, DedupKey: key}); err != nil {
+        klog.Warningf("pager: could not %s the PagerDuty alert %s: %v", action, key, err)
+    }
+}
+
+// meta returns the Meta of a pending action proposed for incident key: the
+// policy's Slack channel and, when paging, the alert to acknowledge on
+// approval.
+func (p *Pager) meta(r remediation, key string) map[string]string {
+    m := map[string]string{approval.MetaSlackChannel: r.SlackChannel}
+    if rk := p.routingKey(r); rk != "" { m[metaPagerDutyKey], m[metaPagerDutyRouting] = key, rk }
+    return m
+}
+
+// acknowledge acknowledges the alert of an approved pending action.
+func (p *Pager) acknowledge(ctx context.Context, a *approval.Action) {
+    if a.State != approval.Approved || a.Meta[metaPagerDutyKey] == "" { return }
+    p.send(ctx, a.Meta[metaPagerDutyRouting], "acknowledge", a.Meta[metaPagerDutyKey])
+}
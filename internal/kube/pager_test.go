@@ -0,0 +1,72 @@
+package kube
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+)
+
+// pdEvents stands in for the PagerDuty Events API and records the
+// "<action> <dedup_key>" of each event.
+func pdEvents(t *testing.T) *[]string {
+    var mu sync.Mutex
+    got := &[]string{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var ev struct {
+            Action string `json:"event_action"`
+            Key    string `json:"dedup_key"`
+        }
+        _ = json.NewDecoder(r.Body).Decode(&ev)
+        mu.Lock(); *got = append(*got, ev.Action+" "+ev.Key); mu.Unlock()
+        w.WriteHeader(http.StatusAccepted)
+    }))
+    t.Cleanup(srv.Close)
+    t.Setenv("PAGERDUTY_ENABLED", "true")
+    t.Setenv("PAGERDUTY_ROUTING_KEY", "rk")
+    t.Setenv("PAGERDUTY_EVENTS_URL", srv.URL)
+    return got
+}
+
+func TestPagerNodePressure(t *testing.T) {
+    got := pdEvents(t)
+    pg := NewPagerFromEnv()
+    ctx := context.Background()
+    n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1"}}
+    t.Setenv("NODE_NAME", "n1")
+
+    if pg.node(ctx, n, true, false) == "" { t.Fatal("no trigger line") }
+    if pg.node(ctx, n, true, true) != "" { t.Error("second update re-triggered") }
+    if pg.node(ctx, n, false, false) == "" { t.Fatal("no resolve line") }
+    if pg.node(ctx, n, false, false) != "" { t.Error("resolved twice") }
+
+    t.Setenv("NODE_NAME", "n2")
+    if pg.node(ctx, n, true, false) != "" { t.Error("paged another node's pressure") }
+
+    want := []string{"trigger node/n1/pressure", "resolve node/n1/pressure"}
+    if len(*got) != len(want) || (*got)[0] != want[0] || (*got)[1] != want[1] { t.Fatalf("events = %q, want %q", *got, want) }
+}
+
+func TestPagerAnomaly(t *testing.T) {
+    got := pdEvents(t)
+    pg := NewPagerFromEnv()
+    ctx := context.Background()
+    p := crd.Policy{Namespace: "shop", Name: "api", PagerDutyRoutingKey: "team-rk"}
+
+    if line := pg.triggerAnomaly(ctx, "shop/api/latency", p, crd.AnomalyRule{Name: "latency"}, "Anomaly latency", map[string]string{}); line == "" { t.Fatal("no trigger line") }
+    pg.resolveAnomaly(ctx, "team-rk", "shop/api/latency")
+    if len(*got) != 2 || (*got)[0] != "trigger anomaly/shop/api/latency" || (*got)[1] != "resolve anomaly/shop/api/latency" { t.Fatalf("events = %q", *got) }
+}
+
+func TestRecoveryRequiredForPaging(t *testing.T) {
+    t.Setenv("RECOVERY_WINDOW", "0")
+    if rc, err := NewRecoveryFromEnv(nil, nil, nil, nil); rc != nil || err != nil { t.Fatalf("without paging: rc = %v, err = %v", rc, err) }
+    if _, err := NewRecoveryFromEnv(nil, nil, &Pager{}, nil); err == nil { t.Fatal("RECOVERY_WINDOW=0 accepted with paging on") }
+}
@@ -0,0 +1,157 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/forecast"
+    "github.com/yourorg/auto-agent/internal/metrics"
+    "github.com/yourorg/auto-agent/internal/obs"
+)
+
+// Predictive defaults when the CR leaves them empty. The default query matches
+// the prometheus provider's CPU signal.
+const (
+    defaultPredictQuery   = `avg(sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{namespace="{{.Namespace}}",container!="",image!=""}[5m])) / sum by (namespace, pod) (kube_pod_container_resource_requests{namespace="{{.Namespace}}",resource="cpu"}) * on (namespace, pod) group_left() {{.Pods}})`
+    defaultPredictHistory = 7 * 24 * time.Hour
+    defaultPredictSeason  = 24 * time.Hour
+    defaultPredictHorizon = 15 * time.Minute
+    defaultPredictStep    = 5 * time.Minute
+)
+
+// prediction is the forecast for one workload at now+Horizon.
+type prediction struct {
+    Act       bool // mode "on"; "shadow" only exports metrics
+    Value     float64
+    Threshold float64
+    Horizon   time.Duration
+}
+
+// Crosses reports whether the forecast exceeds the threshold and may drive scaling.
+func (p *prediction) Crosses() bool { return p != nil && p.Act && p.Value > p.Threshold }
+
+func (p *prediction) note() string {
+    return fmt.Sprintf("_Forecast_: %.3g in %s (threshold %.3g)\n", p.Value, p.Horizon, p.Threshold)
+}
+
+type dueForecast struct {
+    at time.Time
+    v  float64
+}
+
+// forecastState is the fitted model of one workload plus the forecasts still
+// waiting for their actual value, used to export the forecast error.
+type forecastState struct {
+    model    *forecast.Model
+    fitEnd   time.Time
+    fittedAt time.Time
+    step     time.Duration
+    due      []dueForecast
+}
+
+// forecaster keeps per-workload models between leader ticks. Models are refit
+// from a range query every PREDICTIVE_REFIT_INTERVAL (default 1h).
+type forecaster struct {
+    mu sync.Mutex
+    ws map[string]*forecastState
+}
+
+var forecasts = &forecaster{ws: map[string]*forecastState{}}
+
+// predict forecasts w's signal per the matching CR's actions.scale.predictive.
+// It returns nil when predictive scaling is off or no forecast is available.
+func (f *forecaster) predict(ctx context.Context, mp metrics.Provider, w *workload, r remediation, now time.Time) *prediction {
+    if r.Policy == nil { return nil }
+    cfg := r.Policy.Scale.Predictive
+    if cfg.Mode == "" || cfg.Mode == "off" { return nil }
+    key := fmt.Sprintf("%s/%s/%s", w.Namespace, w.Kind, w.Name)
+    tmpl := cfg.Query
+    if tmpl == "" { tmpl = defaultPredictQuery }
+    q, err := renderSignal(tmpl, signalData{Namespace: w.Namespace, Name: w.Name, Selector: promSelector(w.Selector), Pods: metrics.PodsOf(w.Workload)})
+    if err != nil { klog.Warningf("predict %s: %v", key, err); return nil }
+    step := durOr(cfg.Step, defaultPredictStep)
+    horizon := durOr(cfg.Horizon, defaultPredictHorizon)
+
+    f.mu.Lock(); defer f.mu.Unlock()
+    st := f.ws[key]
+    if st == nil || now.Sub(st.fittedAt) > durOr(getenv("PREDICTIVE_REFIT_INTERVAL", ""), time.Hour) {
+        m, end, err := fitWorkload(ctx, mp, q, now, durOr(cfg.History, defaultPredictHistory), durOr(cfg.Season, defaultPredictSeason), step)
+        if err != nil { klog.V(2).Infof("predict %s: %v", key, err); return nil }
+        if st == nil { st = &forecastState{} ; f.ws[key] = st }
+        st.model, st.fitEnd, st.fittedAt, st.step = m, end, now, step
+        obs.ForecastModelRMSE.WithLabelValues(w.Namespace, w.Kind, w.Name).Set(m.RMSE)
+    }
+    f.score(ctx, mp, q, w, st, now)
+
+    h := int(math.Ceil(float64(now.Add(horizon).Sub(st.fitEnd)) / float64(st.step)))
+    p := &prediction{Act: cfg.Mode == "on", Value: st.model.Forecast(h), Horizon: horizon, Threshold: cfg.Threshold}
+    if p.Threshold <= 0 { p.Threshold = parseFloat(getenv("SCALE_CPU_THRESHOLD", "0.8")) }
+    st.due = append(st.due, dueForecast{at: now.Add(horizon), v: p.Value})
+    obs.ForecastValue.WithLabelValues(w.Namespace, w.Kind, w.Name).Set(p.Value)
+    return p
+}
+
+// score compares forecasts that have come due with the current value of the
+// signal and exports the error.
+func (f *forecaster) score(ctx context.Context, mp metrics.Provider, q string, w *workload, st *forecastState, now time.Time) {
+    i := 0
+    for i < len(st.due) && !st.due[i].at.After(now) { i++ }
+    if i == 0 { return }
+    last := st.due[i-1]
+    st.due = st.due[i:]
+    actual, err := mp.QueryInstant(ctx, q)
+    if err != nil { return }
+    obs.ForecastError.WithLabelValues(w.Namespace, w.Kind, w.Name).Set(actual - last.v)
+    if actual != 0 { obs.ForecastAbsPctError.WithLabelValues(w.Namespace, w.Kind, w.Name).Observe(math.Abs(actual-last.v) / math.Abs(actual)) }
+}
+
+// prune drops state of workloads not seen in the last scaling pass.
+func (f *forecaster) prune(seen map[string]bool) {
+    f.mu.Lock(); defer f.mu.Unlock()
+    for k := range f.ws {
+        if seen[k] { continue }
+        p := strings.SplitN(k, "/", 3)
+        obs.ForecastValue.DeleteLabelValues(p[0], p[1], p[2])
+        obs.ForecastError.DeleteLabelValues(p[0], p[1], p[2])
+        obs.ForecastAbsPctError.DeleteLabelValues(p[0], p[1], p[2])
+        obs.ForecastModelRMSE.DeleteLabelValues(p[0], p[1], p[2])
+        delete(f.ws, k)
+    }
+}
+
+// fitWorkload loads history of q on a regular step grid (gaps carry the
+// previous value forward) and fits a Holt-Winters model to it.
+func fitWorkload(ctx context.Context, mp metrics.Provider, q string, now time.Time, history, season, step time.Duration) (*forecast.Model, time.Time, error) {
+    end := now.Truncate(step)
+    series, err := mp.QueryRange(ctx, q, end.Add(-history), end, step)
+    if err = metrics.IgnoreWarnings(q, err); err != nil { return nil, time.Time{}, err }
+    if len(series) == 0 || len(series[0].Points) == 0 { return nil, time.Time{}, metrics.ErrNoData }
+    pts := series[0].Points
+    start := pts[0].Time
+    n := int(end.Sub(start)/step) + 1
+    xs := make([]float64, 0, n)
+    j := 0
+    for t := start; !t.After(end); t = t.Add(step) {
+        for j+1 < len(pts) && !pts[j+1].Time.After(t) { j++ }
+        xs = append(xs, pts[j].Value)
+    }
+    m, err := forecast.Fit(xs, int(season/step))
+    if err != nil { return nil, time.Time{}, err }
+    return m, end, nil
+}
+
+// durOr parses a duration that may use a "d" (days) suffix, or returns def.
+func durOr(s string, def time.Duration) time.Duration {
+    if strings.HasSuffix(s, "d") {
+        if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && n > 0 { return time.Duration(n) * 24 * time.Hour }
+    }
+    if d, err := time.ParseDuration(s); err == nil && d > 0 { return d }
+    return def
+}
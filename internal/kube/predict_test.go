@@ -0,0 +1,20 @@
+package kube
+
+import (
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+
+    "github.com/yourorg/auto-agent/internal/obs"
+)
+
+func TestForecastPruneKeepsOtherKind(t *testing.T) {
+    f := &forecaster{ws: map[string]*forecastState{"shop/Deployment/web": {}, "shop/StatefulSet/web": {}}}
+    obs.ForecastValue.WithLabelValues("shop", "Deployment", "web").Set(1)
+    obs.ForecastValue.WithLabelValues("shop", "StatefulSet", "web").Set(2)
+
+    f.prune(map[string]bool{"shop/StatefulSet/web": true})
+    if _, ok := f.ws["shop/StatefulSet/web"]; !ok || len(f.ws) != 1 { t.Fatalf("state left: %v", f.ws) }
+    if v := testutil.ToFloat64(obs.ForecastValue.WithLabelValues("shop", "StatefulSet", "web")); v != 2 { t.Errorf("StatefulSet forecast = %v, want 2", v) }
+    if n := testutil.CollectAndCount(obs.ForecastValue); n != 1 { t.Errorf("%d forecast series, want 1", n) }
+}
@@ -0,0 +1,302 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// Recovery tracks open pod incidents until they clear: every pod the incident
+// was detected on has the container ready again or is gone, and none has
+// restarted or failed again for Window. Recovery then closes the incident's
+// ticket, resolves its PagerDuty alert, posts a resolved notice and records
+// the time to recover. Open incidents are kept in memory, so incidents open
+// across an agent restart are not followed up.
+//
+// Each agent only sees the pods of its own node, while the incident key is
+// workload-wide. Agents with failing pods therefore register their node for
+// the incident in the auto-agent-incidents ConfigMap, and an agent whose pods
+// recovered only resolves the incident once no other node is registered: the
+// last node to recover resolves it.
+type Recovery struct {
+    Window time.Duration
+    tix    *Tickets
+    pg     *Pager
+    sl     *slack.Client
+    shared *failingNodes // nil: resolve on this agent's pods alone
+
+    mu   sync.Mutex
+    open map[string]*incident // incidentKey → incident
+}
+
+type incident struct {
+    key, namespace, workload, reason, container string
+    r     remediation
+    since time.Time // first detection
+
+    failing   map[types.UID]string // pods still failing → name
+    recovered map[types.UID]int32  // pods ready again → restart count then
+    lastPod   string               // the pod that recovered last
+    quiet     time.Time            // since no pod has been failing; zero while one is
+    held      time.Time            // when this node was last registered as failing
+}
+
+// NewRecoveryFromEnv returns nil when RECOVERY_WINDOW is 0. Paging needs
+// recovery tracking, since only recovery resolves pod alerts, so 0 is an
+// error when PagerDuty is enabled. Without kc or NODE_NAME incidents are
+// resolved on this agent's pods alone.
+func NewRecoveryFromEnv(kc kubernetes.Interface, tix *Tickets, pg *Pager, sl *slack.Client) (*Recovery, error) {
+    w, err := time.ParseDuration(getenv("RECOVERY_WINDOW", "5m"))
+    if err != nil { return nil, fmt.Errorf("RECOVERY_WINDOW: %w", err) }
+    if w <= 0 && pg != nil { return nil, fmt.Errorf("RECOVERY_WINDOW: 0 turns off recovery, so PagerDuty alerts would never resolve; set a window or disable PagerDuty") }
+    if w <= 0 { return nil, nil }
+    rc := &Recovery{Window: w, tix: tix, pg: pg, sl: sl, open: map[string]*incident{}}
+    if node := os.Getenv("NODE_NAME"); kc != nil && node != "" {
+        rc.shared = &failingNodes{kc: kc, ns: getenv("POD_NAMESPACE", "kube-system"), name: "auto-agent-incidents", node: node, ttl: 3 * w}
+    }
+    return rc, nil
+}
+
+// track opens an incident for container of pod, unless one is open already,
+// and marks pod as failing; repeated detections keep the first detection time.
+func (rc *Recovery) track(pod *corev1.Pod, reason, container string, r remediation) {
+    if rc == nil { return }
+    key := incidentKey(pod, reason, container)
+    rc.mu.Lock(); defer rc.mu.Unlock()
+    in, ok := rc.open[key]
+    if !ok {
+        in = &incident{key: key, namespace: pod.Namespace, workload: incidentOwner(pod), reason: reason, container: container, since: time.Now(),
+            failing: map[types.UID]string{}, recovered: map[types.UID]int32{}}
+        rc.open[key] = in
+    }
+    in.r = r
+    in.failing[pod.UID] = pod.Name
+    delete(in.recovered, pod.UID)
+    in.quiet = time.Time{}
+}
+
+// observe updates the recovery state of the incidents pod belongs to. Only
+// pods the incident was detected on count: a healthy sibling does not clear
+// it.
+func (rc *Recovery) observe(pod *corev1.Pod) {
+    if rc == nil { return }
+    rc.mu.Lock(); defer rc.mu.Unlock()
+    if len(rc.open) == 0 { return }
+    ready := podReady(pod)
+    for _, cs := range pod.Status.ContainerStatuses {
+        for _, reason := range []string{"CrashLoopBackOff", "ImagePullBackOff", "OOMKilled"} {
+            in, ok := rc.open[incidentKey(pod, reason, cs.Name)]
+            if !ok { continue }
+            if _, failing := in.failing[pod.UID]; failing {
+                if !ready || !cs.Ready { continue }
+                delete(in.failing, pod.UID)
+                in.recovered[pod.UID], in.lastPod = cs.RestartCount, pod.Name
+                if len(in.failing) == 0 { in.quiet = time.Now() }
+                continue
+            }
+            // A restart of a recovered pod starts the window over.
+            if n, ok := in.recovered[pod.UID]; ok && n != cs.RestartCount {
+                in.recovered[pod.UID] = cs.RestartCount
+                if len(in.failing) == 0 { in.quiet = time.Now() }
+            }
+        }
+    }
+}
+
+// forget drops a deleted pod from the incidents it belongs to. A failing pod
+// that is deleted (e.g. to clear its backoff) no longer holds the incident
+// open; its replacement is tracked if it fails again.
+func (rc *Recovery) forget(pod *corev1.Pod) {
+    if rc == nil { return }
+    rc.mu.Lock(); defer rc.mu.Unlock()
+    for _, in := range rc.open {
+        delete(in.recovered, pod.UID)
+        if _, ok := in.failing[pod.UID]; !ok { continue }
+        delete(in.failing, pod.UID)
+        if len(in.failing) == 0 { in.quiet = time.Now() }
+    }
+}
+
+// Run resolves incidents whose window has passed until ctx is done.
+func (rc *Recovery) Run(ctx context.Context) {
+    if rc == nil { return }
+    tick := rc.Window / 4
+    if tick > 30*time.Second { tick = 30 * time.Second }
+    t := time.NewTicker(tick)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+            rc.step(ctx, time.Now())
+        }
+    }
+}
+
+// step registers this node for the incidents it still sees failing, and
+// resolves those whose window has passed unless another node still has
+// failing pods. It returns the keys of the incidents resolved.
+func (rc *Recovery) step(ctx context.Context, now time.Time) []string {
+    if rc.shared != nil {
+        for _, key := range rc.stale(now) {
+            if err := rc.shared.hold(ctx, key, now); err != nil { klog.Warningf("recovery: register %s as failing on this node: %v", key, err) }
+        }
+    }
+    var resolved []string
+    for _, in := range rc.due(now) {
+        if rc.shared != nil {
+            others, err := rc.shared.release(ctx, in.key, now)
+            if err != nil {
+                klog.Warningf("recovery: %s: could not read the other nodes' state, resolving on this node's pods: %v", in.key, err)
+            } else if len(others) > 0 {
+                klog.Infof("recovery: %s recovered on this node but is still failing on %s", in.key, strings.Join(others, ", "))
+                continue
+            }
+        }
+        rc.resolve(ctx, in)
+        resolved = append(resolved, in.key)
+    }
+    return resolved
+}
+
+// stale returns the keys of incidents with failing pods whose registration is
+// missing or older than the window, and marks them registered at now.
+func (rc *Recovery) stale(now time.Time) []string {
+    rc.mu.Lock(); defer rc.mu.Unlock()
+    var out []string
+    for k, in := range rc.open {
+        if len(in.failing) == 0 || now.Sub(in.held) < rc.Window { continue }
+        in.held = now
+        out = append(out, k)
+    }
+    return out
+}
+
+func (rc *Recovery) due(now time.Time) []*incident {
+    rc.mu.Lock(); defer rc.mu.Unlock()
+    var out []*incident
+    for k, in := range rc.open {
+        if len(in.failing) == 0 && !in.quiet.IsZero() && now.Sub(in.quiet) >= rc.Window {
+            out = append(out, in)
+            delete(rc.open, k)
+        }
+    }
+    return out
+}
+
+func (rc *Recovery) resolve(ctx context.Context, in *incident) {
+    ttr := in.quiet.Sub(in.since)
+    if ttr < 0 { ttr = 0 }
+    obs.TimeToRecover.WithLabelValues(in.reason, in.namespace).Observe(ttr.Seconds())
+    how := fmt.Sprintf("no pod has failed or restarted for %s", rc.Window)
+    if in.lastPod != "" { how = fmt.Sprintf("pod `%s` is ready and %s", in.lastPod, how) }
+    msg := fmt.Sprintf("*Resolved*: %s of `%s/%s` (container `%s`) cleared after %s; %s.\n",
+        in.reason, in.namespace, in.workload, in.container, ttr.Round(time.Second), how)
+    if in.r.Mode != policy.Observe {
+        note := fmt.Sprintf("Recovered after %s: %s.", ttr.Round(time.Second), strings.ReplaceAll(how, "`", ""))
+        msg += rc.tix.resolve(ctx, in.r, in.key, note)
+        rc.pg.send(ctx, rc.pg.routingKey(in.r), "resolve", in.key)
+    }
+    resolved := fmt.Sprintf(":white_check_mark: *Resolved* after %s", ttr.Round(time.Second))
+    if err := rc.sl.ResolveIncident(in.key, in.r.SlackChannel, resolved, slack.Message{Text: msg}); err != nil { klog.Warningf("recovery: post %s: %v", in.key, err) }
+}
+
+// failingNodes records, per incident key, the nodes whose agent still sees a
+// failing pod, with the time each last registered. Registrations are renewed
+// every Window while pods fail, so one older than ttl is left by an agent that
+// is gone and is ignored. Updates use optimistic concurrency, like the guard's
+// Budgets.
+type failingNodes struct {
+    kc       kubernetes.Interface
+    ns, name string
+    node     string // this agent's node
+    ttl      time.Duration
+}
+
+// hold registers this node as failing for key at now.
+func (f *failingNodes) hold(ctx context.Context, key string, now time.Time) error {
+    _, err := f.update(ctx, key, now, func(nodes map[string]time.Time) { nodes[f.node] = now })
+    return err
+}
+
+// release removes this node from key and returns the other nodes still
+// registered.
+func (f *failingNodes) release(ctx context.Context, key string, now time.Time) ([]string, error) {
+    return f.update(ctx, key, now, func(nodes map[string]time.Time) { delete(nodes, f.node) })
+}
+
+// update applies fn to the live registrations of key and returns the nodes
+// left other than this one, creating the ConfigMap on first use.
+func (f *failingNodes) update(ctx context.Context, key string, now time.Time, fn func(map[string]time.Time)) ([]string, error) {
+    k := strings.ReplaceAll(key, "/", "_") // names cannot contain '_'
+    var others []string
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cm, err := f.kc.CoreV1().ConfigMaps(f.ns).Get(ctx, f.name, metav1.GetOptions{})
+        create := apierrors.IsNotFound(err)
+        if err != nil && !create { return err }
+        if create { cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: f.ns, Name: f.name}} }
+        if cm.Data == nil { cm.Data = map[string]string{} }
+        nodes := parseNodes(cm.Data[k])
+        for n, at := range nodes {
+            if now.Sub(at) >= f.ttl { delete(nodes, n) }
+        }
+        fn(nodes)
+        others = others[:0]
+        for n := range nodes {
+            if n != f.node { others = append(others, n) }
+        }
+        sort.Strings(others)
+        if len(nodes) == 0 { delete(cm.Data, k) } else { cm.Data[k] = formatNodes(nodes) }
+        if create {
+            if len(cm.Data) == 0 { return nil }
+            _, err = f.kc.CoreV1().ConfigMaps(f.ns).Create(ctx, cm, metav1.CreateOptions{})
+            if apierrors.IsAlreadyExists(err) { return apierrors.NewConflict(corev1.Resource("configmaps"), f.name, err) }
+            return err
+        }
+        _, err = f.kc.CoreV1().ConfigMaps(f.ns).Update(ctx, cm, metav1.UpdateOptions{})
+        return err
+    })
+    return others, err
+}
+
+// parseNodes reads "node=<unix ms>,…".
+func parseNodes(s string) map[string]time.Time {
+    out := map[string]time.Time{}
+    for _, f := range strings.Split(s, ",") {
+        n, v, ok := strings.Cut(f, "=")
+        if ms, err := strconv.ParseInt(v, 10, 64); ok && err == nil { out[n] = time.UnixMilli(ms) }
+    }
+    return out
+}
+
+func formatNodes(nodes map[string]time.Time) string {
+    fs := make([]string, 0, len(nodes))
+    for n, at := range nodes { fs = append(fs, n+"="+strconv.FormatInt(at.UnixMilli(), 10)) }
+    sort.Strings(fs)
+    return strings.Join(fs, ",")
+}
+
+func podReady(p *corev1.Pod) bool {
+    for _, c := range p.Status.Conditions {
+        if c.Type == corev1.PodReady { return c.Status == corev1.ConditionTrue }
+    }
+    return false
+}
@@ -0,0 +1,109 @@
+package kube
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes/fake"
+
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// recoveryPod is a pod of ReplicaSet api-abc whose container "app" is ready
+// or not, with restarts restarts.
+func recoveryPod(name string, ready bool, restarts int32) *corev1.Pod {
+    ctrl := true
+    status := corev1.ConditionFalse
+    if ready { status = corev1.ConditionTrue }
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, UID: types.UID(name), Labels: map[string]string{"pod-template-hash": "abc"},
+            OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-abc", Controller: &ctrl}}},
+        Status: corev1.PodStatus{
+            Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+            ContainerStatuses: []corev1.ContainerStatus{{Name: "app", Ready: ready, RestartCount: restarts}},
+        },
+    }
+}
+
+func newTestRecovery() *Recovery {
+    return &Recovery{Window: 5 * time.Minute, sl: slack.New(""), open: map[string]*incident{}}
+}
+
+func TestRecoveryPerPod(t *testing.T) {
+    const key = "shop/replicaset/api/CrashLoopBackOff/app"
+    tests := []struct {
+        name string
+        run  func(rc *Recovery)
+        want bool // resolved after the window
+    }{
+        {name: "still failing", run: func(rc *Recovery) {}, want: false},
+        {name: "healthy sibling does not clear", run: func(rc *Recovery) { rc.observe(recoveryPod("api-2", true, 0)) }, want: false},
+        {name: "failing pod ready again", run: func(rc *Recovery) { rc.observe(recoveryPod("api-1", true, 3)) }, want: true},
+        {name: "one of two failing pods ready", run: func(rc *Recovery) {
+            rc.track(recoveryPod("api-3", false, 1), "CrashLoopBackOff", "app", remediation{})
+            rc.observe(recoveryPod("api-1", true, 3))
+        }, want: false},
+        {name: "failing pod deleted", run: func(rc *Recovery) { rc.forget(recoveryPod("api-1", false, 3)) }, want: true},
+        {name: "container ready in an unready pod", run: func(rc *Recovery) {
+            p := recoveryPod("api-1", true, 3)
+            p.Status.Conditions[0].Status = corev1.ConditionFalse
+            rc.observe(p)
+        }, want: false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rc := newTestRecovery()
+            rc.track(recoveryPod("api-1", false, 3), "CrashLoopBackOff", "app", remediation{})
+            tt.run(rc)
+            if got := rc.due(time.Now()); len(got) != 0 { t.Fatalf("resolved before the window: %v", got) }
+            got := rc.due(time.Now().Add(rc.Window))
+            if (len(got) == 1) != tt.want { t.Fatalf("resolved = %d incidents, want %t", len(got), tt.want) }
+            if tt.want && got[0].key != key { t.Errorf("key = %s, want %s", got[0].key, key) }
+        })
+    }
+}
+
+func TestRecoveryRestartStartsWindowOver(t *testing.T) {
+    rc := newTestRecovery()
+    rc.track(recoveryPod("api-1", false, 3), "CrashLoopBackOff", "app", remediation{})
+    rc.observe(recoveryPod("api-1", true, 3))
+    in := rc.open["shop/replicaset/api/CrashLoopBackOff/app"]
+    in.quiet = in.quiet.Add(-time.Hour)
+    rc.observe(recoveryPod("api-1", true, 4))
+    if len(rc.due(time.Now().Add(rc.Window/2))) != 0 { t.Fatal("a restart of the recovered pod did not start the window over") }
+    if len(rc.due(time.Now().Add(rc.Window))) != 1 { t.Fatal("not resolved after the new window") }
+}
+
+// Two agents see the same incident on their own nodes: the first to recover
+// leaves it open, the last resolves it.
+func TestRecoveryWaitsForOtherNodes(t *testing.T) {
+    ctx := context.Background()
+    kc := fake.NewSimpleClientset()
+    agent := func(node string) *Recovery {
+        rc := newTestRecovery()
+        rc.shared = &failingNodes{kc: kc, ns: "ops", name: "auto-agent-incidents", node: node, ttl: 3 * rc.Window}
+        return rc
+    }
+    a, b := agent("n1"), agent("n2")
+    now := time.Now()
+    // A registration left by an agent that is gone does not hold it open.
+    if err := agent("n3").shared.hold(ctx, "shop/replicaset/api/CrashLoopBackOff/app", now.Add(-time.Hour)); err != nil { t.Fatal(err) }
+
+    a.track(recoveryPod("api-1", false, 3), "CrashLoopBackOff", "app", remediation{})
+    b.track(recoveryPod("api-2", false, 1), "CrashLoopBackOff", "app", remediation{})
+    a.step(ctx, now); b.step(ctx, now)
+
+    a.observe(recoveryPod("api-1", true, 3))
+    if got := a.step(ctx, time.Now().Add(a.Window)); len(got) != 0 { t.Fatalf("n1 resolved %v while n2 still fails", got) }
+    if len(a.open) != 0 { t.Error("n1 kept the incident after handing it over") }
+
+    b.observe(recoveryPod("api-2", true, 1))
+    if got := b.step(ctx, time.Now().Add(b.Window)); len(got) != 1 { t.Fatalf("n2 resolved %v, want the incident", got) }
+    cm, err := kc.CoreV1().ConfigMaps("ops").Get(ctx, "auto-agent-incidents", metav1.GetOptions{})
+    if err != nil { t.Fatal(err) }
+    if len(cm.Data) != 0 { t.Errorf("registrations left: %v", cm.Data) }
+}
@@ -0,0 +1,73 @@
+package kube
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/policy"
+)
+
+// remediation is the effective per-object policy: the global policy.Policy
+// overlaid with the most specific matching AutoRemediationPolicy.
+type remediation struct {
+    Source            string // "namespace/name" of the CR, or "global"
+    Mode              policy.Mode
+    RestartStuckPods  bool
+    BumpMemoryPercent int
+    RequireApproval   bool
+    SlackChannel      string
+    PagerDutyRoutingKey string
+    RunbookURL        string
+    Ticketing         crd.Ticketing
+    Policy            *crd.Policy // nil when no CR matched
+}
+
+func (r remediation) needsApproval() bool {
+    return r.Mode == policy.Suggest || r.RequireApproval
+}
+
+// resolve picks the AutoRemediationPolicy that governs an object with the
+// given labels. When several match, the one with the most selector
+// requirements wins, ties broken by name. Fields the CR leaves empty (mode,
+// bumpMemoryPercent: 0) fall back to the global policy; with no match the
+// global policy applies as is.
+func resolve(pol *policy.Policy, store *crd.Store, ns string, lbls map[string]string) remediation {
+    r := remediation{
+        Source: "global", Mode: pol.Mode,
+        RestartStuckPods: true, BumpMemoryPercent: pol.BumpMemoryPercent,
+    }
+    if store == nil { return r }
+    ms := store.Match(ns, lbls)
+    if len(ms) == 0 { return r }
+    sort.SliceStable(ms, func(i, j int) bool {
+        si, sj := specificity(&ms[i]), specificity(&ms[j])
+        if si != sj { return si > sj }
+        return ms[i].Name < ms[j].Name
+    })
+    p := ms[0]
+    r.Source = fmt.Sprintf("%s/%s", p.Namespace, p.Name)
+    r.Policy = &p
+    if p.Mode != "" { r.Mode = p.Mode }
+    r.RestartStuckPods = p.RestartStuckPods
+    if p.BumpMemoryPercent > 0 { r.BumpMemoryPercent = p.BumpMemoryPercent }
+    r.RequireApproval = p.RequireApproval
+    r.SlackChannel = p.SlackChannel
+    r.PagerDutyRoutingKey = p.PagerDutyRoutingKey
+    r.RunbookURL = p.RunbookURL
+    r.Ticketing = p.Ticketing
+    return r
+}
+
+func specificity(p *crd.Policy) int {
+    if p.Selector == nil { return 0 }
+    reqs, _ := p.Selector.Requirements()
+    return len(reqs)
+}
+
+// footer renders the policy source and runbook link appended to incident messages.
+func (r remediation) footer() string {
+    s := fmt.Sprintf("_Policy_: `%s` (mode %s)", r.Source, r.Mode)
+    if r.RunbookURL != "" { s += fmt.Sprintf(" · <%s|runbook>", r.RunbookURL) }
+    return s + "\n"
+}
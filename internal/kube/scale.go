@@ -0,0 +1,338 @@
+package kube
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/changes"
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/llm"
+    "github.com/yourorg/auto-agent/internal/metrics"
+    "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/policy"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+func EvaluateAndScale(ctx context.Context, kc *kubernetes.Clientset, dyn dynamic.Interface, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, gops *GitOps) {
+    // Multi-signal gating:
+    // - CPU > threshold
+    // - AND the workload's signals (CRD actions.scale.signals, else the global
+    //   PROM_* queries) combined with OR / AND
+    // - OR, with actions.scale.predictive mode "on", a forecast crossing the
+    //   threshold within the horizon (scale up ahead; blocks scale-down)
+    // Open schedule windows (spec.schedule) are applied first: they move the
+    // workload into their min/max and skip the metric-driven logic that tick.
+    // Cooldowns via annotations (simplified here).
+
+    windows := schedules.evaluate(store, sl, time.Now())
+    seen := map[string]bool{}
+    defer func() { forecasts.prune(seen) }()
+    for ns := range pol.NamespaceAllow {
+        wl, err := listWorkloads(ctx, kc, dyn, ns)
+        if err != nil { klog.Warningf("scale: list workloads in %s: %v", ns, err); continue }
+        hpas, err := listHPAs(ctx, kc, ns)
+        if err != nil {
+            // Without HPA visibility we could fight an autoscaler; skip the namespace.
+            if pol.HPACoexistence { klog.Warningf("scale: list HPAs in %s: %v", ns, err); continue }
+        }
+        for i := range wl {
+            w := &wl[i]
+            seen[fmt.Sprintf("%s/%s/%s", w.Namespace, w.Kind, w.Name)] = true
+            rep := w.Replicas
+            r := resolve(pol, store, ns, w.Template.Labels)
+            h := hpas.For(w.Kind, w.Name)
+            win, inWindow := windows[r.Source]
+            b := scaleBoundsFor(pol, r, win)
+            if !b.enabled { continue }
+            if inWindow {
+                if to, dir := b.enforce(rep); to != rep {
+                    applyScale(ctx, kc, dyn, pol, sl, g, q, gops, r, w, h, rep, to, dir, math.NaN(), win.note())
+                    continue
+                }
+            }
+
+            last := w.Annotations["auto-agent.io/last-scale-ts"]
+            if last != "" {
+                if t, err := time.Parse(time.RFC3339, last); err==nil {
+                    if time.Since(t) < parseDur(getenv("COOLDOWN_UP","2m")) {
+                        continue
+                    }
+                }
+            }
+
+            // CPU
+            cpu, err := mp.AvgWorkloadCPU(ctx, w.Workload, getenv("SCALE_WINDOW","5m"))
+            if err != nil { continue }
+
+            gateOK, why := evalSignals(ctx, mp, w, r)
+            if inWindow { why += win.note() }
+            pred := forecasts.predict(ctx, mp, w, r, time.Now())
+
+            reactive := cpu > parseFloat(getenv("SCALE_CPU_THRESHOLD","0.8")) && gateOK
+            if reactive || pred.Crosses() {
+                if !reactive { why = "_Predictive_: scaling ahead of the forecast crossing\n" + pred.note() }
+                to, note := b.plan(rep, "up")
+                if to == rep { klog.V(2).Infof("scale: %s/%s up held: %s", ns, w.Name, note); continue }
+                applyScale(ctx, kc, dyn, pol, sl, g, q, gops, r, w, h, rep, to, "up", cpu, why + note)
+            } else {
+                // Scale Down: only if CPU well below threshold and no signals met; long cooldown
+                lastDown := w.Annotations["auto-agent.io/last-scale-down-ts"]
+                if lastDown != "" {
+                    if t, err := time.Parse(time.RFC3339, lastDown); err==nil {
+                        if time.Since(t) < parseDur(getenv("COOLDOWN_DOWN","10m")) {
+                            continue
+                        }
+                    }
+                }
+                // Signals that still call for capacity hold replicas up; with
+                // none configured the gate is always open and must not.
+                sigs, _ := scaleSignals(r)
+                if cpu < 0.3 && !(gateOK && len(sigs) > 0) && !pred.Crosses() {
+                    if to, note := b.plan(rep, "down"); to != rep {
+                        applyScale(ctx, kc, dyn, pol, sl, g, q, gops, r, w, h, rep, to, "down", cpu, note)
+                    }
+                }
+            }
+        }
+    }
+}
+
+// applyScale carries out one scaling decision for w. If an HPA targets w the
+// agent does not touch its replicas: with HPA_COEXISTENCE the workload is
+// skipped unless the matching CR sets allowHPAOverride, in which case the
+// HPA's bounds are moved instead. Every message states the path taken.
+func applyScale(ctx context.Context, kc *kubernetes.Clientset, dyn dynamic.Interface, pol *policy.Policy, sl *slack.Client, g *guard.Guard, q *approval.Queue, gops *GitOps, r remediation, w *workload, h *autoscalingv2.HorizontalPodAutoscaler, from, to int32, direction string, cpu float64, why string) {
+    typ, title := "scale_"+direction, "*ScaleUp*"
+    if direction == "down" { title = "*ScaleDown*" }
+    if r.Mode == policy.Observe { return }
+    hpa, path := "", "_Path_: `/scale`"
+    if h != nil {
+        switch {
+        case !pol.HPACoexistence:
+            path = fmt.Sprintf("_Path_: `/scale` (HPA `%s` ignored, HPA_COEXISTENCE=false)", h.Name)
+        case r.Policy == nil || !r.Policy.Scale.AllowHPAOverride:
+            klog.Infof("scale: %s %s/%s skipped: HPA %s owns replicas", typ, w.Namespace, w.Name, h.Name)
+            obs.ActionsSuppressedTotal.WithLabelValues(typ, w.Namespace, w.Name, "hpa").Inc()
+            return
+        default:
+            hpa, path = h.Name, fmt.Sprintf("_Path_: HPA `%s` bounds (allowHPAOverride)", h.Name)
+        }
+    }
+    if r.needsApproval() {
+        if line, id := proposeScale(ctx, q, w, from, to, direction, cpu, hpa); line != "" { _ = postIncident(sl, r.SlackChannel, title + " needs approval\n" + line + why + path, id) }
+        return
+    }
+    ga := guard.Action{Type: typ, Namespace: w.Namespace, Workload: strings.ToLower(w.Kind) + "/" + w.Name, Labels: w.Template.Labels}
+    if err := g.Allow(ctx, ga); err != nil {
+        if direction == "up" { _ = sl.PostTo(r.SlackChannel, fmt.Sprintf("%s refused for %s%s: %v", title, w, fmtCPU(cpu), err)) }
+        return
+    }
+    if hpa != "" {
+        desc, err := scaleViaHPA(ctx, kc, w.Namespace, hpa, to)
+        if err != nil { g.Refund(ctx, ga); klog.Warningf("scale: %s/%s via HPA %s: %v", w.Namespace, w.Name, hpa, err); return }
+        path = "_Path_: " + desc
+    } else {
+        var prev int32
+        var c *changes.Change
+        var err error
+        if gops.live() {
+            prev, c, err = gops.scaleLive(ctx, w, to, typ)
+        } else {
+            prev, err = scaleTo(ctx, dyn, w.GVR, w.Namespace, w.Name, to)
+        }
+        if err != nil { g.Refund(ctx, ga); klog.Warningf("scale: %s/%s: %v", w.Namespace, w.Name, err); return }
+        from = prev
+        if c != nil {
+            if c.Subresource == "" { path = strings.Replace(path, "`/scale`", "strategic-merge patch", 1) }
+            path += "\n" + strings.TrimSuffix(revertLine(c), "\n")
+        }
+    }
+    if err := markScaled(ctx, dyn, w.GVR, w.Namespace, w.Name, direction); err != nil { klog.Warningf("scale: annotate %s/%s: %v", w.Namespace, w.Name, err) }
+    msg := fmt.Sprintf("%s: %s %d → %d%s\n", title, w, from, to, fmtCPU(cpu)) + why + path
+    _ = sl.PostTo(r.SlackChannel, msg); obs.ActionsTotal.WithLabelValues(typ, w.Namespace, w.Name).Inc()
+}
+
+// scaleBounds are the replica limits for one workload: the matching CR's
+// actions.scale (min, max, step, enabled), replaced by the overrides of open
+// schedule windows, with MAX_SCALE_STEP as a global ceiling on the step.
+// Without a CR: step 1, floor 1, no maximum.
+type scaleBounds struct {
+    enabled         bool
+    min, max, step  int32
+    stepCapped      bool
+}
+
+func scaleBoundsFor(pol *policy.Policy, r remediation, win windowOverride) scaleBounds {
+    b := scaleBounds{enabled: true, min: 1, step: 1}
+    if p := r.Policy; p != nil {
+        b.enabled = p.Scale.Enabled
+        if p.Scale.MinReplicas > 0 { b.min = p.Scale.MinReplicas }
+        if p.Scale.MaxReplicas > 0 { b.max = p.Scale.MaxReplicas }
+        if p.Scale.Step > 0 { b.step = p.Scale.Step }
+    }
+    if win.min > 0 { b.min = win.min }
+    if win.max > 0 { b.max = win.max }
+    if b.max > 0 && b.max < b.min { b.max = b.min }
+    if c := int32(pol.MaxScaleStep); c > 0 && b.step > c { b.step, b.stepCapped = c, true }
+    return b
+}
+
+// plan returns the replica count one step from rep in direction, clamped to
+// the bounds, and a Slack note naming any bound that shaped the decision.
+// The result equals rep when a bound leaves no room to move.
+func (b scaleBounds) plan(rep int32, direction string) (int32, string) {
+    var notes []string
+    if b.stepCapped { notes = append(notes, fmt.Sprintf("step capped at MAX_SCALE_STEP=%d", b.step)) }
+    to := rep + b.step
+    if direction == "down" { to = rep - b.step }
+    switch {
+    case direction == "up" && b.max > 0 && to > b.max:
+        to = b.max
+        if to < rep { to = rep }
+        notes = append(notes, fmt.Sprintf("clamped by maxReplicas=%d", b.max))
+    case direction == "down" && to < b.min:
+        to = b.min
+        if to > rep { to = rep }
+        notes = append(notes, fmt.Sprintf("clamped by minReplicas=%d", b.min))
+    }
+    if len(notes) == 0 { return to, "" }
+    return to, "_Bounds_: " + strings.Join(notes, ", ") + "\n"
+}
+
+// fmtCPU renders the CPU that drove a decision; NaN (schedule-driven) renders empty.
+func fmtCPU(cpu float64) string {
+    if math.IsNaN(cpu) { return "" }
+    return fmt.Sprintf(" (cpu=%.2f)", cpu)
+}
+
+// signalData is what scaling signal templates are rendered with.
+type signalData struct {
+    Namespace string
+    Name      string
+    Selector  string // e.g. app="api",tier="web"
+    Pods      string // PromQL vector of the workload's pods, see metrics.PodsOf
+}
+
+// scaleSignals returns the signals and combinator that gate scaling of a
+// workload: the matching CR's actions.scale.signals, or the legacy global
+// PROM_QUEUE_DEPTH / PROM_ERROR_RATE / PROM_P95_LATENCY queries (true when > 0).
+func scaleSignals(r remediation) ([]crd.ScaleSignal, string) {
+    if r.Policy != nil && len(r.Policy.Scale.Signals) > 0 {
+        return r.Policy.Scale.Signals, r.Policy.Scale.Combine
+    }
+    var out []crd.ScaleSignal
+    for _, k := range []string{"PROM_QUEUE_DEPTH", "PROM_ERROR_RATE", "PROM_P95_LATENCY"} {
+        if q := getenv(k, ""); q != "" { out = append(out, crd.ScaleSignal{Name: strings.ToLower(k), Query: q, Operator: ">"}) }
+    }
+    return out, "OR"
+}
+
+// evalSignals reports whether the workload's scaling signals gate, plus a
+// Slack line listing each signal's value. Without signals scaling is CPU-only
+// and the gate is open. A signal that fails to render or query counts as not met.
+func evalSignals(ctx context.Context, mp metrics.Provider, d *workload, r remediation) (bool, string) {
+    sigs, combine := scaleSignals(r)
+    if len(sigs) == 0 { return true, "" }
+    all := strings.EqualFold(combine, "AND")
+    data := signalData{Namespace: d.Namespace, Name: d.Name, Selector: promSelector(d.Selector), Pods: metrics.PodsOf(d.Workload)}
+    met, parts := 0, make([]string, 0, len(sigs))
+    for i, s := range sigs {
+        name := s.Name
+        if name == "" { name = fmt.Sprintf("signal%d", i+1) }
+        q, err := renderSignal(s.Query, data)
+        if err != nil {
+            klog.Warningf("scale: %s/%s signal %s: %v", d.Namespace, d.Name, name, err)
+            parts = append(parts, fmt.Sprintf("%s: error", name))
+            continue
+        }
+        v, err := mp.QueryInstant(ctx, q)
+        if err != nil {
+            klog.V(2).Infof("scale: %s/%s signal %s: %v", d.Namespace, d.Name, name, err)
+            parts = append(parts, fmt.Sprintf("%s: no data", name))
+            continue
+        }
+        ok := compare(v, s.Operator, s.Threshold)
+        if ok { met++ }
+        mark := "✗"; if ok { mark = "✓" }
+        parts = append(parts, fmt.Sprintf("%s %s=%.3g %s %g", mark, name, v, s.Operator, s.Threshold))
+    }
+    gate := met > 0
+    if all { gate = met == len(sigs) }
+    op := "OR"; if all { op = "AND" }
+    return gate, fmt.Sprintf("_Signals_ (%s): %s\n", op, strings.Join(parts, ", "))
+}
+
+func renderSignal(tmpl string, data signalData) (string, error) {
+    t, err := template.New("signal").Option("missingkey=error").Parse(tmpl)
+    if err != nil { return "", err }
+    var b bytes.Buffer
+    if err := t.Execute(&b, data); err != nil { return "", err }
+    return b.String(), nil
+}
+
+// promSelector renders a workload selector's matchLabels as PromQL label matchers.
+func promSelector(sel *metav1.LabelSelector) string {
+    if sel == nil { return "" }
+    keys := make([]string, 0, len(sel.MatchLabels))
+    for k := range sel.MatchLabels { keys = append(keys, k) }
+    sort.Strings(keys)
+    parts := make([]string, 0, len(keys)+len(sel.MatchExpressions))
+    for _, k := range keys {
+        parts = append(parts, promLabel(k)+"="+strconv.Quote(sel.MatchLabels[k]))
+    }
+    // matchExpressions: In/NotIn as regex alternations, Exists/DoesNotExist
+    // as (non-)empty matches, since a missing label reads as "".
+    for _, e := range sel.MatchExpressions {
+        vals := make([]string, len(e.Values))
+        for i, v := range e.Values { vals[i] = regexp.QuoteMeta(v) }
+        sort.Strings(vals)
+        alt := strconv.Quote(strings.Join(vals, "|"))
+        switch e.Operator {
+        case metav1.LabelSelectorOpIn:
+            parts = append(parts, promLabel(e.Key)+"=~"+alt)
+        case metav1.LabelSelectorOpNotIn:
+            parts = append(parts, promLabel(e.Key)+"!~"+alt)
+        case metav1.LabelSelectorOpExists:
+            parts = append(parts, promLabel(e.Key)+`!=""`)
+        case metav1.LabelSelectorOpDoesNotExist:
+            parts = append(parts, promLabel(e.Key)+`=""`)
+        }
+    }
+    return strings.Join(parts, ",")
+}
+
+// promLabel maps a Kubernetes label key to the name kube-state-metrics and
+// most relabel configs use (app.kubernetes.io/name → app_kubernetes_io_name).
+func promLabel(k string) string {
+    return strings.Map(func(r rune) rune {
+        if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' { return r }
+        return '_'
+    }, k)
+}
+
+func compare(v float64, op string, t float64) bool {
+    switch op {
+    case ">=": return v >= t
+    case "<": return v < t
+    case "<=": return v <= t
+    case "==": return v == t
+    case "!=": return v != t
+    default: return v > t
+    }
+}
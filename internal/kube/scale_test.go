@@ -0,0 +1,37 @@
+package kube
+
+import (
+    "testing"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPromSelector(t *testing.T) {
+    tests := []struct {
+        name string
+        sel  *metav1.LabelSelector
+        want string
+    }{
+        {name: "nil", sel: nil, want: ""},
+        {name: "matchLabels sorted and mapped", sel: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web", "app.kubernetes.io/name": "api"}},
+            want: `app_kubernetes_io_name="api",tier="web"`},
+        {name: "in", sel: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+            {Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"prod", "canary"}}}},
+            want: `env=~"canary|prod"`},
+        {name: "notin escapes regex", sel: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+            {Key: "version", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"1.0"}}}},
+            want: `version!~"1\\.0"`},
+        {name: "exists and does not exist", sel: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+            {Key: "team", Operator: metav1.LabelSelectorOpExists},
+            {Key: "legacy", Operator: metav1.LabelSelectorOpDoesNotExist}}},
+            want: `team!="",legacy=""`},
+        {name: "labels then expressions", sel: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}, MatchExpressions: []metav1.LabelSelectorRequirement{
+            {Key: "track", Operator: metav1.LabelSelectorOpIn, Values: []string{"stable"}}}},
+            want: `app="api",track=~"stable"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := promSelector(tt.sel); got != tt.want { t.Errorf("promSelector() = %s, want %s", got, tt.want) }
+        })
+    }
+}
@@ -0,0 +1,106 @@
+package kube
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/schedule"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+// windowOverride is the combined bound override of a policy's open schedule
+// windows. Overlapping windows take the highest minReplicas and maxReplicas.
+type windowOverride struct {
+    names    []string
+    min, max int32
+}
+
+func (o windowOverride) note() string {
+    s := fmt.Sprintf("_Schedule_: window `%s`", strings.Join(o.names, "`, `"))
+    if o.min > 0 { s += fmt.Sprintf(" minReplicas=%d", o.min) }
+    if o.max > 0 { s += fmt.Sprintf(" maxReplicas=%d", o.max) }
+    return s + "\n"
+}
+
+// scheduler remembers which windows were open on the previous tick so start
+// and end notices are posted once per transition. State is in-memory: a new
+// leader seeds it silently instead of re-announcing open windows.
+type scheduler struct {
+    mu   sync.Mutex
+    open map[string]bool
+    bad  map[string]string // invalid window → error already logged
+}
+
+var schedules = &scheduler{open: map[string]bool{}, bad: map[string]string{}}
+
+// evaluate returns the overrides of every policy with an open window, keyed
+// like remediation.Source ("namespace/name"), and posts start/end notices.
+func (s *scheduler) evaluate(store *crd.Store, sl *slack.Client, now time.Time) map[string]windowOverride {
+    out := map[string]windowOverride{}
+    if store == nil { return out }
+    s.mu.Lock(); defer s.mu.Unlock()
+    seen := map[string]bool{}
+    for _, p := range store.All() {
+        if len(p.Schedule.Windows) == 0 { continue }
+        src := p.Namespace + "/" + p.Name
+        loc, err := time.LoadLocation(p.Schedule.Timezone)
+        if err != nil { s.logBad(src, err); loc = time.UTC }
+        for _, w := range p.Schedule.Windows {
+            key := src + "/" + w.Name
+            start, err := schedule.Parse(w.Start)
+            var end *schedule.Cron
+            if err == nil { end, err = schedule.Parse(w.End) }
+            if err != nil { s.logBad(key, err); continue }
+            seen[key] = true
+            active, until := schedule.Active(start, end, now.In(loc))
+            if active {
+                o := out[src]
+                o.names = append(o.names, w.Name)
+                if w.MinReplicas > o.min { o.min = w.MinReplicas }
+                if w.MaxReplicas > o.max { o.max = w.MaxReplicas }
+                out[src] = o
+            }
+            was, known := s.open[key]
+            s.open[key] = active
+            if known && was != active { _ = sl.PostTo(p.SlackChannel, windowNotice(src, w, active, until)) }
+        }
+    }
+    for k := range s.open {
+        if !seen[k] { delete(s.open, k) }
+    }
+    return out
+}
+
+func (s *scheduler) logBad(key string, err error) {
+    if s.bad[key] == err.Error() { return }
+    s.bad[key] = err.Error()
+    klog.Warningf("schedule %s: %v", key, err)
+}
+
+func windowNotice(src string, w crd.ScheduleWindow, started bool, until time.Time) string {
+    if !started {
+        return fmt.Sprintf("*Schedule*: window `%s` of policy `%s` ended; metric-driven scaling within the policy bounds applies again.", w.Name, src)
+    }
+    msg := fmt.Sprintf("*Schedule*: window `%s` of policy `%s` started", w.Name, src)
+    if w.MinReplicas > 0 { msg += fmt.Sprintf(", minReplicas=%d", w.MinReplicas) }
+    if w.MaxReplicas > 0 { msg += fmt.Sprintf(", maxReplicas=%d", w.MaxReplicas) }
+    if !until.IsZero() { msg += " until " + until.Format("Mon 15:04 MST") }
+    return msg + "."
+}
+
+// enforce returns the replica count the open windows require for rep and the
+// direction to move, or rep when it is already within bounds.
+func (b scaleBounds) enforce(rep int32) (int32, string) {
+    switch {
+    case rep < b.min:
+        return b.min, "up"
+    case b.max > 0 && rep > b.max:
+        return b.max, "down"
+    }
+    return rep, ""
+}
@@ -0,0 +1,158 @@
+package kube
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sync"
+
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/integrations"
+)
+
+// Tickets files incident tickets with the provider and repository/project of
+// the matching policy's escalation.ticketing, falling back to TICKETS_*. A nil
+// *Tickets disables ticketing.
+//
+// Updates of one incident's ticket are serialised within the agent, and
+// replicas claim an incident in the auto-agent-tickets ConfigMap before filing
+// it, so detections of the same incident on several nodes within
+// TICKETS_DEDUP_WINDOW file it once.
+type Tickets struct {
+    Provider string // github|jira
+    Repo     string // GitHub repo for issues
+    Project  string // Jira project key
+    IssueType, Priority string // Jira defaults when the policy sets none
+
+    claims *guard.Cooldowns // nil: no cross-replica dedup
+
+    mu    sync.Mutex
+    cache map[string]integrations.Ticketer // provider/target → client, keeps dedup state
+    locks map[string]*keyLock              // incident key → lock held while filing
+}
+
+type keyLock struct {
+    sync.Mutex
+    n int // holders and waiters
+}
+
+// NewTicketsFromEnv returns nil unless TICKETS_ENABLED is true and the
+// provider's token is set.
+func NewTicketsFromEnv(ctx context.Context, kc kubernetes.Interface) *Tickets {
+    if !osGetBool("TICKETS_ENABLED", false) { return nil }
+    provider := getenv("TICKETS_PROVIDER", "github")
+    if ticketToken(provider) == "" {
+        klog.Warningf("tickets: no %s token configured; ticketing disabled", provider)
+        return nil
+    }
+    t := &Tickets{
+        Provider: provider, Repo: os.Getenv("GITHUB_REPO"), Project: os.Getenv("JIRA_PROJECT_KEY"),
+        IssueType: getenv("JIRA_ISSUE_TYPE", "Task"), Priority: os.Getenv("JIRA_PRIORITY"),
+        cache: map[string]integrations.Ticketer{}, locks: map[string]*keyLock{},
+    }
+    if w := parseDur(getenv("TICKETS_DEDUP_WINDOW", "2m")); w > 0 && kc != nil {
+        t.claims = guard.NewCooldowns(ctx, kc, getenv("POD_NAMESPACE", "kube-system"), "auto-agent-tickets", nil, w)
+    }
+    return t
+}
+
+// lock serialises work on the ticket of key and returns the unlock func.
+func (t *Tickets) lock(key string) func() {
+    t.mu.Lock()
+    l := t.locks[key]
+    if l == nil { l = &keyLock{}; t.locks[key] = l }
+    l.n++
+    t.mu.Unlock()
+    l.Lock()
+    return func() {
+        l.Unlock()
+        t.mu.Lock()
+        if l.n--; l.n == 0 { delete(t.locks, key) }
+        t.mu.Unlock()
+    }
+}
+
+func (t *Tickets) client(provider, target string) (integrations.Ticketer, error) {
+    t.mu.Lock(); defer t.mu.Unlock()
+    k := provider + "/" + target
+    if c, ok := t.cache[k]; ok { return c, nil }
+    var c integrations.Ticketer
+    switch provider {
+    case "github":
+        c = integrations.NewGitHubIssues(ticketToken(provider), target)
+    case "jira":
+        c = integrations.NewJira(ticketToken(provider), os.Getenv("JIRA_BASE_URL"), target, os.Getenv("JIRA_EMAIL"))
+    default:
+        return nil, fmt.Errorf("unknown ticket provider %q", provider)
+    }
+    t.cache[k] = c
+    return c, nil
+}
+
+func ticketToken(provider string) string {
+    switch provider {
+    case "github":
+        return getenv("GITHUB_TOKEN", os.Getenv("GIT_TOKEN"))
+    case "jira":
+        return os.Getenv("JIRA_TOKEN")
+    }
+    return ""
+}
+
+// target returns the provider and repository/project r files tickets in, or
+// "" for either when ticketing is off.
+func (t *Tickets) target(r remediation) (string, string) {
+    if t == nil { return "", "" }
+    provider, target := t.Provider, t.Repo
+    if r.Ticketing.Provider != "" { provider = r.Ticketing.Provider }
+    if provider == "none" { return "", "" }
+    if provider == "jira" { target = t.Project }
+    if r.Ticketing.ProjectOrRepo != "" { target = r.Ticketing.ProjectOrRepo }
+    return provider, target
+}
+
+// file creates or updates the ticket for key ("ns/workload/reason/container")
+// and returns the Slack line linking it, or "" when ticketing is off.
+func (t *Tickets) file(ctx context.Context, r remediation, key string, tk integrations.Ticket) string {
+    provider, target := t.target(r)
+    if target == "" { return "" }
+    tk.Labels, tk.Assignees, tk.RunbookURL = r.Ticketing.Labels, r.Ticketing.Assignees, r.RunbookURL
+    tk.IssueType, tk.Priority = t.IssueType, t.Priority
+    if r.Ticketing.IssueType != "" { tk.IssueType = r.Ticketing.IssueType }
+    if r.Ticketing.Priority != "" { tk.Priority = r.Ticketing.Priority }
+    defer t.lock(key)()
+    if t.claims != nil {
+        if err := t.claims.Acquire(ctx, guard.Action{Workload: key, Reason: "ticket"}); err != nil {
+            // another detection filed it within the dedup window
+            return ""
+        }
+    }
+    c, err := t.client(provider, target)
+    if err == nil {
+        var u string
+        if u, err = c.CreateOrUpdate(ctx, key, tk); err == nil { return fmt.Sprintf("_Ticket_: <%s|%s>\n", u, u) }
+    }
+    klog.Warningf("tickets: %s: %v", key, err)
+    return fmt.Sprintf("_Ticket_: failed: %v\n", err)
+}
+
+// resolve closes the open ticket for key with note and returns the Slack
+// line linking it, or "" when there was none.
+func (t *Tickets) resolve(ctx context.Context, r remediation, key, note string) string {
+    provider, target := t.target(r)
+    if target == "" { return "" }
+    defer t.lock(key)()
+    c, err := t.client(provider, target)
+    if err == nil {
+        var u string
+        if u, err = c.Resolve(ctx, key, note); err == nil {
+            if u == "" { return "" }
+            return fmt.Sprintf("_Ticket_: closed <%s|%s>\n", u, u)
+        }
+    }
+    klog.Warningf("tickets: resolve %s: %v", key, err)
+    return fmt.Sprintf("_Ticket_: close failed: %v\n", err)
+}
@@ -0,0 +1,77 @@
+package kube
+
+import (
+    "context"
+    "sync"
+    "testing"
+    "time"
+
+    "k8s.io/client-go/kubernetes/fake"
+
+    "github.com/yourorg/auto-agent/internal/crd"
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/integrations"
+)
+
+// countingTicketer records the tickets filed per key.
+type countingTicketer struct {
+    mu    sync.Mutex
+    filed map[string][]integrations.Ticket
+}
+
+func (c *countingTicketer) CreateOrUpdate(_ context.Context, key string, t integrations.Ticket) (string, error) {
+    c.mu.Lock(); defer c.mu.Unlock()
+    c.filed[key] = append(c.filed[key], t)
+    return "https://tickets.test/" + key, nil
+}
+
+func (c *countingTicketer) Resolve(context.Context, string, string) (string, error) { return "", nil }
+
+func TestTicketsTarget(t *testing.T) {
+    tix := &Tickets{Provider: "github", Repo: "o/r", Project: "OPS"}
+    tests := []struct {
+        name             string
+        tk               crd.Ticketing
+        provider, target string
+    }{
+        {name: "default", provider: "github", target: "o/r"},
+        {name: "policy repo", tk: crd.Ticketing{ProjectOrRepo: "o/team"}, provider: "github", target: "o/team"},
+        {name: "policy jira", tk: crd.Ticketing{Provider: "jira"}, provider: "jira", target: "OPS"},
+        {name: "jira project", tk: crd.Ticketing{Provider: "jira", ProjectOrRepo: "WEB"}, provider: "jira", target: "WEB"},
+        {name: "none", tk: crd.Ticketing{Provider: "none", ProjectOrRepo: "o/team"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p, tg := tix.target(remediation{Ticketing: tt.tk})
+            if p != tt.provider || tg != tt.target { t.Errorf("target() = %q, %q, want %q, %q", p, tg, tt.provider, tt.target) }
+        })
+    }
+    if p, tg := (*Tickets)(nil).target(remediation{}); p != "" || tg != "" { t.Errorf("nil Tickets files in %q %q", p, tg) }
+}
+
+func TestTicketsFileOncePerWindowAcrossReplicas(t *testing.T) {
+    ctx := context.Background()
+    kc := fake.NewSimpleClientset()
+    c := &countingTicketer{filed: map[string][]integrations.Ticket{}}
+    replica := func() *Tickets {
+        return &Tickets{Provider: "github", Repo: "o/r", claims: guard.NewCooldowns(ctx, kc, "ops", "auto-agent-tickets", nil, time.Minute),
+            cache: map[string]integrations.Ticketer{"github/o/r": c}, locks: map[string]*keyLock{}}
+    }
+    a, b := replica(), replica()
+    r := remediation{RunbookURL: "https://runbooks.test/crash", Ticketing: crd.Ticketing{Labels: []string{"auto-agent"}}}
+    key := "shop/api/CrashLoopBackOff/app"
+
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        for _, tix := range []*Tickets{a, b} {
+            wg.Add(1)
+            go func(tix *Tickets) { defer wg.Done(); tix.file(ctx, r, key, integrations.Ticket{Title: "crash"}) }(tix)
+        }
+    }
+    wg.Wait()
+    if n := len(c.filed[key]); n != 1 { t.Fatalf("filed %d times, want 1", n) }
+    got := c.filed[key][0]
+    if got.RunbookURL != r.RunbookURL || len(got.Labels) != 1 { t.Errorf("ticket = %+v", got) }
+
+    if line := a.file(ctx, r, "shop/web/OOMKilled/app", integrations.Ticket{Title: "oom"}); line != "_Ticket_: <https://tickets.test/shop/web/OOMKilled/app|https://tickets.test/shop/web/OOMKilled/app>\n" { t.Errorf("line = %q", line) }
+}
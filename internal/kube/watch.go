@@ -15,6 +15,7 @@ import (
     "k8s.io/client-go/tools/cache"
     "k8s.io/client-go/informers"
     policyv1 "k8s.io/api/policy/v1"
+    "k8s.io/klog/v2"
 
     "github.com/yourorg/auto-agent/internal/metrics"
     "github.com/yourorg/auto-agent/internal/policy"
@@ -23,44 +24,72 @@ import (
     "github.com/yourorg/auto-agent/internal/storage"
     "github.com/yourorg/auto-agent/internal/crd"
     "github.com/yourorg/auto-agent/internal/obs"
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/approval"
+    "github.com/yourorg/auto-agent/internal/integrations"
 )
 
-func WatchPods(ctx context.Context, kc *kubernetes.Clientset, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client) {
-    f := informers.NewSharedInformerFactory(kc, 0)
+func WatchPods(ctx context.Context, kc *kubernetes.Clientset, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, gops *GitOps, tix *Tickets, pg *Pager, rc *Recovery) {
+    // Each DaemonSet replica handles the pods of its own node, so an incident
+    // is detected, remediated and reported once rather than once per node.
+    var opts []informers.SharedInformerOption
+    if node := os.Getenv("NODE_NAME"); node != "" {
+        opts = append(opts, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+            o.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", node).String()
+        }))
+    }
+    f := informers.NewSharedInformerFactoryWithOptions(kc, 0, opts...)
     inf := f.Core().V1().Pods().Informer()
 
     inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
         UpdateFunc: func(oldObj, newObj interface{}) {
             pod := newObj.(*corev1.Pod)
             if !allowed(pol, pod.Namespace) || hasAnno(pod, pol.ExcludedAnnotation) { return }
+            defer rc.observe(pod)
 
             for _, cs := range pod.Status.ContainerStatuses {
                 if cs.State.Waiting != nil {
                     switch cs.State.Waiting.Reason {
                     case "CrashLoopBackOff":
-                        go handleCrashLoop(ctx, kc, pod, cs.Name, pol, sl, ll)
+                        rc.track(pod, "CrashLoopBackOff", cs.Name, resolve(pol, store, pod.Namespace, pod.Labels))
+                        go handleCrashLoop(ctx, kc, pod, cs.Name, pol, sl, ll, g, q, store, tix, pg)
                         return
                     case "ImagePullBackOff", "ErrImagePull":
-                        go handleImagePullBackOff(ctx, kc, pod, cs.Name, pol, sl, ll)
+                        rc.track(pod, "ImagePullBackOff", cs.Name, resolve(pol, store, pod.Namespace, pod.Labels))
+                        go handleImagePullBackOff(ctx, kc, pod, cs.Name, pol, sl, ll, g, q, store, gops, tix, pg)
                         return
                     }
                 }
                 if cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.Reason == "OOMKilled" {
-                    go handleOOM(ctx, kc, pod, cs.Name, pol, sl, ll)
+                    if firstOOM(pod, cs) {
+                        rc.track(pod, "OOMKilled", cs.Name, resolve(pol, store, pod.Namespace, pod.Labels))
+                        go handleOOM(ctx, kc, pod, cs, pol, sl, ll, g, q, store, gops, tix, pg)
+                    }
                     return
                 }
             }
         },
+        DeleteFunc: func(obj interface{}) {
+            if t, ok := obj.(cache.DeletedFinalStateUnknown); ok { obj = t.Obj }
+            if pod, ok := obj.(*corev1.Pod); ok { rc.forget(pod) }
+        },
     })
     go inf.Run(ctx.Done())
 
-    // Node watcher for pressure -> cordon + evict
-    nf := informers.NewSharedInformerFactory(kc, 0)
+    // Node watcher for pressure -> cordon + evict. Likewise each replica
+    // watches only its own node, so a node is cordoned and drained once.
+    var nopts []informers.SharedInformerOption
+    if node := os.Getenv("NODE_NAME"); node != "" {
+        nopts = append(nopts, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+            o.FieldSelector = fields.OneTermEqualSelector("metadata.name", node).String()
+        }))
+    }
+    nf := informers.NewSharedInformerFactoryWithOptions(kc, 0, nopts...)
     ninf := nf.Core().V1().Nodes().Informer()
     ninf.AddEventHandler(cache.ResourceEventHandlerFuncs{
         UpdateFunc: func(oldObj, newObj interface{}) {
             node := newObj.(*corev1.Node)
-            handleNodePressure(ctx, kc, node, pol, sl)
+            handleNodePressure(ctx, kc, node, pol, sl, g, q, store, pg)
         },
     })
     go ninf.Run(ctx.Done())
@@ -97,197 +126,307 @@ func persistLogBundle(ctx context.Context, ns, workload, pod, container, node, r
     return sink.Save(ctx, key, rec)
 }
 
-func handleCrashLoop(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cname string, pol *policy.Policy, sl *slack.Client, ll *llm.Client) {
+func handleCrashLoop(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cname string, pol *policy.Policy, sl *slack.Client, ll *llm.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, tix *Tickets, pg *Pager) {
     ns := pod.Namespace; name := pod.Name
     logs := getLastLogs(ctx, kc, ns, name, cname, 50)
     events := collectEvents(ctx, kc, ns, name)
     url, _ := persistLogBundle(ctx, ns, ownerName(pod), name, cname, pod.Spec.NodeName, "CrashLoopBackOff", "CrashLoopBackOff detected", logs, events)
 
+    r := resolve(pol, store, ns, pod.Labels)
     msg := fmt.Sprintf("*CrashLoopBackOff* on `%s/%s` (container: `%s`)  \nLogs+events: `%s`\n", ns, name, cname, url)
-    if pol.Mode == policy.Fix {
-        _ = kc.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
-        msg += "_Action_: deleted pod to clear backoff (RS will recreate). Cooldown 5m.\n"
-        obs.ActionsTotal.WithLabelValues("delete_pod", ns, ownerName(pod)).Inc()
-    } else if pol.Mode == policy.Suggest {
-        msg += "_Suggest_: delete pod to clear backoff. Approve to proceed.\n"
+    pending := ""
+    switch {
+    case r.Mode == policy.Observe:
+    case !r.RestartStuckPods:
+        msg += "_Policy_: restartStuckPods disabled, pod left as is.\n"
+    case r.needsApproval():
+        line, id := propose(ctx, q, approval.Action{Kind: approval.DeletePod, Namespace: ns, Target: name, Workload: ownerName(pod), Reason: "CrashLoopBackOff", Labels: pod.Labels,
+            Meta: pg.meta(r, incidentKey(pod, "CrashLoopBackOff", cname)),
+            Summary: fmt.Sprintf("delete pod `%s/%s` to clear backoff", ns, name)})
+        if line == "" { return }
+        msg += line; pending = id
+    default:
+        a := podAction("delete_pod", "CrashLoopBackOff", pod)
+        if err := g.Allow(ctx, a); err != nil {
+            if _, ok := err.(*guard.CooldownError); ok { return }
+            msg += fmt.Sprintf("_Guard_: delete pod refused: %v\n", err)
+        } else if err := kc.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+            g.Refund(ctx, a)
+            msg += fmt.Sprintf("_Action_: delete pod failed: %v\n", err)
+        } else {
+            msg += fmt.Sprintf("_Action_: deleted pod to clear backoff (RS will recreate). Cooldown %s.\n", g.Cooldown(a))
+            obs.ActionsTotal.WithLabelValues("delete_pod", ns, ownerName(pod)).Inc()
+        }
     }
-    if ll.Enabled() {
-        advice, _ := ll.Diagnose("Pod CrashLoopBackOff", logs+"\n"+strings.Join(events, "\n"))
-        if advice != "" { msg += "\n_LLM_: " + advice + "\n" }
+    advice := ""
+    if ll.Enabled() { advice, _ = ll.Diagnose("Pod CrashLoopBackOff", logs+"\n"+strings.Join(events, "\n")) }
+    ik := incidentKey(pod, "CrashLoopBackOff", cname)
+    if r.Mode != policy.Observe {
+        msg += tix.file(ctx, r, ik, incidentTicket(pod, "CrashLoopBackOff", cname, url, logs, events))
+        msg += pg.trigger(ctx, r, ik, pod, "CrashLoopBackOff", cname, url)
     }
-    _ = sl.Post(msg)
+    _ = postPodIncident(sl, r, ik, msg, advice, pending)
     obs.IncidentsTotal.WithLabelValues("CrashLoopBackOff", ns, ownerName(pod)).Inc()
 }
 
-func handleImagePullBackOff(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cname string, pol *policy.Policy, sl *slack.Client, ll *llm.Client) {
+func handleImagePullBackOff(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cname string, pol *policy.Policy, sl *slack.Client, ll *llm.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, gops *GitOps, tix *Tickets, pg *Pager) {
     ns := pod.Namespace; name := pod.Name
     events := collectEvents(ctx, kc, ns, name)
     logs := ""
     url, _ := persistLogBundle(ctx, ns, ownerName(pod), name, cname, pod.Spec.NodeName, "ImagePullBackOff", "Image pull failure", logs, events)
 
+    r := resolve(pol, store, ns, pod.Labels)
     msg := fmt.Sprintf("*ImagePullBackOff* on `%s/%s` (container: `%s`)  \nSaved: `%s`\n", ns, name, cname, url)
+    pending := ""
     mirror := osGetBool("IMAGE_MIRROR_ENABLED", false)
     prefix := getenv("IMAGE_MIRROR_PREFIX","")
     image := imageOf(pod, cname)
-    if mirror && image != "" {
+    mirrored := mirrorImage(prefix, image)
+    swapped := false // a live image swap rolls the pod, so it is not deleted
+    switch {
+    case !mirror || image == "" || mirrored == image:
+    case !mirrorAllowed(splitList(os.Getenv("IMAGE_MIRROR_ALLOWLIST")), image):
+        msg += fmt.Sprintf("_Mirror_: `%s` is not in IMAGE_MIRROR_ALLOWLIST, image left as is.\n", image)
+    case !gops.live() || r.Mode == policy.Observe:
         msg += fmt.Sprintf("_Suggest_: mirror `%s` via prefix `%s` using GitOps PR.\n", image, prefix)
+    default:
+        kind, wl, err := topOwner(ctx, kc, pod)
+        if err != nil { msg += fmt.Sprintf("_Live_: image swap skipped: %v\n", err); break }
+        if r.needsApproval() {
+            line, id := propose(ctx, q, approval.Action{Kind: approval.ImageMirror, Namespace: ns, Target: strings.ToLower(kind) + "/" + wl, Workload: ownerName(pod), Reason: "ImagePullBackOff", Labels: pod.Labels,
+                Params: map[string]string{"kind": kind, "workload": wl, "container": cname, "image": mirrored},
+                Meta: pg.meta(r, incidentKey(pod, "ImagePullBackOff", cname)),
+                Summary: fmt.Sprintf("live-patch %s `%s/%s` container `%s` image `%s` → `%s`", kind, ns, wl, cname, image, mirrored)})
+            if line == "" { return }
+            msg += line; pending, swapped = id, true
+            break
+        }
+        a := podAction("image_mirror", "ImagePullBackOff", pod)
+        if err := g.Allow(ctx, a); err != nil {
+            msg += fmt.Sprintf("_Guard_: image swap refused: %v\n", err)
+            break
+        }
+        c, err := swapImage(ctx, gops, ns, kind, wl, cname, mirrored)
+        if err != nil { g.Refund(ctx, a); msg += fmt.Sprintf("_Live_: image swap failed: %v\n", err); break }
+        msg += fmt.Sprintf("_Action_: swapped %s `%s/%s` container `%s` image `%s` → `%s`.\n", kind, ns, wl, cname, image, mirrored) + revertLine(c)
+        obs.ActionsTotal.WithLabelValues("image_mirror", ns, ownerName(pod)).Inc()
+        swapped = true
     }
-    if pol.Mode == policy.Fix {
-        _ = kc.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
-        msg += "_Action_: deleted pod to retry image pull.\n"
-        obs.ActionsTotal.WithLabelValues("delete_pod", ns, ownerName(pod)).Inc()
+    switch {
+    case r.Mode == policy.Observe:
+    case swapped:
+    case !r.RestartStuckPods:
+        msg += "_Policy_: restartStuckPods disabled, pod left as is.\n"
+    case r.needsApproval():
+        line, id := propose(ctx, q, approval.Action{Kind: approval.DeletePod, Namespace: ns, Target: name, Workload: ownerName(pod), Reason: "ImagePullBackOff", Labels: pod.Labels,
+            Meta: pg.meta(r, incidentKey(pod, "ImagePullBackOff", cname)),
+            Summary: fmt.Sprintf("delete pod `%s/%s` to retry image pull", ns, name)})
+        if line == "" { return }
+        msg += line; pending = id
+    default:
+        a := podAction("delete_pod", "ImagePullBackOff", pod)
+        if err := g.Allow(ctx, a); err != nil {
+            if _, ok := err.(*guard.CooldownError); ok { return }
+            msg += fmt.Sprintf("_Guard_: delete pod refused: %v\n", err)
+        } else if err := kc.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+            g.Refund(ctx, a)
+            msg += fmt.Sprintf("_Action_: delete pod failed: %v\n", err)
+        } else {
+            msg += "_Action_: deleted pod to retry image pull.\n"
+            obs.ActionsTotal.WithLabelValues("delete_pod", ns, ownerName(pod)).Inc()
+        }
     }
-    if ll.Enabled() {
-        advice, _ := ll.Diagnose("ImagePullBackOff", strings.Join(events, "\n"))
-        if advice != "" { msg += "\n_LLM_: " + advice + "\n" }
+    advice := ""
+    if ll.Enabled() { advice, _ = ll.Diagnose("ImagePullBackOff", strings.Join(events, "\n")) }
+    ik := incidentKey(pod, "ImagePullBackOff", cname)
+    if r.Mode != policy.Observe {
+        msg += tix.file(ctx, r, ik, incidentTicket(pod, "ImagePullBackOff", cname, url, logs, events))
+        msg += pg.trigger(ctx, r, ik, pod, "ImagePullBackOff", cname, url)
     }
-    _ = sl.Post(msg)
+    _ = postPodIncident(sl, r, ik, msg, advice, pending)
     obs.IncidentsTotal.WithLabelValues("ImagePullBackOff", ns, ownerName(pod)).Inc()
 }
 
-func handleOOM(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cname string, pol *policy.Policy, sl *slack.Client, ll *llm.Client) {
-    ns := pod.Namespace; name := pod.Name
+func handleOOM(ctx context.Context, kc *kubernetes.Clientset, pod *corev1.Pod, cs corev1.ContainerStatus, pol *policy.Policy, sl *slack.Client, ll *llm.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, gops *GitOps, tix *Tickets, pg *Pager) {
+    ns := pod.Namespace; name := pod.Name; cname := cs.Name
     logs := getLastLogs(ctx, kc, ns, name, cname, 20)
     events := collectEvents(ctx, kc, ns, name)
-    url, _ := persistLogBundle(ctx, ns, ownerName(pod), name, cname, pod.Spec.NodeName, "OOMKilled", "Container OOMKilled", logs, events)
+    sink := storage.NewSinkFromEnv()
+    key := storage.BuildKey(ns, ownerName(pod), name, "OOMKilled", time.Now())
+    rec := &storage.Record{
+        Timestamp: time.Now().UTC(),
+        Namespace: ns, Workload: ownerName(pod), Pod: name, Container: cname, Node: pod.Spec.NodeName,
+        Reason: "OOMKilled", Message: "Container OOMKilled", LastLogs: logs, Events: events,
+    }
+    url, _ := sink.Save(ctx, key, rec)
 
+    r := resolve(pol, store, ns, pod.Labels)
     msg := fmt.Sprintf("*OOMKilled* on `%s/%s` (container: `%s`). Saved: `%s`\n", ns, name, cname, url)
-    msg += "Recommend +20% memory limit via GitOps PR; investigate usage spikes.\n"
-    if ll.Enabled() {
-        advice, _ := ll.Diagnose("Container OOMKilled", logs+"\n"+strings.Join(events, "\n"))
-        if advice != "" { msg += "\n_LLM_: " + advice + "\n" }
+    pending := ""
+    if r.BumpMemoryPercent > 0 {
+        b, err := planMemoryBump(ctx, kc, pod, cname, r.BumpMemoryPercent, memoryCeiling(pol))
+        switch {
+        case err != nil:
+            msg += fmt.Sprintf("_Memory_: no bump planned: %v\n", err)
+        case !b.raises():
+            msg += fmt.Sprintf("_Memory_: limit %s is already at its cap%s; no change proposed.\n", b.From.String(), b.capNote())
+        case r.Mode == policy.Observe:
+            msg += fmt.Sprintf("_Observe_: would raise the %s (+%d%%)%s.\n", b, b.Percent, b.capNote())
+        case gops == nil:
+            msg += fmt.Sprintf("Recommend raising the %s (+%d%%)%s; GitOps is not configured.\n", b, b.Percent, b.capNote())
+        case r.needsApproval():
+            how := "open a GitOps PR raising"
+            if gops.live() { how = "live-patch" }
+            line, id := propose(ctx, q, approval.Action{Kind: approval.MemoryBump, Namespace: ns, Target: strings.ToLower(b.Kind) + "/" + b.Workload, Workload: ownerName(pod), Reason: "OOMKilled", Labels: pod.Labels,
+                Params: b.params(oomEvidence(pod, cs, url, logs, events)),
+                Meta: pg.meta(r, incidentKey(pod, "OOMKilled", cname)),
+                Summary: fmt.Sprintf("%s the %s%s", how, b, b.capNote())})
+            if line == "" { return }
+            msg += line; pending = id
+            rec.Extras = map[string]string{"pendingAction": id}
+        default:
+            a := podAction("memory_bump", "OOMKilled", pod)
+            if err := g.Allow(ctx, a); err != nil {
+                msg += fmt.Sprintf("_Guard_: memory bump refused: %v\n", err)
+                break
+            }
+            if gops.live() {
+                c, err := b.applyLive(ctx, gops)
+                if err != nil { g.Refund(ctx, a); msg += fmt.Sprintf("_Live_: patching the %s failed: %v\n", b, err); break }
+                msg += fmt.Sprintf("_Action_: raised the %s (+%d%%)%s.\n", b, b.Percent, b.capNote()) + revertLine(c)
+                rec.Extras = map[string]string{"liveChange": c.ID}
+                obs.ActionsTotal.WithLabelValues("memory_bump", ns, ownerName(pod)).Inc()
+                break
+            }
+            pr, err := b.apply(ctx, gops, oomEvidence(pod, cs, url, logs, events))
+            switch {
+            case err == integrations.ErrNoChange:
+                g.Refund(ctx, a)
+                msg += fmt.Sprintf("_GitOps_: `%s` already sets the memory limit to at least %s.\n", gops.ValuesFile, b.To.String())
+            case err != nil:
+                g.Refund(ctx, a)
+                msg += fmt.Sprintf("_GitOps_: PR for the %s failed: %v\n", b, err)
+            default:
+                msg += fmt.Sprintf("_GitOps_: <%s|PR> raises the %s (+%d%%)%s.\n", pr, b, b.Percent, b.capNote())
+                rec.Extras = map[string]string{"gitopsPR": pr}
+                obs.ActionsTotal.WithLabelValues("memory_bump", ns, ownerName(pod)).Inc()
+            }
+        }
+    }
+    if rec.Extras != nil {
+        if _, err := sink.Save(ctx, key, rec); err != nil { klog.Warningf("oom: update incident record %s: %v", key, err) }
     }
-    _ = sl.Post(msg)
+    advice := ""
+    if ll.Enabled() { advice, _ = ll.Diagnose("Container OOMKilled", logs+"\n"+strings.Join(events, "\n")) }
+    ik := incidentKey(pod, "OOMKilled", cname)
+    if r.Mode != policy.Observe {
+        msg += tix.file(ctx, r, ik, incidentTicket(pod, "OOMKilled", cname, url, logs, events))
+        msg += pg.trigger(ctx, r, ik, pod, "OOMKilled", cname, url)
+    }
+    _ = postPodIncident(sl, r, ik, msg, advice, pending)
     obs.IncidentsTotal.WithLabelValues("OOMKilled", ns, ownerName(pod)).Inc()
 }
 
-func handleNodePressure(ctx context.Context, kc *kubernetes.Clientset, node *corev1.Node, pol *policy.Policy, sl *slack.Client) {
+// handleNodePressure pages memory or disk pressure on a node, cordons it
+// (global fix mode) and evicts its non-critical pods. Each pod follows the
+// policy that resolves for it: observe leaves it alone, suggest and
+// requireApproval queue the eviction, fix evicts through the guard. The alert
+// is resolved once the pressure clears. Only the agent running on the node
+// (NODE_NAME) handles it.
+func handleNodePressure(ctx context.Context, kc kubernetes.Interface, node *corev1.Node, pol *policy.Policy, sl *slack.Client, g *guard.Guard, q *approval.Queue, store *crd.Store, pg *Pager) {
+    if self := os.Getenv("NODE_NAME"); self != "" && self != node.Name { return }
     var memP, diskP bool
     for _, c := range node.Status.Conditions {
         if c.Type == corev1.NodeMemoryPressure && c.Status == corev1.ConditionTrue { memP = true }
         if c.Type == corev1.NodeDiskPressure && c.Status == corev1.ConditionTrue { diskP = true }
     }
+    if pol.Mode == policy.Observe { return }
+    if line := pg.node(ctx, node, memP, diskP); line != "" {
+        if memP || diskP {
+            _ = sl.Post(fmt.Sprintf("*NodePressure* on `%s` (mem:%t disk:%t)\n%s", node.Name, memP, diskP, line))
+        } else {
+            _ = sl.Post(fmt.Sprintf("*Resolved*: pressure on node `%s` cleared.\n%s", node.Name, line))
+        }
+    }
     if !(memP || diskP) { return }
 
-    if !node.Spec.Unschedulable {
+    // Cordoning is node-wide, so only the global mode decides it; in suggest
+    // mode it is left to the operator.
+    if pol.Mode == policy.Fix && !node.Spec.Unschedulable {
+        a := guard.Action{Type: "cordon_node", Workload: "node/" + node.Name, Labels: node.Labels}
+        if err := g.Allow(ctx, a); err != nil {
+            _ = sl.Post(fmt.Sprintf("*NodePressure* on `%s` (mem:%t disk:%t): cordon refused: %v", node.Name, memP, diskP, err))
+            return
+        }
         ncopy := node.DeepCopy()
         ncopy.Spec.Unschedulable = true
-        if _, err := kc.CoreV1().Nodes().Update(ctx, ncopy, metav1.UpdateOptions{}); err == nil {
+        if _, err := kc.CoreV1().Nodes().Update(ctx, ncopy, metav1.UpdateOptions{}); err != nil {
+            g.Refund(ctx, a)
+        } else {
             _ = sl.Post(fmt.Sprintf("*NodePressure*: cordoned node `%s` (mem:%t disk:%t)", node.Name, memP, diskP))
         }
     }
 
-    // Evict non-critical pods
-    pl, _ := kc.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String()})
+    pl, err := kc.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String()})
+    if err != nil { return }
     for _, p := range pl.Items {
-        if isCritical(&p) { continue }
-        // Evict
-        gr := int64(30)
-        ev := &policyv1.Eviction{
-            ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name},
-            DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: &gr},
+        if isCritical(&p) || !allowed(pol, p.Namespace) || hasAnno(&p, pol.ExcludedAnnotation) { continue }
+        r := resolve(pol, store, p.Namespace, p.Labels)
+        switch {
+        case r.Mode == policy.Observe:
+        case r.needsApproval():
+            line, id := propose(ctx, q, approval.Action{Kind: approval.EvictPod, Namespace: p.Namespace, Target: p.Name, Workload: ownerName(&p), Reason: "NodePressure", Labels: p.Labels,
+                Meta: map[string]string{approval.MetaSlackChannel: r.SlackChannel},
+                Summary: fmt.Sprintf("evict `%s/%s`", p.Namespace, p.Name)})
+            if line == "" { continue }
+            _ = postIncident(sl, r.SlackChannel, fmt.Sprintf("*NodePressure* on `%s` (mem:%t disk:%t): cordon recommended.\n%s", node.Name, memP, diskP, line), id)
+        default:
+            a := podAction("evict_pod", "NodePressure", &p)
+            if err := g.Allow(ctx, a); err != nil {
+                // Cluster or namespace budget gone: stop evicting until the window rolls.
+                if be, ok := err.(*guard.BudgetError); ok && be.Scope != guard.ScopeWorkload { return }
+                continue
+            }
+            gr := int64(30)
+            ev := &policyv1.Eviction{
+                ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name},
+                DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: &gr},
+            }
+            if err := kc.PolicyV1().Evictions(p.Namespace).Evict(ctx, ev); err != nil { g.Refund(ctx, a); continue }
+            obs.ActionsTotal.WithLabelValues("evict_pod", p.Namespace, ownerRef(&p)).Inc()
         }
-        _ = kc.PolicyV1().Evictions(p.Namespace).Evict(ctx, ev)
-        obs.ActionsTotal.WithLabelValues("evict_pod", p.Namespace, ownerRef(&p)).Inc()
     }
 }
 
-func isCritical(p *corev1.Pod) bool {
-    pc := p.Spec.PriorityClassName
-    if strings.HasPrefix(pc, "system-") { return true }
-    if strings.Contains(strings.ToLower(pc), "critical") { return true }
-    return false
+// incidentKey identifies a recurring pod incident across pod restarts and
+// rollouts: the pod-template-hash suffix of ReplicaSet owners is dropped.
+func incidentKey(p *corev1.Pod, reason, container string) string {
+    return fmt.Sprintf("%s/%s/%s/%s", p.Namespace, incidentOwner(p), reason, container)
 }
 
-func EvaluateAndScale(ctx context.Context, kc *kubernetes.Clientset, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client) {
-    // Multi-signal gating:
-    // - CPU > threshold
-    // - AND one of: queue depth high OR p95 latency above SLO OR error rate high
-    // Cooldowns and min/max replicas via annotations (simplified here).
-
-    for ns := range pol.NamespaceAllow {
-        dl, err := kc.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
-        if err != nil { continue }
-        for _, d := range dl.Items {
-            rep := int32(1); if d.Spec.Replicas != nil { rep = *d.Spec.Replicas }
-            last := d.Annotations["auto-agent.io/last-scale-ts"]
-            if last != "" {
-                if t, err := time.Parse(time.RFC3339, last); err==nil {
-                    if time.Since(t) < parseDur(getenv("COOLDOWN_UP","2m")) {
-                        continue
-                    }
-                }
-            }
+func incidentOwner(p *corev1.Pod) string {
+    owner := ownerName(p)
+    if h := p.Labels["pod-template-hash"]; h != "" { owner = strings.TrimSuffix(owner, "-"+h) }
+    return owner
+}
 
-            // CPU
-            cpu, err := mp.AvgDeploymentCPU(ctx, &d, getenv("SCALE_WINDOW","5m"))
-            if err != nil { continue }
-
-            // Optional signals via env/ConfigMap (could come from CRD per-app in full impl)
-            qDepthQ := getenv("PROM_QUEUE_DEPTH","")      // e.g., sum(queue_depth{deployment="X"})
-            errRateQ := getenv("PROM_ERROR_RATE","")      // e.g., rate(http_requests_total{code=~"5..",deployment="X"}[5m])
-            p95Q := getenv("PROM_P95_LATENCY","")         // e.g., histogram_quantile(0.95, ...)
-            // Naive namespace filter by deployment name
-            gateOK := false
-            if qDepthQ != "" {
-                if v, err := mp.QueryInstant(ctx, qDepthQ); err==nil && v > 0 { gateOK = true }
-            }
-            if !gateOK && errRateQ != "" {
-                if v, err := mp.QueryInstant(ctx, errRateQ); err==nil && v > 0 { gateOK = true }
-            }
-            if !gateOK && p95Q != "" {
-                if v, err := mp.QueryInstant(ctx, p95Q); err==nil && v > 0 { gateOK = true }
-            }
-            if p95Q == "" && qDepthQ == "" && errRateQ == "" { gateOK = true } // fallback: CPU-only
-
-            if cpu > parseFloat(getenv("SCALE_CPU_THRESHOLD","0.8")) && gateOK {
-                step := int32(1)
-                if step > int32(parseInt(getenv("MAX_SCALE_STEP","2"))) { step = int32(parseInt(getenv("MAX_SCALE_STEP","2"))) }
-                newRep := rep + step
-                d.Spec.Replicas = &newRep
-                if d.Annotations==nil { d.Annotations = map[string]string{} }
-                d.Annotations["auto-agent.io/last-scale-ts"] = time.Now().UTC().Format(time.RFC3339)
-                if _, err := kc.AppsV1().Deployments(ns).Update(ctx, &d, metav1.UpdateOptions{}); err == nil {
-                    msg := fmt.Sprintf("*ScaleUp*: `%s/%s` %d → %d (cpu=%.2f)", ns, d.Name, rep, newRep, cpu)
-                    _ = sl.Post(msg); obs.ActionsTotal.WithLabelValues("scale_up", ns, d.Name).Inc()
-                }
-            } else {
-                // Scale Down: only if CPU well below threshold and no gates active; long cooldown
-                lastDown := d.Annotations["auto-agent.io/last-scale-down-ts"]
-                if lastDown != "" {
-                    if t, err := time.Parse(time.RFC3339, lastDown); err==nil {
-                        if time.Since(t) < parseDur(getenv("COOLDOWN_DOWN","10m")) {
-                            continue
-                        }
-                    }
-                }
-                if rep > 1 && cpu < 0.3 && !gateOK {
-                    newRep := rep - 1
-                    d.Spec.Replicas = &newRep
-                    if d.Annotations==nil { d.Annotations = map[string]string{} }
-                    d.Annotations["auto-agent.io/last-scale-down-ts"] = time.Now().UTC().Format(time.RFC3339)
-                    if _, err := kc.AppsV1().Deployments(ns).Update(ctx, &d, metav1.UpdateOptions{}); err == nil {
-                        msg := fmt.Sprintf("*ScaleDown*: `%s/%s` %d → %d (cpu=%.2f)", ns, d.Name, rep, newRep, cpu)
-                        _ = sl.Post(msg); obs.ActionsTotal.WithLabelValues("scale_down", ns, d.Name).Inc()
-                    }
-                }
-            }
-        }
+func incidentTicket(p *corev1.Pod, reason, container, bundle, logs string, events []string) integrations.Ticket {
+    body := fmt.Sprintf("%s on pod %s/%s (container %s, node %s) at %s.", reason, p.Namespace, p.Name, container, p.Spec.NodeName, time.Now().UTC().Format(time.RFC3339))
+    var excerpt []string
+    if l := strings.TrimSpace(logs); l != "" { excerpt = append(excerpt, l) }
+    if len(events) > 10 { events = events[len(events)-10:] }
+    if len(events) > 0 { excerpt = append(excerpt, "Events:\n"+strings.Join(events, "\n")) }
+    return integrations.Ticket{
+        Title: fmt.Sprintf("%s: %s in %s", reason, strings.TrimPrefix(incidentKey(p, reason, container), p.Namespace+"/"), p.Namespace),
+        Body: body, Logs: strings.Join(excerpt, "\n\n"), BundleURL: bundle,
     }
 }
 
-func CheckAnomalies(ctx context.Context, kc *kubernetes.Clientset, mp metrics.Provider, pol *policy.Policy, sl *slack.Client, ll *llm.Client, store *crd.Store) {
-    // Iterate CRD policies and evaluate anomaly PromQLs (z-score assumed precomputed in PromQL or simple threshold).
-    // Here we just run the PromQL and if > 1, we post.
-    // In production, maintain state to require sustained breach.
-    nss := []string{}
-    // list namespaces from store
-    for ns, _ := range map[string]struct{}{} {
-        _ = ns; // placeholder
-    }
-    // Simplified: fetch all policies via List on a few known namespaces (would require store introspection methods).
-    // For brevity, we skip iteration details and just post a heartbeat in this scaffold.
-    _ = sl.Post("Anomaly evaluation tick (CRD-driven).")
+func isCritical(p *corev1.Pod) bool {
+    pc := p.Spec.PriorityClassName
+    if strings.HasPrefix(pc, "system-") { return true }
+    if strings.Contains(strings.ToLower(pc), "critical") { return true }
+    return false
 }
 
 func allowed(pol *policy.Policy, ns string) bool { _, ok := pol.NamespaceAllow[ns]; return ok }
@@ -302,6 +441,21 @@ func ownerName(p *corev1.Pod) string {
     return "pod/" + p.Name
 }
 
+func podAction(typ, reason string, p *corev1.Pod) guard.Action {
+    return guard.Action{Type: typ, Reason: reason, Namespace: p.Namespace, Workload: budgetWorkload(ownerName(p), p.Labels), Labels: p.Labels}
+}
+
+// budgetWorkload maps a pod owner to the workload its budget is kept under:
+// a Deployment's ReplicaSet becomes "deployment/<name>", matching the key the
+// scaling path uses. labels are the pod's.
+func budgetWorkload(owner string, labels map[string]string) string {
+    h := labels["pod-template-hash"]
+    if rs, ok := strings.CutPrefix(owner, "replicaset/"); ok && h != "" && strings.HasSuffix(rs, "-"+h) {
+        return "deployment/" + strings.TrimSuffix(rs, "-"+h)
+    }
+    return owner
+}
+
 func ownerRef(p *corev1.Pod) string {
     for _, o := range p.OwnerReferences {
         if o.Controller != nil && *o.Controller {
@@ -311,6 +465,46 @@ func ownerRef(p *corev1.Pod) string {
     return p.Name
 }
 
+// mirrorImage points image at the mirror prefix, replacing its registry host
+// if it has one: "mirror.example.com/hub" and "nginx:1.25" give
+// "mirror.example.com/hub/nginx:1.25". An image already under prefix is
+// returned unchanged.
+func mirrorImage(prefix, image string) string {
+    prefix = strings.TrimSuffix(prefix, "/")
+    if prefix == "" || image == "" || strings.HasPrefix(image, prefix+"/") { return image }
+    rest := image
+    if i := strings.IndexByte(image, '/'); i > 0 {
+        if h := image[:i]; strings.ContainsAny(h, ".:") || h == "localhost" { rest = image[i+1:] }
+    }
+    return prefix + "/" + rest
+}
+
+// mirrorAllowed reports whether image's repository is on allow. Entries are
+// repositories ("docker.io/library/nginx") or repository prefixes
+// ("ghcr.io/org"); Docker Hub short names are expanded before matching. An
+// empty list allows nothing.
+func mirrorAllowed(allow []string, image string) bool {
+    repo := imageRepo(image)
+    for _, a := range allow {
+        a = strings.TrimSuffix(a, "/")
+        if a != "" && (repo == a || strings.HasPrefix(repo, a+"/")) { return true }
+    }
+    return false
+}
+
+// imageRepo returns the fully qualified repository of image, without tag or
+// digest: "nginx:1.25" gives "docker.io/library/nginx".
+func imageRepo(image string) string {
+    if i := strings.IndexByte(image, '@'); i >= 0 { image = image[:i] }
+    if i := strings.LastIndexByte(image, ':'); i > strings.LastIndexByte(image, '/') { image = image[:i] }
+    host, path := "docker.io", image
+    if i := strings.IndexByte(image, '/'); i > 0 {
+        if h := image[:i]; strings.ContainsAny(h, ".:") || h == "localhost" { host, path = h, image[i+1:] }
+    }
+    if host == "docker.io" && !strings.Contains(path, "/") { path = "library/" + path }
+    return host + "/" + path
+}
+
 func imageOf(p *corev1.Pod, cname string) string {
     for _, c := range p.Spec.Containers {
         if c.Name == cname { return c.Image }
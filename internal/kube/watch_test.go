@@ -0,0 +1,46 @@
+package kube
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+
+    "github.com/yourorg/auto-agent/internal/guard"
+    "github.com/yourorg/auto-agent/internal/policy"
+    "github.com/yourorg/auto-agent/internal/slack"
+)
+
+func TestNodePressureOnlyOnOwnNode(t *testing.T) {
+    node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+        {Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue}}}}
+    pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-1"}, Spec: corev1.PodSpec{NodeName: "n1"}}
+    pol := &policy.Policy{Mode: policy.Fix, NamespaceAllow: map[string]struct{}{"shop": {}}}
+    tests := []struct {
+        self       string
+        wantCordon bool
+    }{
+        {self: "n2", wantCordon: false},
+        {self: "n1", wantCordon: true},
+        {self: "", wantCordon: true},
+    }
+    for _, tt := range tests {
+        t.Run("NODE_NAME="+tt.self, func(t *testing.T) {
+            t.Setenv("NODE_NAME", tt.self)
+            kc := fake.NewSimpleClientset(node.DeepCopy(), pod.DeepCopy())
+            g := guard.New(pol, nil, nil, nil)
+            handleNodePressure(context.Background(), kc, node, pol, slack.New(""), g, nil, nil, nil)
+
+            n, err := kc.CoreV1().Nodes().Get(context.Background(), "n1", metav1.GetOptions{})
+            if err != nil { t.Fatal(err) }
+            if n.Spec.Unschedulable != tt.wantCordon { t.Errorf("cordoned = %t, want %t", n.Spec.Unschedulable, tt.wantCordon) }
+            evicted := false
+            for _, a := range kc.Actions() {
+                if a.GetSubresource() == "eviction" { evicted = true }
+            }
+            if evicted != tt.wantCordon { t.Errorf("evicted = %t, want %t", evicted, tt.wantCordon) }
+        })
+    }
+}
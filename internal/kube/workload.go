@@ -0,0 +1,149 @@
+package kube
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/util/retry"
+    "k8s.io/klog/v2"
+
+    "github.com/yourorg/auto-agent/internal/metrics"
+)
+
+var (
+    deploymentsGVR  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+    statefulSetsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+    replicaSetsGVR  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}
+)
+
+// workload is a scalable object: anything exposing the /scale subresource.
+type workload struct {
+    metrics.Workload
+    GVR         schema.GroupVersionResource
+    Replicas    int32
+    Annotations map[string]string
+}
+
+func (w *workload) String() string { return fmt.Sprintf("%s `%s/%s`", w.Kind, w.Namespace, w.Name) }
+
+// listWorkloads returns the scalable workloads of ns: Deployments,
+// StatefulSets, ReplicaSets not owned by a controller, and objects of the
+// custom resources named in SCALE_EXTRA_RESOURCES (e.g. Argo Rollouts).
+func listWorkloads(ctx context.Context, kc kubernetes.Interface, dyn dynamic.Interface, ns string) ([]workload, error) {
+    var out []workload
+    dl, err := kc.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+    if err != nil { return nil, err }
+    for _, d := range dl.Items {
+        out = append(out, newWorkload("Deployment", deploymentsGVR, d.ObjectMeta, d.Spec.Replicas, d.Spec.Selector, d.Spec.Template))
+    }
+    sl, err := kc.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+    if err != nil { return nil, err }
+    for _, s := range sl.Items {
+        out = append(out, newWorkload("StatefulSet", statefulSetsGVR, s.ObjectMeta, s.Spec.Replicas, s.Spec.Selector, s.Spec.Template))
+    }
+    rl, err := kc.AppsV1().ReplicaSets(ns).List(ctx, metav1.ListOptions{})
+    if err != nil { return nil, err }
+    for _, r := range rl.Items {
+        if metav1.GetControllerOf(&r) != nil { continue } // scaled through its Deployment
+        out = append(out, newWorkload("ReplicaSet", replicaSetsGVR, r.ObjectMeta, r.Spec.Replicas, r.Spec.Selector, r.Spec.Template))
+    }
+    for _, gvr := range extraScaleResources() {
+        l, err := dyn.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+        if err != nil { klog.V(2).Infof("scale: list %s in %s: %v", gvr.Resource, ns, err); continue }
+        for i := range l.Items {
+            if w, ok := workloadFromUnstructured(gvr, &l.Items[i]); ok { out = append(out, w) }
+        }
+    }
+    return out, nil
+}
+
+func newWorkload(kind string, gvr schema.GroupVersionResource, om metav1.ObjectMeta, rep *int32, sel *metav1.LabelSelector, tpl corev1.PodTemplateSpec) workload {
+    w := workload{
+        Workload: metrics.Workload{Kind: kind, Namespace: om.Namespace, Name: om.Name, Selector: sel, Template: tpl},
+        GVR: gvr, Replicas: 1, Annotations: om.Annotations,
+    }
+    if rep != nil { w.Replicas = *rep }
+    return w
+}
+
+// workloadFromUnstructured reads the Deployment-shaped spec (replicas,
+// selector, template) most scalable CRDs share. Objects without an inline
+// template (e.g. a Rollout using workloadRef) are skipped.
+func workloadFromUnstructured(gvr schema.GroupVersionResource, u *unstructured.Unstructured) (workload, bool) {
+    var o struct {
+        Spec struct {
+            Replicas *int32                 `json:"replicas"`
+            Selector *metav1.LabelSelector  `json:"selector"`
+            Template corev1.PodTemplateSpec `json:"template"`
+        } `json:"spec"`
+    }
+    if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &o); err != nil { return workload{}, false }
+    if o.Spec.Selector == nil || len(o.Spec.Template.Spec.Containers) == 0 { return workload{}, false }
+    om := metav1.ObjectMeta{Namespace: u.GetNamespace(), Name: u.GetName(), Annotations: u.GetAnnotations()}
+    return newWorkload(u.GetKind(), gvr, om, o.Spec.Replicas, o.Spec.Selector, o.Spec.Template), true
+}
+
+// extraScaleResources parses SCALE_EXTRA_RESOURCES, a comma separated list of
+// group/version/resource (e.g. "argoproj.io/v1alpha1/rollouts").
+func extraScaleResources() []schema.GroupVersionResource {
+    var out []schema.GroupVersionResource
+    for _, s := range strings.Split(getenv("SCALE_EXTRA_RESOURCES", ""), ",") {
+        if gvr, err := parseGVR(strings.TrimSpace(s)); err == nil { out = append(out, gvr) }
+    }
+    return out
+}
+
+// parseGVR parses group/version/resource, or version/resource for the core group.
+func parseGVR(s string) (schema.GroupVersionResource, error) {
+    p := strings.Split(s, "/")
+    switch len(p) {
+    case 3:
+        return schema.GroupVersionResource{Group: p[0], Version: p[1], Resource: p[2]}, nil
+    case 2:
+        return schema.GroupVersionResource{Version: p[0], Resource: p[1]}, nil
+    }
+    return schema.GroupVersionResource{}, fmt.Errorf("bad resource %q, want group/version/resource", s)
+}
+
+func gvrString(gvr schema.GroupVersionResource) string {
+    if gvr.Group == "" { return gvr.Version + "/" + gvr.Resource }
+    return gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+// scaleTo sets the replica count through the /scale subresource, retrying on
+// conflicts, and returns the count it replaced.
+func scaleTo(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, ns, name string, to int32) (int32, error) {
+    var from int32
+    err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        sc, err := dyn.Resource(gvr).Namespace(ns).Get(ctx, name, metav1.GetOptions{}, "scale")
+        if err != nil { return err }
+        cur, _, _ := unstructured.NestedInt64(sc.Object, "spec", "replicas")
+        from = int32(cur)
+        if err := unstructured.SetNestedField(sc.Object, int64(to), "spec", "replicas"); err != nil { return err }
+        _, err = dyn.Resource(gvr).Namespace(ns).Update(ctx, sc, metav1.UpdateOptions{FieldManager: fieldManager}, "scale")
+        return err
+    })
+    return from, err
+}
+
+// markScaled stamps the cooldown annotations read by EvaluateAndScale with a
+// metadata-only merge patch, so spec changes by other writers are preserved.
+func markScaled(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, ns, name, direction string) error {
+    now := time.Now().UTC().Format(time.RFC3339)
+    ann := map[string]string{"auto-agent.io/last-scale-ts": now}
+    if direction == "down" { ann["auto-agent.io/last-scale-down-ts"] = now }
+    patch, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": ann}})
+    _, err := dyn.Resource(gvr).Namespace(ns).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+    return err
+}
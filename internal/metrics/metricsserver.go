@@ -0,0 +1,69 @@
+package metrics
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/dynamic"
+)
+
+// ErrUnsupported is returned for queries a provider cannot answer, e.g. PromQL
+// against metrics-server.
+var ErrUnsupported = errors.New("unsupported by metrics provider")
+
+var podMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// metricsServer reads metrics.k8s.io PodMetrics. It only knows current usage:
+// the window argument is ignored (metrics-server averages over its own
+// resolution, typically 15s-60s) and PromQL queries fail with ErrUnsupported.
+type metricsServer struct{ dyn dynamic.Interface }
+
+// AvgWorkloadCPU returns the average CPU utilisation of the workload's pods
+// relative to their requests (1.0 == using exactly the requested CPU).
+func (m *metricsServer) AvgWorkloadCPU(ctx context.Context, d Workload, window string) (float64, error) {
+    var req resource.Quantity
+    for _, c := range d.Template.Spec.Containers {
+        if q, ok := c.Resources.Requests["cpu"]; ok { req.Add(q) }
+    }
+    if req.IsZero() { return 0, fmt.Errorf("metrics-server: %s/%s has no CPU requests", d.Namespace, d.Name) }
+    if d.Selector == nil { return 0, fmt.Errorf("metrics-server: %s/%s has no selector", d.Namespace, d.Name) }
+    sel, err := metav1.LabelSelectorAsSelector(d.Selector)
+    if err != nil { return 0, fmt.Errorf("metrics-server: selector: %w", err) }
+
+    list, err := m.dyn.Resource(podMetricsGVR).Namespace(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+    if err != nil { return 0, fmt.Errorf("metrics-server: %w", err) }
+    var sum float64
+    n := 0
+    for _, pm := range list.Items {
+        cs, _ := pm.Object["containers"].([]interface{})
+        var used resource.Quantity
+        for _, c := range cs {
+            cm, _ := c.(map[string]interface{})
+            usage, _ := cm["usage"].(map[string]interface{})
+            s, _ := usage["cpu"].(string)
+            if s == "" { continue }
+            q, err := resource.ParseQuantity(s)
+            if err != nil { return 0, fmt.Errorf("metrics-server: %s: cpu %q: %w", pm.GetName(), s, err) }
+            used.Add(q)
+        }
+        sum += float64(used.MilliValue()) / float64(req.MilliValue())
+        n++
+    }
+    if n == 0 { return 0, ErrNoData }
+    return sum / float64(n), nil
+}
+
+func (*metricsServer) QueryInstant(ctx context.Context, q string) (float64, error) {
+    return 0, fmt.Errorf("metrics-server: PromQL: %w", ErrUnsupported)
+}
+func (*metricsServer) QueryVector(ctx context.Context, q string) ([]Sample, error) {
+    return nil, fmt.Errorf("metrics-server: PromQL: %w", ErrUnsupported)
+}
+func (*metricsServer) QueryRange(ctx context.Context, q string, start, end time.Time, step time.Duration) ([]Series, error) {
+    return nil, fmt.Errorf("metrics-server: PromQL range queries: %w", ErrUnsupported)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+    "context"
+    "errors"
+    "math"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func podMetrics(ns, name string, labels map[string]string, cpu ...string) *unstructured.Unstructured {
+    var cs []interface{}
+    for _, c := range cpu { cs = append(cs, map[string]interface{}{"name": "c", "usage": map[string]interface{}{"cpu": c, "memory": "10Mi"}}) }
+    u := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "metrics.k8s.io/v1beta1", "kind": "PodMetrics", "containers": cs}}
+    u.SetNamespace(ns); u.SetName(name); u.SetLabels(labels)
+    return u
+}
+
+// newMetricsServer serves pms as PodMetrics. They are created through the
+// client: the fake would guess "podmetricses" as their resource.
+func newMetricsServer(t *testing.T, pms ...*unstructured.Unstructured) *metricsServer {
+    dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{podMetricsGVR: "PodMetricsList"})
+    for _, pm := range pms {
+        if _, err := dyn.Resource(podMetricsGVR).Namespace(pm.GetNamespace()).Create(context.Background(), pm, metav1.CreateOptions{}); err != nil { t.Fatal(err) }
+    }
+    return &metricsServer{dyn: dyn}
+}
+
+func workload(sel *metav1.LabelSelector, requests ...string) Workload {
+    w := Workload{Kind: "Deployment", Namespace: "shop", Name: "api", Selector: sel}
+    for _, r := range requests {
+        c := corev1.Container{Name: "c"}
+        if r != "" { c.Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(r)} }
+        w.Template.Spec.Containers = append(w.Template.Spec.Containers, c)
+    }
+    return w
+}
+
+func TestMetricsServerAvgWorkloadCPU(t *testing.T) {
+    api := map[string]string{"app": "api"}
+    ms := newMetricsServer(t,
+        podMetrics("shop", "api-1", api, "100m", "100m"),   // 200m of 400m
+        podMetrics("shop", "api-2", api, "300m", "500000n"), // 301m of 400m: nanocores round up to 1m
+        podMetrics("shop", "web-1", map[string]string{"app": "web"}, "2"),
+        podMetrics("other", "api-1", api, "2"),
+    )
+    tests := []struct {
+        name string
+        sel  *metav1.LabelSelector
+        want float64
+    }{
+        {name: "matchLabels", sel: &metav1.LabelSelector{MatchLabels: api}, want: (0.5 + 301.0/400) / 2},
+        {name: "matchExpressions", sel: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"api"}}}}, want: (0.5 + 301.0/400) / 2},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ms.AvgWorkloadCPU(context.Background(), workload(tt.sel, "200m", "200m", ""), "5m")
+            if err != nil { t.Fatal(err) }
+            if math.Abs(got-tt.want) > 1e-3 { t.Errorf("AvgWorkloadCPU = %v, want %v", got, tt.want) }
+        })
+    }
+}
+
+func TestMetricsServerErrors(t *testing.T) {
+    sel := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}
+    ctx := context.Background()
+    if _, err := newMetricsServer(t).AvgWorkloadCPU(ctx, workload(sel, ""), "5m"); err == nil { t.Error("no CPU requests: want an error") }
+    if _, err := newMetricsServer(t).AvgWorkloadCPU(ctx, workload(nil, "100m"), "5m"); err == nil { t.Error("no selector: want an error") }
+    if _, err := newMetricsServer(t).AvgWorkloadCPU(ctx, workload(sel, "100m"), "5m"); !errors.Is(err, ErrNoData) { t.Errorf("no pods: err = %v, want ErrNoData", err) }
+    bad := newMetricsServer(t, podMetrics("shop", "api-1", map[string]string{"app": "api"}, "lots"))
+    if _, err := bad.AvgWorkloadCPU(ctx, workload(sel, "100m"), "5m"); err == nil { t.Error("bad quantity: want an error") }
+    if _, err := newMetricsServer(t).QueryInstant(ctx, "up"); !errors.Is(err, ErrUnsupported) { t.Errorf("PromQL: err = %v, want ErrUnsupported", err) }
+}
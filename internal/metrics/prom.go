@@ -0,0 +1,212 @@
+package metrics
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "k8s.io/klog/v2"
+)
+
+// ErrNoData is returned by QueryInstant when the query matched no series.
+var ErrNoData = errors.New("no data")
+
+// APIError is a failed Prometheus API call: a non-2xx response and/or a
+// body with status "error".
+type APIError struct {
+    HTTPStatus int
+    ErrorType  string // e.g. bad_data, timeout, execution
+    Message    string
+    Warnings   []string
+}
+
+func (e *APIError) Error() string {
+    msg := fmt.Sprintf("prometheus: HTTP %d", e.HTTPStatus)
+    if e.ErrorType != "" { msg += " " + e.ErrorType }
+    if e.Message != "" { msg += ": " + e.Message }
+    return msg
+}
+
+// WarningError accompanies a successful result when Prometheus returned
+// warnings (e.g. a partial response from Thanos/Mimir). The data returned
+// alongside it may be incomplete; callers that can live with that can check
+// errors.As and keep it.
+type WarningError struct{ Warnings []string }
+
+func (e *WarningError) Error() string { return "prometheus warnings: " + strings.Join(e.Warnings, "; ") }
+
+// IgnoreWarnings logs the warnings of a *WarningError and returns nil for it,
+// so the possibly partial data is used; any other error is returned as is.
+func IgnoreWarnings(q string, err error) error {
+    var we *WarningError
+    if !errors.As(err, &we) { return err }
+    klog.V(1).Infof("prometheus: partial result for %q: %s", q, strings.Join(we.Warnings, "; "))
+    return nil
+}
+
+type prom struct {
+    base      string
+    hc        *http.Client
+    timeout   time.Duration
+    headers   http.Header
+    token     secret
+    basicUser string
+    basicPass secret
+}
+
+type apiResponse struct {
+    Status    string          `json:"status"`
+    ErrorType string          `json:"errorType"`
+    Error     string          `json:"error"`
+    Warnings  []string        `json:"warnings"`
+    Data      json.RawMessage `json:"data"`
+}
+
+type apiData struct {
+    ResultType string          `json:"resultType"`
+    Result     json.RawMessage `json:"result"`
+}
+
+// get runs one API call, bounded by both ctx and the per-query timeout; the
+// timeout is also passed to Prometheus so it stops evaluating.
+func (p *prom) get(ctx context.Context, path string, params url.Values) (*apiData, error) {
+    if p.timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, p.timeout)
+        defer cancel()
+        params.Set("timeout", p.timeout.String())
+    }
+    u := strings.TrimRight(p.base, "/") + path + "?" + params.Encode()
+    req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+    if err != nil { return nil, err }
+    if err := p.authorize(req); err != nil { return nil, err }
+    resp, err := p.hc.Do(req)
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+    b, err := io.ReadAll(resp.Body)
+    if err != nil { return nil, err }
+
+    var out apiResponse
+    jerr := json.Unmarshal(b, &out)
+    if resp.StatusCode/100 != 2 || out.Status == "error" {
+        e := &APIError{HTTPStatus: resp.StatusCode, ErrorType: out.ErrorType, Message: out.Error, Warnings: out.Warnings}
+        if jerr != nil { e.Message = strings.TrimSpace(string(truncate(b, 512))) }
+        return nil, e
+    }
+    if jerr != nil { return nil, fmt.Errorf("prometheus: decode response: %w", jerr) }
+    var d apiData
+    if err := json.Unmarshal(out.Data, &d); err != nil { return nil, fmt.Errorf("prometheus: decode data: %w", err) }
+    if len(out.Warnings) > 0 { return &d, &WarningError{Warnings: out.Warnings} }
+    return &d, nil
+}
+
+func (p *prom) QueryVector(ctx context.Context, q string) ([]Sample, error) {
+    d, err := p.get(ctx, "/api/v1/query", url.Values{"query": {q}})
+    if d == nil { return nil, err }
+    var out []Sample
+    switch d.ResultType {
+    case "vector":
+        var res []struct {
+            Metric map[string]string `json:"metric"`
+            Value  [2]interface{}    `json:"value"`
+        }
+        if err := json.Unmarshal(d.Result, &res); err != nil { return nil, fmt.Errorf("prometheus: decode vector: %w", err) }
+        for _, r := range res {
+            t, v, perr := parsePair(r.Value)
+            if perr != nil { return nil, perr }
+            out = append(out, Sample{Labels: r.Metric, Time: t, Value: v})
+        }
+    case "scalar":
+        var pair [2]interface{}
+        if err := json.Unmarshal(d.Result, &pair); err != nil { return nil, fmt.Errorf("prometheus: decode scalar: %w", err) }
+        t, v, perr := parsePair(pair)
+        if perr != nil { return nil, perr }
+        out = append(out, Sample{Labels: map[string]string{}, Time: t, Value: v})
+    default:
+        return nil, fmt.Errorf("prometheus: unexpected result type %q for instant query", d.ResultType)
+    }
+    return out, err
+}
+
+// QueryInstant returns the first sample of q. Results with warnings (e.g. a
+// Thanos/Mimir partial response) are used, and the warnings logged.
+func (p *prom) QueryInstant(ctx context.Context, q string) (float64, error) {
+    ss, err := p.QueryVector(ctx, q)
+    if err = IgnoreWarnings(q, err); err != nil { return 0, err }
+    if len(ss) == 0 { return 0, ErrNoData }
+    return ss[0].Value, nil
+}
+
+func (p *prom) QueryRange(ctx context.Context, q string, start, end time.Time, step time.Duration) ([]Series, error) {
+    if step <= 0 { return nil, fmt.Errorf("prometheus: step must be positive") }
+    params := url.Values{
+        "query": {q},
+        "start": {strconv.FormatInt(start.Unix(), 10)},
+        "end":   {strconv.FormatInt(end.Unix(), 10)},
+        "step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+    }
+    d, err := p.get(ctx, "/api/v1/query_range", params)
+    if d == nil { return nil, err }
+    if d.ResultType != "matrix" { return nil, fmt.Errorf("prometheus: unexpected result type %q for range query", d.ResultType) }
+    var res []struct {
+        Metric map[string]string `json:"metric"`
+        Values [][2]interface{}  `json:"values"`
+    }
+    if err := json.Unmarshal(d.Result, &res); err != nil { return nil, fmt.Errorf("prometheus: decode matrix: %w", err) }
+    out := make([]Series, 0, len(res))
+    for _, r := range res {
+        s := Series{Labels: r.Metric, Points: make([]Point, 0, len(r.Values))}
+        for _, pair := range r.Values {
+            t, v, perr := parsePair(pair)
+            if perr != nil { return nil, perr }
+            s.Points = append(s.Points, Point{Time: t, Value: v})
+        }
+        out = append(out, s)
+    }
+    return out, err
+}
+
+// AvgWorkloadCPU averages the CPU usage of w's pods over window relative to
+// their requests, as metricsServer does (1.0 == using exactly the requested
+// CPU); requests come from kube-state-metrics, and pods without CPU requests
+// are left out. Pods are found through their owner (see PodsOf), not their
+// names.
+func (p *prom) AvgWorkloadCPU(ctx context.Context, w Workload, window string) (float64, error) {
+    q := fmt.Sprintf(`avg(sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{namespace=%q,container!="",image!=""}[%s])) / sum by (namespace, pod) (kube_pod_container_resource_requests{namespace=%q,resource="cpu"}) * on (namespace, pod) group_left() %s)`, w.Namespace, window, w.Namespace, PodsOf(w))
+    return p.QueryInstant(ctx, q)
+}
+
+// PodsOf returns a PromQL vector with one series of value 1 per pod of w,
+// labelled namespace and pod, from kube-state-metrics' owner metrics: pods
+// owned by w directly (StatefulSet, DaemonSet, bare ReplicaSet) or through a
+// ReplicaSet it owns (Deployment, Argo Rollout). Join on (namespace, pod) to
+// restrict per-pod series to the workload; unlike a pod name prefix it does
+// not match siblings such as api-worker for api.
+func PodsOf(w Workload) string {
+    direct := fmt.Sprintf(`kube_pod_owner{namespace=%q,owner_kind=%q,owner_name=%q}`, w.Namespace, w.Kind, w.Name)
+    rs := fmt.Sprintf(`label_replace(kube_replicaset_owner{namespace=%q,owner_kind=%q,owner_name=%q}, "owner_name", "$1", "replicaset", "(.*)")`, w.Namespace, w.Kind, w.Name)
+    viaRS := fmt.Sprintf(`kube_pod_owner{namespace=%q,owner_kind="ReplicaSet"} * on (namespace, owner_name) group_left() max by (namespace, owner_name) (%s)`, w.Namespace, rs)
+    return fmt.Sprintf(`(max by (namespace, pod) (%s) or max by (namespace, pod) (%s))`, direct, viaRS)
+}
+
+// parsePair decodes a [<unix seconds>, "<value>"] pair.
+func parsePair(pair [2]interface{}) (time.Time, float64, error) {
+    ts, ok := pair[0].(float64)
+    if !ok { return time.Time{}, 0, fmt.Errorf("prometheus: bad timestamp %v", pair[0]) }
+    s, ok := pair[1].(string)
+    if !ok { return time.Time{}, 0, fmt.Errorf("prometheus: bad sample value %v", pair[1]) }
+    v, err := strconv.ParseFloat(s, 64)
+    if err != nil { return time.Time{}, 0, fmt.Errorf("prometheus: bad sample value %q: %w", s, err) }
+    sec, frac := math.Modf(ts)
+    return time.Unix(int64(sec), int64(frac*1e9)), v, nil
+}
+
+func truncate(b []byte, n int) []byte { if len(b) > n { return b[:n] }; return b }
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// AvgWorkloadCPU must be a fraction of the pods' CPU requests, like the
+// metrics-server provider's, since both are compared to SCALE_CPU_THRESHOLD.
+func TestPromAvgWorkloadCPUIsRelativeToRequests(t *testing.T) {
+    var q string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        q = r.FormValue("query")
+        w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.85"]}]}}`))
+    }))
+    defer srv.Close()
+    p, err := newProm(promConfig{BaseURL: srv.URL})
+    if err != nil { t.Fatal(err) }
+    w := Workload{Kind: "Deployment", Namespace: "shop", Name: "api"}
+
+    got, err := p.AvgWorkloadCPU(context.Background(), w, "5m")
+    if err != nil { t.Fatal(err) }
+    if got != 0.85 { t.Errorf("AvgWorkloadCPU = %v, want 0.85", got) }
+    for _, want := range []string{
+        `sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{namespace="shop",container!="",image!=""}[5m]))`,
+        ` / sum by (namespace, pod) (kube_pod_container_resource_requests{namespace="shop",resource="cpu"})`,
+        `* on (namespace, pod) group_left() ` + PodsOf(w),
+    } {
+        if !strings.Contains(q, want) { t.Errorf("query %s\nlacks %s", q, want) }
+    }
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// promConfig is the connection config of the prometheus provider, read from
+// PROMETHEUS_* env vars. Secrets may be given inline or as files; files are
+// re-read when they change so rotated tokens are picked up without restart.
+type promConfig struct {
+    BaseURL            string
+    Timeout            time.Duration // per query, on top of the caller's context
+    BearerToken        string
+    BearerTokenFile    string
+    BasicUser          string
+    BasicPassword      string
+    BasicPasswordFile  string
+    CAFile             string
+    CertFile, KeyFile  string // client certificate for mTLS
+    ServerName         string
+    InsecureSkipVerify bool
+    Headers            http.Header // e.g. X-Scope-OrgID for Mimir/Cortex/Thanos tenants
+}
+
+func promConfigFromEnv() promConfig {
+    c := promConfig{
+        BaseURL:            getenv("PROMETHEUS_URL", ""),
+        Timeout:            30 * time.Second,
+        BearerToken:        os.Getenv("PROMETHEUS_BEARER_TOKEN"),
+        BearerTokenFile:    os.Getenv("PROMETHEUS_BEARER_TOKEN_FILE"),
+        BasicUser:          os.Getenv("PROMETHEUS_BASIC_AUTH_USERNAME"),
+        BasicPassword:      os.Getenv("PROMETHEUS_BASIC_AUTH_PASSWORD"),
+        BasicPasswordFile:  os.Getenv("PROMETHEUS_BASIC_AUTH_PASSWORD_FILE"),
+        CAFile:             os.Getenv("PROMETHEUS_CA_FILE"),
+        CertFile:           os.Getenv("PROMETHEUS_CERT_FILE"),
+        KeyFile:            os.Getenv("PROMETHEUS_KEY_FILE"),
+        ServerName:         os.Getenv("PROMETHEUS_TLS_SERVER_NAME"),
+        InsecureSkipVerify: strings.EqualFold(os.Getenv("PROMETHEUS_INSECURE_SKIP_VERIFY"), "true"),
+        Headers:            http.Header{},
+    }
+    if d, err := time.ParseDuration(os.Getenv("PROMETHEUS_TIMEOUT")); err == nil && d > 0 { c.Timeout = d }
+    // PROMETHEUS_HEADERS: one "Name=value" per line; values may contain commas
+    for _, kv := range strings.Split(os.Getenv("PROMETHEUS_HEADERS"), "\n") {
+        if k, v, ok := strings.Cut(kv, "="); ok && strings.TrimSpace(k) != "" {
+            c.Headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+        }
+    }
+    if org := os.Getenv("PROMETHEUS_ORG_ID"); org != "" { c.Headers.Set("X-Scope-OrgID", org) }
+    return c
+}
+
+func newProm(c promConfig) (*prom, error) {
+    if c.BaseURL == "" { return nil, fmt.Errorf("PROMETHEUS_URL required for prometheus provider") }
+    if (c.BearerToken != "" || c.BearerTokenFile != "") && c.BasicUser != "" { return nil, fmt.Errorf("prometheus: bearer token and basic auth are mutually exclusive") }
+    tlsCfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+    if c.CAFile != "" {
+        pem, err := os.ReadFile(c.CAFile)
+        if err != nil { return nil, fmt.Errorf("prometheus: CA file: %w", err) }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) { return nil, fmt.Errorf("prometheus: no certificates in %s", c.CAFile) }
+        tlsCfg.RootCAs = pool
+    }
+    if c.CertFile != "" || c.KeyFile != "" {
+        if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil { return nil, fmt.Errorf("prometheus: client cert: %w", err) }
+        // Loaded per handshake so rotated certificates are used on new connections.
+        tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+            crt, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+            return &crt, err
+        }
+    }
+    tr := http.DefaultTransport.(*http.Transport).Clone()
+    tr.TLSClientConfig = tlsCfg
+    p := &prom{
+        base: c.BaseURL, timeout: c.Timeout, headers: c.Headers,
+        hc: &http.Client{Transport: tr},
+    }
+    switch {
+    case c.BearerTokenFile != "":
+        p.token = &fileSecret{path: c.BearerTokenFile}
+    case c.BearerToken != "":
+        p.token = staticSecret(c.BearerToken)
+    }
+    if c.BasicUser != "" {
+        p.basicUser = c.BasicUser
+        p.basicPass = staticSecret(c.BasicPassword)
+        if c.BasicPasswordFile != "" { p.basicPass = &fileSecret{path: c.BasicPasswordFile} }
+    }
+    return p, nil
+}
+
+// authorize sets auth and extra headers on an outgoing request.
+func (p *prom) authorize(req *http.Request) error {
+    for k, vs := range p.headers {
+        for _, v := range vs { req.Header.Add(k, v) }
+    }
+    if p.token != nil {
+        t, err := p.token.get()
+        if err != nil { return fmt.Errorf("prometheus: bearer token: %w", err) }
+        req.Header.Set("Authorization", "Bearer "+t)
+    }
+    if p.basicUser != "" {
+        pw, err := p.basicPass.get()
+        if err != nil { return fmt.Errorf("prometheus: basic auth password: %w", err) }
+        req.SetBasicAuth(p.basicUser, pw)
+    }
+    return nil
+}
+
+type secret interface{ get() (string, error) }
+
+type staticSecret string
+
+func (s staticSecret) get() (string, error) { return string(s), nil }
+
+// fileSecret re-reads its file whenever the modification time changes, which
+// covers projected service account tokens and rotated Secret mounts.
+type fileSecret struct {
+    path  string
+    mu    sync.Mutex
+    mtime time.Time
+    val   string
+}
+
+func (f *fileSecret) get() (string, error) {
+    f.mu.Lock(); defer f.mu.Unlock()
+    st, err := os.Stat(f.path)
+    if err != nil {
+        if f.val != "" { return f.val, nil }
+        return "", err
+    }
+    if f.val == "" || !st.ModTime().Equal(f.mtime) {
+        b, err := os.ReadFile(f.path)
+        if err != nil { return "", err }
+        f.val, f.mtime = strings.TrimSpace(string(b)), st.ModTime()
+    }
+    return f.val, nil
+}
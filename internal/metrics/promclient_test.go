@@ -0,0 +1,57 @@
+package metrics
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestPromConfigHeaders(t *testing.T) {
+    t.Setenv("PROMETHEUS_URL", "http://prom:9090")
+    t.Setenv("PROMETHEUS_HEADERS", "X-Custom=a,b,c\n Accept-Encoding = identity \n\nbogus\nX-Custom=d")
+    t.Setenv("PROMETHEUS_ORG_ID", "tenant-1")
+    c := promConfigFromEnv()
+    if got := c.Headers.Values("X-Custom"); len(got) != 2 || got[0] != "a,b,c" || got[1] != "d" { t.Errorf("X-Custom = %q", got) }
+    if got := c.Headers.Get("Accept-Encoding"); got != "identity" { t.Errorf("Accept-Encoding = %q", got) }
+    if got := c.Headers.Get("X-Scope-OrgID"); got != "tenant-1" { t.Errorf("X-Scope-OrgID = %q", got) }
+    if len(c.Headers) != 3 { t.Errorf("headers = %v", c.Headers) }
+}
+
+func TestNewPromAuthExclusive(t *testing.T) {
+    tests := []struct {
+        name    string
+        c       promConfig
+        wantErr bool
+    }{
+        {name: "token", c: promConfig{BaseURL: "http://p", BearerToken: "t"}},
+        {name: "token file", c: promConfig{BaseURL: "http://p", BearerTokenFile: "/tok"}},
+        {name: "basic", c: promConfig{BaseURL: "http://p", BasicUser: "u", BasicPassword: "p"}},
+        {name: "token and basic", c: promConfig{BaseURL: "http://p", BearerToken: "t", BasicUser: "u"}, wantErr: true},
+        {name: "token file and basic", c: promConfig{BaseURL: "http://p", BearerTokenFile: "/tok", BasicUser: "u"}, wantErr: true},
+        {name: "no url", c: promConfig{}, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := newProm(tt.c); (err != nil) != tt.wantErr { t.Errorf("err = %v, wantErr %v", err, tt.wantErr) }
+        })
+    }
+}
+
+func TestPromSendsHeadersAndToken(t *testing.T) {
+    tok := filepath.Join(t.TempDir(), "token")
+    if err := os.WriteFile(tok, []byte("s3cret\n"), 0o600); err != nil { t.Fatal(err) }
+    var got http.Header
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r.Header.Clone()
+        w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"1"]}}`))
+    }))
+    defer srv.Close()
+    p, err := newProm(promConfig{BaseURL: srv.URL, BearerTokenFile: tok, Headers: http.Header{"X-Custom": {"a,b"}}})
+    if err != nil { t.Fatal(err) }
+    if _, err := p.QueryInstant(context.Background(), "1"); err != nil { t.Fatal(err) }
+    if got.Get("Authorization") != "Bearer s3cret" { t.Errorf("Authorization = %q", got.Get("Authorization")) }
+    if got.Get("X-Custom") != "a,b" { t.Errorf("X-Custom = %q", got.Get("X-Custom")) }
+}
@@ -2,70 +2,80 @@ package metrics
 
 import (
     "context"
-    "encoding/json"
     "fmt"
-    "io"
-    "net/http"
-    "net/url"
     "os"
-    appsv1 "k8s.io/api/apps/v1"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/dynamic"
 )
 
 type Provider interface {
-    AvgDeploymentCPU(ctx context.Context, d *appsv1.Deployment, window string) (float64, error)
+    // AvgWorkloadCPU returns the average CPU of the workload's pods over window.
+    AvgWorkloadCPU(ctx context.Context, w Workload, window string) (float64, error)
+    // QueryInstant returns the value of the first series; ErrNoData if empty.
     QueryInstant(ctx context.Context, promQL string) (float64, error)
+    // QueryVector returns every series of an instant query with its labels.
+    QueryVector(ctx context.Context, promQL string) ([]Sample, error)
+    // QueryRange evaluates promQL over [start, end] at the given step.
+    QueryRange(ctx context.Context, promQL string, start, end time.Time, step time.Duration) ([]Series, error)
+}
+
+// Workload is the part of a scalable object (Deployment, StatefulSet,
+// Rollout, ...) that providers need to find and size its pods.
+type Workload struct {
+    Kind      string
+    Namespace string
+    Name      string
+    Selector  *metav1.LabelSelector
+    Template  corev1.PodTemplateSpec
+}
+
+// Sample is one series of an instant vector (or a scalar, with no labels).
+type Sample struct {
+    Labels map[string]string
+    Time   time.Time
+    Value  float64
+}
+
+type Point struct {
+    Time  time.Time
+    Value float64
 }
 
-func NewProviderFromEnv(ctx context.Context) (Provider, error) {
+// Series is one series of a range query result.
+type Series struct {
+    Labels map[string]string
+    Points []Point
+}
+
+func NewProviderFromEnv(ctx context.Context, dyn dynamic.Interface) (Provider, error) {
     t := getenv("METRICS_PROVIDER","metrics-server")
     switch t {
     case "prometheus":
-        base := getenv("PROMETHEUS_URL","")
-        if base == "" { return nil, fmt.Errorf("PROMETHEUS_URL required for prometheus provider") }
-        return &prom{base: base}, nil
-    default:
+        return newProm(promConfigFromEnv())
+    case "metrics-server":
+        return &metricsServer{dyn: dyn}, nil
+    case "stub", "none":
         return &stub{}, nil
+    default:
+        return nil, fmt.Errorf("unknown METRICS_PROVIDER %q", t)
     }
 }
 
 type stub struct{}
-func (*stub) AvgDeploymentCPU(ctx context.Context, d *appsv1.Deployment, window string) (float64, error) {
+func (*stub) AvgWorkloadCPU(ctx context.Context, w Workload, window string) (float64, error) {
     return 0, fmt.Errorf("metrics provider not implemented; configure prometheus")
 }
 func (*stub) QueryInstant(ctx context.Context, q string) (float64, error) {
     return 0, fmt.Errorf("prometheus not configured")
 }
-
-type prom struct{ base string }
-
-func (p *prom) QueryInstant(ctx context.Context, q string) (float64, error) {
-    u := p.base + "/api/v1/query?query=" + url.QueryEscape(q)
-    req, _ := http.NewRequestWithContext(ctx, "GET", u, nil)
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil { return 0, err }
-    defer resp.Body.Close()
-    b, _ := io.ReadAll(resp.Body)
-    var out struct {
-        Status string `json:"status"`
-        Data struct {
-            ResultType string `json:"resultType"`
-            Result []struct{ Value [2]interface{} `json:"value"` } `json:"result"`
-        } `json:"data"`
-    }
-    if err := json.Unmarshal(b, &out); err != nil { return 0, err }
-    if len(out.Data.Result)==0 { return 0, fmt.Errorf("no data") }
-    s, _ := out.Data.Result[0].Value[1].(string)
-    var f float64
-    fmt.Sscanf(s, "%f", &f)
-    return f, nil
+func (*stub) QueryVector(ctx context.Context, q string) ([]Sample, error) {
+    return nil, fmt.Errorf("prometheus not configured")
 }
-
-func (p *prom) AvgDeploymentCPU(ctx context.Context, d *appsv1.Deployment, window string) (float64, error) {
-    ns := d.Namespace
-    name := d.Name
-    // Approximate: avg CPU usage of pods belonging to deployment over window
-    q := fmt.Sprintf(`avg(rate(container_cpu_usage_seconds_total{namespace="%s",pod=~"%s-.*",container!="",image!=""}[%s]))`, ns, name, window)
-    return p.QueryInstant(ctx, q)
+func (*stub) QueryRange(ctx context.Context, q string, start, end time.Time, step time.Duration) ([]Series, error) {
+    return nil, fmt.Errorf("prometheus not configured")
 }
 
 func getenv(k, d string) string { if v:=os.Getenv(k); v!="" { return v }; return d }
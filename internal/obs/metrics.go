@@ -7,12 +7,47 @@ var (
         prometheus.CounterOpts{Name: "auto_agent_actions_total", Help: "Count of actions by type"},
         []string{"type","namespace","workload"},
     )
+    ActionsSuppressedTotal = prometheus.NewCounterVec(
+        prometheus.CounterOpts{Name: "auto_agent_actions_suppressed_total", Help: "Actions refused by the guard, by reason"},
+        []string{"type","namespace","workload","reason"},
+    )
+    BudgetRemaining = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{Name: "auto_agent_action_budget_remaining", Help: "Actions left in the current budget window"},
+        []string{"scope","namespace","workload"},
+    )
     IncidentsTotal = prometheus.NewCounterVec(
         prometheus.CounterOpts{Name: "auto_agent_incidents_total", Help: "Incidents detected"},
         []string{"reason","namespace","workload"},
     )
+    AnomalyZScore = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{Name: "auto_agent_anomaly_zscore", Help: "Last z-score per anomaly rule (0 while warming up)"},
+        []string{"namespace","policy","rule"},
+    )
+    ForecastValue = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{Name: "auto_agent_forecast_value", Help: "Predicted scaling signal at the forecast horizon"},
+        []string{"namespace","kind","workload"},
+    )
+    ForecastError = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{Name: "auto_agent_forecast_error", Help: "Actual minus predicted value of the last forecast that came due"},
+        []string{"namespace","kind","workload"},
+    )
+    ForecastAbsPctError = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{Name: "auto_agent_forecast_abs_pct_error", Help: "Absolute percentage error of forecasts once they come due",
+            Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.5, 1, 2}},
+        []string{"namespace","kind","workload"},
+    )
+    ForecastModelRMSE = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{Name: "auto_agent_forecast_model_rmse", Help: "One-step-ahead RMSE of the fitted forecast model over its history"},
+        []string{"namespace","kind","workload"},
+    )
+    TimeToRecover = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{Name: "auto_agent_time_to_recover_seconds", Help: "Time from the first detection of a pod incident until its container was ready again",
+            Buckets: []float64{30, 60, 120, 300, 600, 1800, 3600, 3 * 3600, 12 * 3600}},
+        []string{"reason","namespace"},
+    )
 )
 
 func init() {
-    prometheus.MustRegister(ActionsTotal, IncidentsTotal)
+    prometheus.MustRegister(ActionsTotal, ActionsSuppressedTotal, BudgetRemaining, IncidentsTotal, AnomalyZScore,
+        ForecastValue, ForecastError, ForecastAbsPctError, ForecastModelRMSE, TimeToRecover)
 }
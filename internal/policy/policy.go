@@ -4,6 +4,7 @@ import (
     "os"
     "strconv"
     "strings"
+    "time"
 )
 
 type Mode string
@@ -21,7 +22,13 @@ type Policy struct {
     ScaleWindow       string
     MaxScaleStep      int
     MaxActionsPer10m  int
-    NamespaceAllow    map[string]struct__
+    MaxActionsPerNamespace10m int
+    MaxActionsPerWorkloadHour int
+    PodCooldown       time.Duration
+    ApprovalTTL       time.Duration
+    BumpMemoryPercent int
+    MaxMemoryLimit    string // ceiling for OOM memory bumps, a quantity; "" = none
+    NamespaceAllow    map[string]struct{}
     ExcludedAnnotation string
     LLMEnabled        bool
     LogLevel          string
@@ -31,6 +38,7 @@ func LoadFromEnv() *Policy {
     parseBool := func(k string, d bool) bool { v:=os.Getenv(k); if v=="" { return d }; b, _ := strconv.ParseBool(v); return b }
     parseFloat := func(k string, d float64) float64 { v:=os.Getenv(k); if v=="" { return d }; f, _ := strconv.ParseFloat(v,64); return f }
     parseInt := func(k string, d int) int { v:=os.Getenv(k); if v=="" { return d }; i, _ := strconv.Atoi(v); return i }
+    parseDur := func(k string, d time.Duration) time.Duration { v:=os.Getenv(k); if v=="" { return d }; t, err := time.ParseDuration(v); if err != nil { return d }; return t }
 
     ns := map[string]struct{}{}
     for _, n := range strings.Split(os.Getenv("NAMESPACE_ALLOWLIST"), ",") {
@@ -48,6 +56,12 @@ func LoadFromEnv() *Policy {
         ScaleWindow: os.Getenv("SCALE_WINDOW"),
         MaxScaleStep: parseInt("MAX_SCALE_STEP", 2),
         MaxActionsPer10m: parseInt("MAX_ACTIONS_PER_10M", 10),
+        MaxActionsPerNamespace10m: parseInt("MAX_ACTIONS_PER_NS_10M", 5),
+        MaxActionsPerWorkloadHour: parseInt("MAX_ACTIONS_PER_WORKLOAD_1H", 3),
+        PodCooldown: parseDur("POD_COOLDOWN", 5*time.Minute),
+        ApprovalTTL: parseDur("APPROVAL_TTL", 30*time.Minute),
+        BumpMemoryPercent: parseInt("BUMP_MEMORY_PERCENT", 20),
+        MaxMemoryLimit: os.Getenv("MAX_MEMORY_LIMIT"),
         NamespaceAllow: ns,
         ExcludedAnnotation: os.Getenv("EXCLUDED_ANNOTATION"),
         LLMEnabled: parseBool("LLM_ENABLED", true),
@@ -0,0 +1,123 @@
+package schedule
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+    _ "time/tzdata" // schedule timezones must resolve in distroless images
+)
+
+// Cron is a parsed standard 5-field cron expression (minute hour
+// day-of-month month day-of-week). Fields accept *, lists, ranges and steps
+// (e.g. "*/15", "1-5", "0,30"); day-of-week 0 and 7 are Sunday. As in cron,
+// when both day fields are restricted a time matches if either does.
+type Cron struct {
+    min, hour, dom, month, dow uint64 // bit sets
+    domAny, dowAny             bool
+}
+
+var fields = []struct{ name string; lo, hi int }{
+    {"minute", 0, 59}, {"hour", 0, 23}, {"day-of-month", 1, 31}, {"month", 1, 12}, {"day-of-week", 0, 7},
+}
+
+// Parse parses a cron expression.
+func Parse(expr string) (*Cron, error) {
+    f := strings.Fields(expr)
+    if len(f) != 5 { return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(f)) }
+    var sets [5]uint64
+    for i, s := range f {
+        b, err := parseField(s, fields[i].lo, fields[i].hi)
+        if err != nil { return nil, fmt.Errorf("cron %q: %s: %w", expr, fields[i].name, err) }
+        sets[i] = b
+    }
+    c := &Cron{min: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4], domAny: f[2] == "*", dowAny: f[4] == "*"}
+    if c.dow&(1<<7) != 0 { c.dow |= 1 } // 7 == Sunday
+    return c, nil
+}
+
+func parseField(s string, lo, hi int) (uint64, error) {
+    var b uint64
+    for _, part := range strings.Split(s, ",") {
+        rng, step := part, 1
+        if i := strings.IndexByte(part, '/'); i >= 0 {
+            n, err := strconv.Atoi(part[i+1:])
+            if err != nil || n <= 0 { return 0, fmt.Errorf("bad step in %q", part) }
+            rng, step = part[:i], n
+        }
+        a, z := lo, hi
+        if rng != "*" {
+            x, y, isRange := strings.Cut(rng, "-")
+            var err error
+            if a, err = strconv.Atoi(x); err != nil { return 0, fmt.Errorf("bad value %q", x) }
+            z = a
+            if isRange {
+                if z, err = strconv.Atoi(y); err != nil { return 0, fmt.Errorf("bad value %q", y) }
+            } else if step > 1 {
+                z = hi // "5/15" means from 5 every 15
+            }
+        }
+        if a < lo || z > hi || a > z { return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi) }
+        for v := a; v <= z; v += step { b |= 1 << uint(v) }
+    }
+    return b, nil
+}
+
+// Matches reports whether t, truncated to the minute, fires the expression.
+func (c *Cron) Matches(t time.Time) bool {
+    return c.min&(1<<uint(t.Minute())) != 0 && c.hourMatches(t)
+}
+
+// hourMatches reports whether some minute of t's hour can fire.
+func (c *Cron) hourMatches(t time.Time) bool {
+    if c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 { return false }
+    dom, dow := c.dom&(1<<uint(t.Day())) != 0, c.dow&(1<<uint(t.Weekday())) != 0
+    switch {
+    case c.domAny && c.dowAny: return true
+    case c.domAny: return dow
+    case c.dowAny: return dom
+    default: return dom || dow
+    }
+}
+
+// Prev returns the latest firing time at or before t, searching back at most
+// limit; ok is false if there is none in that range. Hours that cannot fire
+// are skipped whole, so a search costs at most one step per hour of limit
+// plus 60 per firing hour.
+func (c *Cron) Prev(t time.Time, limit time.Duration) (time.Time, bool) {
+    t = t.Truncate(time.Minute)
+    for stop := t.Add(-limit); !t.Before(stop); {
+        if !c.hourMatches(t) { t = t.Add(-time.Duration(t.Minute()+1) * time.Minute); continue }
+        if c.Matches(t) { return t, true }
+        t = t.Add(-time.Minute)
+    }
+    return time.Time{}, false
+}
+
+// Next returns the first firing time after t, searching ahead at most limit,
+// at the same cost as Prev.
+func (c *Cron) Next(t time.Time, limit time.Duration) (time.Time, bool) {
+    t = t.Truncate(time.Minute).Add(time.Minute)
+    for stop := t.Add(limit); !t.After(stop); {
+        if !c.hourMatches(t) { t = t.Add(time.Duration(60-t.Minute()) * time.Minute); continue }
+        if c.Matches(t) { return t, true }
+        t = t.Add(time.Minute)
+    }
+    return time.Time{}, false
+}
+
+// lookback bounds how far Active searches for the last start and end; it
+// covers monthly schedules. Each of its three searches takes at most about
+// 900 Matches calls (840 hours plus one firing hour).
+const lookback = 35 * 24 * time.Hour
+
+// Active reports whether a window opened by start and closed by end is open
+// at now: the latest start firing is more recent than the latest end firing.
+// until is the next end firing (zero if none within the lookback).
+func Active(start, end *Cron, now time.Time) (active bool, until time.Time) {
+    s, ok := start.Prev(now, lookback)
+    if !ok { return false, time.Time{} }
+    if e, ok := end.Prev(now, lookback); ok && !s.After(e) { return false, time.Time{} }
+    until, _ = end.Next(now, lookback)
+    return true, until
+}
@@ -0,0 +1,168 @@
+package schedule
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func bits(b uint64) []int {
+    var out []int
+    for v := 0; v < 64; v++ {
+        if b&(1<<uint(v)) != 0 { out = append(out, v) }
+    }
+    return out
+}
+
+func TestParseField(t *testing.T) {
+    for _, tc := range []struct {
+        in     string
+        lo, hi int
+        want   []int
+    }{
+        {"*/15", 0, 59, []int{0, 15, 30, 45}},
+        {"5/20", 0, 59, []int{5, 25, 45}},
+        {"10-20/5", 0, 59, []int{10, 15, 20}},
+        {"1-5", 0, 7, []int{1, 2, 3, 4, 5}},
+        {"0,30", 0, 59, []int{0, 30}},
+        {"1-3,10-12/2,20", 1, 31, []int{1, 2, 3, 10, 12, 20}},
+        {"*", 1, 12, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+    } {
+        got, err := parseField(tc.in, tc.lo, tc.hi)
+        if err != nil { t.Errorf("%q: %v", tc.in, err); continue }
+        if !reflect.DeepEqual(bits(got), tc.want) { t.Errorf("%q = %v, want %v", tc.in, bits(got), tc.want) }
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    for _, expr := range []string{"* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "1-x * * * *"} {
+        if _, err := Parse(expr); err == nil { t.Errorf("Parse(%q) succeeded", expr) }
+    }
+}
+
+func TestMatches(t *testing.T) {
+    // 2024-06-01 is a Saturday, 2024-06-02 a Sunday, 2024-06-03 a Monday.
+    at := func(day, hour, min int) time.Time { return time.Date(2024, 6, day, hour, min, 0, 0, time.UTC) }
+    for _, tc := range []struct {
+        expr string
+        t    time.Time
+        want bool
+    }{
+        {"0 0 1 * 1", at(1, 0, 0), true},  // day-of-month matches
+        {"0 0 1 * 1", at(3, 0, 0), true},  // day-of-week matches
+        {"0 0 1 * 1", at(2, 0, 0), false}, // neither
+        {"0 0 1 * *", at(3, 0, 0), false}, // only day-of-month is restricted
+        {"0 0 * * 1", at(1, 0, 0), false}, // only day-of-week is restricted
+        {"0 0 * * 7", at(2, 0, 0), true},  // 7 is Sunday
+        {"0 0 * * 0", at(2, 0, 0), true},
+        {"0 0 * * 7", at(3, 0, 0), false},
+        {"*/15 9-17 * * 1-5", at(3, 9, 45), true},
+        {"*/15 9-17 * * 1-5", at(3, 9, 50), false},
+        {"*/15 9-17 * * 1-5", at(1, 9, 45), false},
+        {"30 2 * 6 *", at(1, 2, 30).Add(59 * time.Second), true}, // seconds are ignored
+    } {
+        c, err := Parse(tc.expr)
+        if err != nil { t.Fatal(err) }
+        if got := c.Matches(tc.t); got != tc.want { t.Errorf("%q at %s = %v, want %v", tc.expr, tc.t.Format(time.RFC3339), got, tc.want) }
+    }
+}
+
+func TestActive(t *testing.T) {
+    at := func(day, hour, min int) time.Time { return time.Date(2024, 6, day, hour, min, 0, 0, time.UTC) }
+    for _, tc := range []struct {
+        name, start, end string
+        now              time.Time
+        want             bool
+        until            time.Time
+    }{
+        {"before the window", "0 22 * * *", "0 6 * * *", at(3, 21, 59), false, time.Time{}},
+        {"opening minute", "0 22 * * *", "0 6 * * *", at(3, 22, 0), true, at(4, 6, 0)},
+        {"across midnight", "0 22 * * *", "0 6 * * *", at(4, 3, 0), true, at(4, 6, 0)},
+        {"closing minute", "0 22 * * *", "0 6 * * *", at(4, 6, 0), false, time.Time{}},
+        {"weekday hours", "0 9 * * 1-5", "0 17 * * 1-5", at(3, 12, 0), true, at(3, 17, 0)},
+        {"weekend", "0 9 * * 1-5", "0 17 * * 1-5", at(1, 12, 0), false, time.Time{}},
+        {"Friday night to Monday", "0 18 * * 5", "0 8 * * 1", at(2, 12, 0), true, at(3, 8, 0)},
+        {"start and end in the same minute", "0 9 * * *", "0 9 * * *", at(3, 9, 0), false, time.Time{}},
+        {"start and end in the same minute, later", "0 9 * * *", "0 9 * * *", at(3, 12, 0), false, time.Time{}},
+        {"never started", "0 0 30 2 *", "0 6 * * *", at(3, 12, 0), false, time.Time{}},
+    } {
+        start, err := Parse(tc.start)
+        if err != nil { t.Fatal(err) }
+        end, err := Parse(tc.end)
+        if err != nil { t.Fatal(err) }
+        active, until := Active(start, end, tc.now)
+        if active != tc.want || !until.Equal(tc.until) { t.Errorf("%s: Active = %v until %s, want %v until %s", tc.name, active, until, tc.want, tc.until) }
+    }
+}
+
+func TestDST(t *testing.T) {
+    loc, err := time.LoadLocation("Europe/Berlin")
+    if err != nil { t.Fatal(err) }
+    c, _ := Parse("30 2 * * *")
+
+    // Clocks jump from 02:00 to 03:00 on 2024-03-31: 02:30 does not exist
+    // that day, so it does not fire.
+    got, ok := c.Next(time.Date(2024, 3, 30, 12, 0, 0, 0, loc), lookback)
+    if want := time.Date(2024, 3, 30, 2, 30, 0, 0, loc).AddDate(0, 0, 2); !ok || !got.Equal(want) { t.Errorf("spring forward: Next = %s, want %s", got, want) }
+
+    // Clocks go back from 03:00 to 02:00 on 2024-10-27: 02:30 happens twice,
+    // first in CEST (00:30 UTC), then in CET (01:30 UTC).
+    first, _ := c.Next(time.Date(2024, 10, 27, 0, 0, 0, 0, loc), lookback)
+    second, _ := c.Next(first, lookback)
+    if !first.Equal(time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC)) || !second.Equal(time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC)) {
+        t.Errorf("fall back: fires at %s and %s, want 00:30 and 01:30 UTC", first.UTC(), second.UTC())
+    }
+
+    // A night window spanning the spring-forward gap stays open across it.
+    start, _ := Parse("0 1 * * *")
+    end, _ := Parse("30 3 * * *")
+    active, until := Active(start, end, time.Date(2024, 3, 31, 3, 15, 0, 0, loc))
+    if !active || !until.Equal(time.Date(2024, 3, 31, 3, 30, 0, 0, loc)) { t.Errorf("across the gap: Active = %v until %s", active, until) }
+}
+
+// Prev and Next skip hours that cannot fire; they must agree with a plain
+// minute-by-minute search.
+func TestSearchMatchesMinuteScan(t *testing.T) {
+    prev := func(c *Cron, t time.Time, limit time.Duration) (time.Time, bool) {
+        t = t.Truncate(time.Minute)
+        for stop := t.Add(-limit); !t.Before(stop); t = t.Add(-time.Minute) {
+            if c.Matches(t) { return t, true }
+        }
+        return time.Time{}, false
+    }
+    next := func(c *Cron, t time.Time, limit time.Duration) (time.Time, bool) {
+        t = t.Truncate(time.Minute).Add(time.Minute)
+        for stop := t.Add(limit); !t.After(stop); t = t.Add(time.Minute) {
+            if c.Matches(t) { return t, true }
+        }
+        return time.Time{}, false
+    }
+    var locs []*time.Location
+    for _, name := range []string{"UTC", "Europe/Berlin", "Asia/Kolkata", "Australia/Lord_Howe"} {
+        loc, err := time.LoadLocation(name)
+        if err != nil { t.Fatal(err) }
+        locs = append(locs, loc)
+    }
+    exprs := []string{"0 22 * * *", "30 2 * * *", "*/20 9-17 * * 1-5", "15 3 1 * 0", "0 0 29 2 *", "59 23 31 * *", "0 12 * 3,10 7"}
+    for _, loc := range locs {
+        for _, e := range exprs {
+            c, err := Parse(e)
+            if err != nil { t.Fatal(err) }
+            for _, now := range []time.Time{
+                time.Date(2024, 3, 31, 2, 45, 0, 0, loc),
+                time.Date(2024, 4, 7, 1, 59, 30, 0, loc),
+                time.Date(2024, 10, 27, 2, 30, 0, 0, loc),
+                time.Date(2024, 6, 15, 12, 0, 0, 0, loc),
+            } {
+                for _, limit := range []time.Duration{90 * time.Minute, 36 * time.Hour, lookback} {
+                    g, ok := c.Prev(now, limit)
+                    w, wok := prev(c, now, limit)
+                    if ok != wok || !g.Equal(w) { t.Errorf("%s %q Prev(%s, %s) = %s %v, want %s %v", loc, e, now, limit, g, ok, w, wok) }
+                    g, ok = c.Next(now, limit)
+                    w, wok = next(c, now, limit)
+                    if ok != wok || !g.Equal(w) { t.Errorf("%s %q Next(%s, %s) = %s %v, want %s %v", loc, e, now, limit, g, ok, w, wok) }
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,110 @@
+package slack
+
+import (
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// Minimal Block Kit model: just what the agent renders.
+
+// Block Kit limits: characters per section text and blocks per message.
+const (
+    maxSectionText = 3000
+    maxBlocks      = 50
+)
+
+type Block struct {
+    Type     string `json:"type"`
+    BlockID  string `json:"block_id,omitempty"`
+    Text     *Text  `json:"text,omitempty"`
+    Elements []any  `json:"elements,omitempty"`
+}
+
+type Text struct {
+    Type string `json:"type"`
+    Text string `json:"text"`
+}
+
+type Button struct {
+    Type     string `json:"type"`
+    Text     Text   `json:"text"`
+    ActionID string `json:"action_id"`
+    Value    string `json:"value"`
+    Style    string `json:"style,omitempty"`
+}
+
+// Button action IDs understood by the interactivity endpoint.
+const (
+    ActionApprove = "approve"
+    ActionReject  = "reject"
+    ActionSnooze  = "snooze"
+)
+
+func Section(mrkdwn string) Block {
+    return Block{Type: "section", Text: &Text{Type: "mrkdwn", Text: mrkdwn}}
+}
+
+// Sections splits mrkdwn into section blocks within Slack's per-section
+// limit, preferring line breaks, and uses at most max blocks; text beyond
+// that is cut.
+func Sections(mrkdwn string, max int) []Block {
+    var out []Block
+    for mrkdwn != "" && len(out) < max {
+        chunk := mrkdwn
+        if utf8.RuneCountInString(chunk) > maxSectionText {
+            chunk = prefixRunes(chunk, maxSectionText)
+            if len(out) == max-1 {
+                chunk = prefixRunes(chunk, maxSectionText-len(" …(truncated)")) + " …(truncated)"
+                out = append(out, Section(chunk))
+                break
+            }
+            if i := strings.LastIndexByte(chunk, '\n'); i > 0 { chunk = chunk[:i+1] }
+        }
+        out = append(out, Section(chunk))
+        mrkdwn = mrkdwn[len(chunk):]
+    }
+    return out
+}
+
+// prefixRunes returns the first n runes of s.
+func prefixRunes(s string, n int) string {
+    for i := range s {
+        if n == 0 { return s[:i] }
+        n--
+    }
+    return s
+}
+
+func Context(mrkdwn string) Block {
+    return Block{Type: "context", Elements: []any{Text{Type: "mrkdwn", Text: mrkdwn}}}
+}
+
+// ApprovalMessage renders text followed by Approve / Reject / Snooze buttons
+// whose value is the pending action ID. snooze is the Snooze button's
+// duration; 0 means 1h. Long text is split over several sections so the
+// buttons always fit.
+func ApprovalMessage(text, actionID string, snooze time.Duration) Message {
+    btn := func(label, id, style string) Button {
+        return Button{Type: "button", Text: Text{Type: "plain_text", Text: label}, ActionID: id, Value: actionID, Style: style}
+    }
+    return Message{
+        Text: text,
+        Blocks: append(Sections(text, maxBlocks-1),
+            Block{Type: "actions", BlockID: "approval:" + actionID, Elements: []any{
+                btn("Approve", ActionApprove, "primary"),
+                btn("Reject", ActionReject, "danger"),
+                btn("Snooze "+durationLabel(snooze), ActionSnooze, ""),
+            }},
+        ),
+    }
+}
+
+// durationLabel formats d without zero minor units: 1h, 30m, 1h30m.
+func durationLabel(d time.Duration) string {
+    if d <= 0 { d = time.Hour }
+    s := d.String()
+    if strings.HasSuffix(s, "m0s") { s = strings.TrimSuffix(s, "0s") }
+    if strings.HasSuffix(s, "h0m") { s = strings.TrimSuffix(s, "0m") }
+    return s
+}
@@ -0,0 +1,67 @@
+package slack
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "unicode/utf8"
+)
+
+func TestSections(t *testing.T) {
+    line := strings.Repeat("x", 99) + "\n" // 100 chars
+    tests := []struct {
+        name       string
+        text       string
+        max        int
+        wantBlocks int
+        truncated  bool
+    }{
+        {name: "empty", text: "", max: 10, wantBlocks: 0},
+        {name: "short", text: "hello", max: 10, wantBlocks: 1},
+        {name: "at limit", text: strings.Repeat(line, 30), max: 10, wantBlocks: 1},
+        {name: "split at lines", text: strings.Repeat(line, 31), max: 10, wantBlocks: 2},
+        {name: "one long line", text: strings.Repeat("y", 7000), max: 10, wantBlocks: 3},
+        {name: "multibyte", text: strings.Repeat("é", 3001), max: 10, wantBlocks: 2},
+        {name: "capped", text: strings.Repeat(line, 100), max: 2, wantBlocks: 2, truncated: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bs := Sections(tt.text, tt.max)
+            if len(bs) != tt.wantBlocks { t.Fatalf("got %d blocks, want %d", len(bs), tt.wantBlocks) }
+            var joined strings.Builder
+            for _, b := range bs {
+                if b.Type != "section" || b.Text == nil { t.Fatalf("bad block %+v", b) }
+                if n := utf8.RuneCountInString(b.Text.Text); n > maxSectionText { t.Errorf("section has %d chars", n) }
+                if !utf8.ValidString(b.Text.Text) { t.Errorf("section split a rune") }
+                joined.WriteString(b.Text.Text)
+            }
+            if tt.truncated {
+                if !strings.HasSuffix(joined.String(), "…(truncated)") { t.Errorf("missing truncation marker") }
+                return
+            }
+            if joined.String() != tt.text { t.Errorf("sections do not add up to the text") }
+        })
+    }
+}
+
+func TestApprovalMessage(t *testing.T) {
+    m := ApprovalMessage(strings.Repeat("log line\n", 2000), "a1", 30*time.Minute)
+    if len(m.Blocks) > maxBlocks { t.Fatalf("%d blocks", len(m.Blocks)) }
+    last := m.Blocks[len(m.Blocks)-1]
+    if last.Type != "actions" || last.BlockID != "approval:a1" || len(last.Elements) != 3 { t.Fatalf("last block = %+v", last) }
+    if got := last.Elements[2].(Button).Text.Text; got != "Snooze 30m" { t.Errorf("snooze label = %q", got) }
+}
+
+func TestDurationLabel(t *testing.T) {
+    for d, want := range map[time.Duration]string{
+        0:                            "1h",
+        time.Hour:                    "1h",
+        30 * time.Minute:             "30m",
+        90 * time.Minute:             "1h30m",
+        24 * time.Hour:               "24h",
+        45 * time.Second:             "45s",
+        time.Minute + 30*time.Second: "1m30s",
+    } {
+        if got := durationLabel(d); got != want { t.Errorf("durationLabel(%s) = %q, want %q", d, got, want) }
+    }
+}
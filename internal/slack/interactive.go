@@ -0,0 +1,73 @@
+package slack
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+// MaxRequestAge bounds the X-Slack-Request-Timestamp skew to defeat replays.
+const MaxRequestAge = 5 * time.Minute
+
+var ErrBadSignature = errors.New("slack: invalid request signature")
+
+// VerifySignature checks Slack's v0 request signature:
+// X-Slack-Signature = "v0=" + hex(HMAC-SHA256(secret, "v0:" + timestamp + ":" + body)).
+func VerifySignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+    if secret == "" { return errors.New("slack: signing secret not configured") }
+    ts, err := strconv.ParseInt(timestamp, 10, 64)
+    if err != nil { return fmt.Errorf("slack: bad timestamp %q", timestamp) }
+    if d := now.Sub(time.Unix(ts, 0)); d > MaxRequestAge || d < -MaxRequestAge {
+        return fmt.Errorf("slack: stale request (%s old)", d.Round(time.Second))
+    }
+    mac := hmac.New(sha256.New, []byte(secret))
+    fmt.Fprintf(mac, "v0:%s:", timestamp)
+    mac.Write(body)
+    want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+    if !hmac.Equal([]byte(want), []byte(signature)) { return ErrBadSignature }
+    return nil
+}
+
+// Interaction is the subset of a block_actions payload the agent uses.
+type Interaction struct {
+    Type        string `json:"type"`
+    ResponseURL string `json:"response_url"`
+    User        struct {
+        ID       string `json:"id"`
+        Username string `json:"username"`
+        Name     string `json:"name"`
+    } `json:"user"`
+    Actions []struct {
+        ActionID string `json:"action_id"`
+        Value    string `json:"value"`
+    } `json:"actions"`
+    Message struct {
+        Text string `json:"text"`
+        TS   string `json:"ts"`
+    } `json:"message"`
+}
+
+// Who returns a display name for the clicking user.
+func (i *Interaction) Who() string {
+    if i.User.Username != "" { return i.User.Username }
+    if i.User.Name != "" { return i.User.Name }
+    return i.User.ID
+}
+
+// ParseInteraction decodes the form-encoded body Slack posts to the
+// interactivity request URL.
+func ParseInteraction(body []byte) (*Interaction, error) {
+    form, err := url.ParseQuery(string(body))
+    if err != nil { return nil, err }
+    p := form.Get("payload")
+    if p == "" { return nil, errors.New("slack: missing payload") }
+    in := &Interaction{}
+    if err := json.Unmarshal([]byte(p), in); err != nil { return nil, err }
+    return in, nil
+}
@@ -0,0 +1,67 @@
+package slack
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func sign(secret, ts string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte("v0:" + ts + ":"))
+    mac.Write(body)
+    return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+    now := time.Unix(1700000000, 0)
+    body := []byte("payload=%7B%22type%22%3A%22block_actions%22%7D")
+    ts := strconv.FormatInt(now.Unix(), 10)
+    good := sign("s3cret", ts, body)
+
+    tests := []struct {
+        name      string
+        secret    string
+        timestamp string
+        signature string
+        body      []byte
+        wantErr   bool
+        badSig    bool
+    }{
+        {name: "valid", secret: "s3cret", timestamp: ts, signature: good, body: body},
+        {name: "valid within skew", secret: "s3cret", timestamp: strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10),
+            signature: sign("s3cret", strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), body), body: body},
+        {name: "wrong secret", secret: "other", timestamp: ts, signature: good, body: body, wantErr: true, badSig: true},
+        {name: "tampered body", secret: "s3cret", timestamp: ts, signature: good, body: []byte("payload=x"), wantErr: true, badSig: true},
+        {name: "signature for other timestamp", secret: "s3cret", timestamp: strconv.FormatInt(now.Unix()+1, 10), signature: good, body: body, wantErr: true, badSig: true},
+        {name: "missing signature", secret: "s3cret", timestamp: ts, body: body, wantErr: true, badSig: true},
+        {name: "stale", secret: "s3cret", timestamp: strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10),
+            signature: sign("s3cret", strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), body), body: body, wantErr: true},
+        {name: "from the future", secret: "s3cret", timestamp: strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10),
+            signature: sign("s3cret", strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), body), body: body, wantErr: true},
+        {name: "bad timestamp", secret: "s3cret", timestamp: "yesterday", signature: good, body: body, wantErr: true},
+        {name: "no secret", secret: "", timestamp: ts, signature: good, body: body, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := VerifySignature(tt.secret, tt.timestamp, tt.signature, tt.body, now)
+            if (err != nil) != tt.wantErr { t.Fatalf("err = %v, wantErr %v", err, tt.wantErr) }
+            if tt.badSig && !errors.Is(err, ErrBadSignature) { t.Errorf("err = %v, want ErrBadSignature", err) }
+        })
+    }
+}
+
+func TestParseInteraction(t *testing.T) {
+    body := []byte(`payload=%7B%22type%22%3A%22block_actions%22%2C%22response_url%22%3A%22https%3A%2F%2Fhooks.example%2Fr%22%2C%22user%22%3A%7B%22id%22%3A%22U1%22%2C%22username%22%3A%22alice%22%7D%2C%22actions%22%3A%5B%7B%22action_id%22%3A%22approve%22%2C%22value%22%3A%22a1%22%7D%5D%7D`)
+    in, err := ParseInteraction(body)
+    if err != nil { t.Fatal(err) }
+    if in.Type != "block_actions" || in.ResponseURL != "https://hooks.example/r" { t.Errorf("got %+v", in) }
+    if in.Who() != "alice" { t.Errorf("Who() = %q", in.Who()) }
+    if len(in.Actions) != 1 || in.Actions[0].ActionID != ActionApprove || in.Actions[0].Value != "a1" { t.Errorf("actions = %+v", in.Actions) }
+
+    if _, err := ParseInteraction([]byte("foo=bar")); err == nil { t.Error("missing payload: want error") }
+}
@@ -3,14 +3,231 @@ package slack
 import (
     "bytes"
     "encoding/json"
+    "fmt"
     "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
 )
 
-type Client struct{ hook string }
+// Message is the JSON body accepted by incoming webhooks, response_url and
+// chat.postMessage / chat.update.
+type Message struct {
+    Channel         string  `json:"channel,omitempty"` // honoured by legacy webhooks and bot mode; empty: default
+    Text            string  `json:"text"`
+    Blocks          []Block `json:"blocks,omitempty"`
+    ReplaceOriginal bool    `json:"replace_original,omitempty"`
+    ThreadTS        string  `json:"thread_ts,omitempty"` // bot mode: reply in this thread
+    TS              string  `json:"ts,omitempty"`        // chat.update: the message to replace
+}
+
+// Client posts to an incoming webhook or, in bot mode, through the Web API
+// with a bot token (chat:write). Only bot mode honours per-message channels
+// and threads incidents: it remembers the parent message of each incident
+// key so later messages for it become thread replies.
+type Client struct {
+    hook    string
+    token   string // bot mode when set
+    api     string
+    channel string // bot mode default channel
+
+    // Snooze is the duration of the approval Snooze button; 0 means 1h.
+    Snooze time.Duration
+
+    mu      sync.Mutex
+    threads map[string]*thread  // incident key → parent message
+    locks   map[string]*keyLock // incident key → lock held while posting
+}
+
+type keyLock struct {
+    sync.Mutex
+    n int // holders and waiters
+}
+
+type thread struct {
+    channel, ts, text string
+    at                time.Time
+}
+
+// threads older than this are forgotten, bounding memory for incidents that
+// never resolve
+const threadTTL = 7 * 24 * time.Hour
+
+// httpClient bounds every Slack call, so a hung API cannot block the handler
+// or the recovery loop that posted.
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
 func New(hook string) *Client { return &Client{hook: hook} }
+
+// NewBot returns a Web API client. channel is used for messages without one.
+// The API base is https://slack.com/api unless SLACK_API_URL is set.
+func NewBot(token, channel string) *Client {
+    api := os.Getenv("SLACK_API_URL")
+    if api == "" { api = "https://slack.com/api" }
+    return &Client{token: token, api: strings.TrimRight(api, "/"), channel: channel, threads: map[string]*thread{}, locks: map[string]*keyLock{}}
+}
+
+// Bot reports whether c posts through the Web API.
+func (c *Client) Bot() bool { return c.token != "" }
+
 func (c *Client) Post(text string) error {
-    if c.hook == "" { return nil }
-    body, _ := json.Marshal(map[string]string{"text": text})
-    _, err := http.Post(c.hook, "application/json", bytes.NewReader(body))
+    return c.PostMessage(Message{Text: text})
+}
+
+// PostTo sends text to channel ("#name" or ID); empty means the default.
+func (c *Client) PostTo(channel, text string) error {
+    return c.PostMessage(Message{Channel: channel, Text: text})
+}
+
+// PostMessage sends a Block Kit message; Text is the notification fallback.
+func (c *Client) PostMessage(m Message) error {
+    _, _, err := c.post(m)
     return err
 }
+
+// Respond posts to an interaction's response_url, e.g. to update the message
+// that carried the clicked button.
+func (c *Client) Respond(responseURL string, m Message) error {
+    return send(responseURL, m)
+}
+
+// PostIncident posts the messages of one detection of incident key. In bot
+// mode the first detection posts head as the incident's parent message and
+// the rest as replies in its thread; later detections post everything in
+// that thread. Empty messages are skipped. The webhook posts them all, in
+// order. Concurrent calls for one key are serialised, so only one of them
+// starts the thread.
+func (c *Client) PostIncident(key string, head Message, replies ...Message) error {
+    if !c.Bot() {
+        for _, m := range append([]Message{head}, replies...) {
+            if m.Text == "" { continue }
+            if err := c.PostMessage(m); err != nil { return err }
+        }
+        return nil
+    }
+    defer c.lock(key)()
+    t := c.thread(key)
+    if t == nil {
+        ch, ts, err := c.post(head)
+        if err != nil { return err }
+        t = &thread{channel: ch, ts: ts, text: head.Text, at: time.Now()}
+        c.mu.Lock(); c.threads[key] = t; c.mu.Unlock()
+    } else {
+        replies = append([]Message{head}, replies...)
+    }
+    for _, m := range replies {
+        if m.Text == "" { continue }
+        m.Channel, m.ThreadTS = t.channel, t.ts
+        if _, _, err := c.post(m); err != nil { return err }
+    }
+    return nil
+}
+
+// ResolveIncident posts m for incident key and ends its thread. In bot mode m
+// is a reply that is also broadcast to the channel, and the parent message is
+// updated with resolved; without a thread (or with the webhook) m is posted
+// to channel. The thread is kept if either call fails, so a retry posts into
+// it again.
+func (c *Client) ResolveIncident(key, channel, resolved string, m Message) error {
+    if c.Bot() { defer c.lock(key)() }
+    t := c.thread(key)
+    if t == nil {
+        if m.Channel == "" { m.Channel = channel }
+        return c.PostMessage(m)
+    }
+    reply := struct {
+        Message
+        Broadcast bool `json:"reply_broadcast"`
+    }{m, true}
+    reply.Channel, reply.ThreadTS = t.channel, t.ts
+    if err := c.call("chat.postMessage", reply, nil); err != nil { return err }
+    text := resolved + "\n" + t.text
+    if err := c.call("chat.update", Message{Channel: t.channel, TS: t.ts, Text: text, Blocks: Sections(text, maxBlocks)}, nil); err != nil { return err }
+    c.mu.Lock(); delete(c.threads, key); c.mu.Unlock()
+    return nil
+}
+
+// lock serialises the posts of incident key and returns the unlock func.
+func (c *Client) lock(key string) func() {
+    c.mu.Lock()
+    l := c.locks[key]
+    if l == nil { l = &keyLock{}; c.locks[key] = l }
+    l.n++
+    c.mu.Unlock()
+    l.Lock()
+    return func() {
+        l.Unlock()
+        c.mu.Lock()
+        if l.n--; l.n == 0 { delete(c.locks, key) }
+        c.mu.Unlock()
+    }
+}
+
+func (c *Client) thread(key string) *thread {
+    if !c.Bot() || key == "" { return nil }
+    c.mu.Lock(); defer c.mu.Unlock()
+    for k, t := range c.threads {
+        if time.Since(t.at) > threadTTL { delete(c.threads, k) }
+    }
+    return c.threads[key]
+}
+
+// post sends m and returns the channel ID and ts of the posted message (bot
+// mode only).
+func (c *Client) post(m Message) (string, string, error) {
+    if !c.Bot() {
+        if c.hook == "" { return "", "", nil }
+        return "", "", send(c.hook, m)
+    }
+    if m.Channel == "" { m.Channel = c.channel }
+    var out struct {
+        Channel string `json:"channel"`
+        TS      string `json:"ts"`
+    }
+    err := c.call("chat.postMessage", m, &out)
+    return out.Channel, out.TS, err
+}
+
+// call invokes a Web API method. Slack reports failures as 200 with ok:false;
+// a 429 is retried once after Retry-After.
+func (c *Client) call(method string, in, out interface{}) error {
+    body, _ := json.Marshal(in)
+    for attempt := 0; ; attempt++ {
+        req, err := http.NewRequest("POST", c.api+"/"+method, bytes.NewReader(body))
+        if err != nil { return err }
+        req.Header.Set("Authorization", "Bearer "+c.token)
+        req.Header.Set("Content-Type", "application/json; charset=utf-8")
+        resp, err := httpClient.Do(req)
+        if err != nil { return err }
+        if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+            resp.Body.Close()
+            wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+            if wait <= 0 || wait > 30 { wait = 1 }
+            time.Sleep(time.Duration(wait) * time.Second)
+            continue
+        }
+        var res struct {
+            OK    bool   `json:"ok"`
+            Error string `json:"error"`
+        }
+        raw := new(bytes.Buffer)
+        _, _ = raw.ReadFrom(resp.Body)
+        resp.Body.Close()
+        if resp.StatusCode >= 300 { return fmt.Errorf("slack: %s: %s", method, resp.Status) }
+        if err := json.Unmarshal(raw.Bytes(), &res); err != nil { return fmt.Errorf("slack: %s: %w", method, err) }
+        if !res.OK { return fmt.Errorf("slack: %s: %s", method, res.Error) }
+        if out != nil { return json.Unmarshal(raw.Bytes(), out) }
+        return nil
+    }
+}
+
+func send(url string, m Message) error {
+    body, _ := json.Marshal(m)
+    resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 { return fmt.Errorf("slack: %s", resp.Status) }
+    return nil
+}
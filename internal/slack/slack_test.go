@@ -0,0 +1,73 @@
+package slack
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+)
+
+// fakeAPI stands in for the Slack Web API, counting parent messages and
+// failing chat.update while failUpdate is set.
+type fakeAPI struct {
+    mu         sync.Mutex
+    parents    int
+    replies    int
+    updates    int
+    failUpdate bool
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    var m struct {
+        ThreadTS string `json:"thread_ts"`
+    }
+    _ = json.NewDecoder(r.Body).Decode(&m)
+    f.mu.Lock(); defer f.mu.Unlock()
+    switch r.URL.Path {
+    case "/chat.postMessage":
+        if m.ThreadTS != "" { f.replies++ } else { f.parents++ }
+        fmt.Fprintf(w, `{"ok":true,"channel":"C1","ts":"1.%d"}`, f.parents)
+    case "/chat.update":
+        f.updates++
+        if f.failUpdate { fmt.Fprint(w, `{"ok":false,"error":"ratelimited"}`); return }
+        fmt.Fprint(w, `{"ok":true}`)
+    }
+}
+
+func newBot(t *testing.T, f *fakeAPI) *Client {
+    srv := httptest.NewServer(f)
+    t.Cleanup(srv.Close)
+    t.Setenv("SLACK_API_URL", srv.URL)
+    return NewBot("xoxb-test", "#ops")
+}
+
+func TestPostIncidentStartsOneThread(t *testing.T) {
+    f := &fakeAPI{}
+    c := newBot(t, f)
+    var wg sync.WaitGroup
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if err := c.PostIncident("ns/pod/CrashLoopBackOff", Message{Text: "crash"}, Message{Text: "logs"}); err != nil { t.Error(err) }
+        }()
+    }
+    wg.Wait()
+    if f.parents != 1 { t.Fatalf("%d parent messages, want 1", f.parents) }
+    if f.replies != 19 { t.Fatalf("%d replies, want 19", f.replies) }
+}
+
+func TestResolveIncidentKeepsThreadOnFailure(t *testing.T) {
+    f := &fakeAPI{failUpdate: true}
+    c := newBot(t, f)
+    if err := c.PostIncident("k", Message{Text: "crash"}); err != nil { t.Fatal(err) }
+    if err := c.ResolveIncident("k", "", "Resolved", Message{Text: "recovered"}); err == nil { t.Fatal("want the chat.update error") }
+    if c.thread("k") == nil { t.Fatal("thread dropped after a failed resolve") }
+
+    f.mu.Lock(); f.failUpdate = false; f.mu.Unlock()
+    if err := c.ResolveIncident("k", "", "Resolved", Message{Text: "recovered"}); err != nil { t.Fatal(err) }
+    if c.thread("k") != nil { t.Fatal("thread kept after resolve") }
+    if f.parents != 1 || f.updates != 2 { t.Fatalf("parents = %d, updates = %d", f.parents, f.updates) }
+}
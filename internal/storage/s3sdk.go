@@ -4,7 +4,6 @@ import (
     "context"
     "encoding/json"
     "fmt"
-    "time"
     "bytes"
 
     "github.com/aws/aws-sdk-go-v2/aws"